@@ -7,4 +7,8 @@ var (
 	ErrNoSupportAudioCodec = fmt.Errorf("unsupported audio codec")
 	ErrSourceClosed        = fmt.Errorf("the source is closed")
 	ErrNoAudio             = fmt.Errorf("no audio")
+	ErrSignatureMissing    = fmt.Errorf("signature missing")
+	ErrSignatureInvalid    = fmt.Errorf("signature invalid")
+	ErrSignatureExpired    = fmt.Errorf("signature expired")
+	ErrSignatureMismatch   = fmt.Errorf("signature does not match the requested stream")
 )
@@ -6,3 +6,11 @@ type RtmpServer interface {
 	Serve(listener net.Listener) error
 	Shutdown() error
 }
+
+// RtmpTLSServer is an RtmpServer which also serves rtmps, assert it on an RtmpServer to use tls.
+type RtmpTLSServer interface {
+	RtmpServer
+
+	ServeTLS(listener net.Listener) error
+	ReloadCertificates() error
+}
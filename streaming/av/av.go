@@ -3,6 +3,7 @@ package av
 import (
 	"fmt"
 	"io"
+	"net/url"
 )
 
 const (
@@ -47,8 +48,9 @@ const (
 	AVC_NALU   = 1
 	AVC_EOS    = 2
 
-	FRAME_KEY   = 1
-	FRAME_INTER = 2
+	FRAME_KEY        = 1
+	FRAME_INTER      = 2
+	FRAME_DISPOSABLE = 3
 
 	VIDEO_H264 = 7
 )
@@ -66,6 +68,8 @@ type Packet struct {
 	StreamID   uint32
 	Header     PacketHeader
 	Data       []byte
+	// Discontinuity is set on the first packet after the timeline was rebased.
+	Discontinuity bool
 }
 
 type PacketHeader interface {
@@ -141,6 +145,22 @@ type Info struct {
 	Name string
 	App  string
 	URL  string
+
+	// Params are the query parameters of the tcUrl, app and stream name, for example ?token=abc.
+	Params url.Values
+
+	// TLS is set for connections accepted over rtmps.
+	TLS *TLSInfo
+}
+
+type TLSInfo struct {
+	// ServerName is the SNI host name sent by the client.
+	ServerName  string
+	Version     string
+	CipherSuite string
+	// PeerVerified is set when the client presented a certificate signed by the client ca.
+	PeerVerified   bool
+	PeerCommonName string
 }
 
 func (i Info) String() string {
@@ -0,0 +1,100 @@
+package av
+
+import (
+	"time"
+)
+
+const (
+	// DefaultMaxTimestampGap is the forward jump from which timestamps count as discontinuous.
+	DefaultMaxTimestampGap = 10 * time.Second
+	// backwardTolerance allows audio and video to interleave slightly out of order.
+	backwardTolerance = 1000
+	// maxTimestampStep bounds the step a rebased timeline continues with after a discontinuity.
+	maxTimestampStep = 100
+	// timestampWrap is where the 32 bit millisecond output wraps around.
+	timestampWrap = 1 << 32
+)
+
+// TimestampNormalizer rebases packet timestamps into one monotonic timeline starting at zero. Encoders
+// reconnecting or resetting their clock jump backwards or leave large gaps, those packets are rebased to
+// continue right after the last one and marked with Discontinuity. The 32 bit millisecond rollover of the
+// input is followed without a discontinuity, the output starts over at zero with one once it would wrap.
+type TimestampNormalizer struct {
+	maxGap int64
+
+	started     bool
+	discontinue bool
+	lastIn      uint32
+	in          int64
+	offset      int64
+	maxOut      int64
+	lastOut     [2]int64
+	lastStep    int64
+}
+
+func NewTimestampNormalizer(maxGap time.Duration) *TimestampNormalizer {
+	if maxGap <= 0 {
+		maxGap = DefaultMaxTimestampGap
+	}
+	return &TimestampNormalizer{
+		maxGap:   maxGap.Milliseconds(),
+		lastStep: 1,
+	}
+}
+
+// Discontinue rebases the next packet as a discontinuity, used when a new publisher takes over.
+func (n *TimestampNormalizer) Discontinue() {
+	n.discontinue = true
+}
+
+// Normalize rewrites the timestamp of p, p.Discontinuity reports if the timeline was rebased at p.
+func (n *TimestampNormalizer) Normalize(p *Packet) {
+	if !n.started {
+		n.started = true
+		n.lastIn = p.TimeStamp
+		n.in = int64(p.TimeStamp)
+		n.offset = -n.in
+	}
+
+	// the signed 32 bit difference follows the rollover.
+	delta := int64(int32(p.TimeStamp - n.lastIn))
+	n.lastIn = p.TimeStamp
+	n.in += delta
+
+	p.Discontinuity = n.discontinue || delta < -backwardTolerance || delta > n.maxGap
+	n.discontinue = false
+	if p.Discontinuity {
+		n.offset = n.maxOut + n.lastStep - n.in
+	} else if delta > 0 && delta <= maxTimestampStep {
+		n.lastStep = delta
+	}
+
+	out := n.in + n.offset
+	if out >= timestampWrap {
+		p.Discontinuity = true
+		n.offset -= out
+		n.maxOut = 0
+		n.lastOut = [2]int64{}
+		out = 0
+	}
+	// packets of the other track slightly behind the first one start at zero too.
+	if out < 0 {
+		out = 0
+	}
+	track := 0
+	if p.IsVideo {
+		track = 1
+	}
+	if !p.IsMetadata {
+		// every track stays monotonic, across tracks the small interleaving is kept.
+		if out < n.lastOut[track] {
+			out = n.lastOut[track]
+		}
+		n.lastOut[track] = out
+	}
+	if out > n.maxOut {
+		n.maxOut = out
+	}
+
+	p.TimeStamp = uint32(out)
+}
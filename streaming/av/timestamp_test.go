@@ -0,0 +1,58 @@
+package av
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTimestampNormalizer(t *testing.T) {
+	at := assert.New(t)
+
+	n := NewTimestampNormalizer(0)
+	normalize := func(ts uint32, video bool) (uint32, bool) {
+		p := &Packet{TimeStamp: ts, IsVideo: video, IsAudio: !video}
+		n.Normalize(p)
+		return p.TimeStamp, p.Discontinuity
+	}
+	check := func(ts uint32, video bool, out uint32, discontinuity bool) {
+		t.Helper()
+		got, disc := normalize(ts, video)
+		at.Equal(got, out)
+		at.Equal(disc, discontinuity)
+	}
+
+	// the timeline starts at zero, audio slightly behind the first frame too
+	check(1000, true, 0, false)
+	check(990, false, 0, false)
+	check(1023, false, 23, false)
+	check(1033, true, 33, false)
+	// audio slightly behind video is kept
+	check(1030, false, 30, false)
+
+	// the encoder reconnected and starts over
+	check(0, true, 43, true)
+	check(40, true, 83, false)
+	check(30, false, 73, false)
+
+	// a large gap is closed
+	check(60040, true, 123, true)
+	check(60080, true, 163, false)
+
+	// the rollover of the input continues the timeline
+	n = NewTimestampNormalizer(0)
+	check(0xffffffe0, true, 0, false)
+	check(0x10, true, 0x30, false)
+	check(0x38, true, 0x58, false)
+
+	// the output starts over at zero before it wraps
+	n = NewTimestampNormalizer(1 << 31 * time.Millisecond)
+	check(0, true, 0, false)
+	check(0x7fff0000, true, 0x7fff0000, false)
+	check(0xfffe0000, true, 0xfffe0000, false)
+	check(0x7ffd0000, true, 0, true)
+	check(0x7ffd0028, true, 0x28, false)
+	// the other track still behind the wrap stays at zero
+	check(0x7ffcfff0, false, 0, false)
+}
@@ -0,0 +1,125 @@
+package flv
+
+import (
+	"fmt"
+	"io"
+	"sync"
+	"time"
+
+	"github.com/viderstv/common/streaming/av"
+	"github.com/viderstv/common/utils/pio"
+)
+
+var (
+	ErrInvalidHeader = fmt.Errorf("invalid flv header")
+	ErrInvalidTag    = fmt.Errorf("invalid flv tag")
+)
+
+// Reader reads tags from an flv file and exposes them as an av.ReadCloser.
+type Reader struct {
+	av.RWBaser
+
+	info av.Info
+
+	r       io.Reader
+	demuxer *Demuxer
+	buf     []byte
+
+	once   sync.Once
+	closed chan struct{}
+}
+
+func NewReader(r io.Reader, info av.Info) (*Reader, error) {
+	header := make([]byte, len(flvHeader)+4)
+	if _, err := io.ReadFull(r, header); err != nil {
+		return nil, err
+	}
+	if header[0] != 'F' || header[1] != 'L' || header[2] != 'V' {
+		return nil, ErrInvalidHeader
+	}
+
+	// skip any extra header bytes declared by the data offset
+	offset := int(pio.U32BE(header[5:9]))
+	if offset > len(flvHeader) {
+		if _, err := io.CopyN(io.Discard, r, int64(offset-len(flvHeader))); err != nil {
+			return nil, err
+		}
+	}
+
+	return &Reader{
+		RWBaser: av.NewRWBaser(time.Second * 10),
+		info:    info,
+		r:       r,
+		demuxer: NewDemuxer(),
+		buf:     make([]byte, headerLen),
+		closed:  make(chan struct{}),
+	}, nil
+}
+
+func (r *Reader) Read(p *av.Packet) error {
+	for {
+		if _, err := io.ReadFull(r.r, r.buf[:headerLen]); err != nil {
+			return err
+		}
+
+		typeID := r.buf[0]
+		dataLen := pio.U24BE(r.buf[1:4])
+		timestamp := pio.U24BE(r.buf[4:7]) | uint32(r.buf[7])<<24
+
+		data := make([]byte, dataLen+4)
+		if _, err := io.ReadFull(r.r, data); err != nil {
+			return err
+		}
+		data = data[:dataLen]
+
+		r.SetPreTime()
+
+		switch typeID {
+		case av.TAG_AUDIO, av.TAG_VIDEO, av.TAG_SCRIPTDATAAMF0, av.TAG_SCRIPTDATAAMF3:
+		default:
+			continue
+		}
+		if dataLen == 0 {
+			continue
+		}
+
+		*p = av.Packet{
+			IsAudio:    typeID == av.TAG_AUDIO,
+			IsVideo:    typeID == av.TAG_VIDEO,
+			IsMetadata: typeID == av.TAG_SCRIPTDATAAMF0 || typeID == av.TAG_SCRIPTDATAAMF3,
+			TimeStamp:  timestamp,
+			Data:       data,
+		}
+		r.RecTimeStamp(timestamp, uint32(typeID))
+
+		if p.IsMetadata {
+			return nil
+		}
+		// the header of an aac tag holds its packet type, the one of an avc tag its composition time.
+		if (p.IsAudio && data[0]>>4 == av.SOUND_AAC && dataLen < 2) || (p.IsVideo && dataLen < 5) {
+			return ErrInvalidTag
+		}
+
+		return r.demuxer.DemuxH(p)
+	}
+}
+
+func (r *Reader) Info() av.Info {
+	return r.info
+}
+
+func (r *Reader) Running() <-chan struct{} {
+	return r.closed
+}
+
+func (r *Reader) Close() error {
+	var err error
+	r.once.Do(func() {
+		close(r.closed)
+		if c, ok := r.r.(io.Closer); ok {
+			err = c.Close()
+		}
+	})
+
+	return err
+}
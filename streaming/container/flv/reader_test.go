@@ -0,0 +1,120 @@
+package flv
+
+import (
+	"bytes"
+	"io"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/viderstv/common/streaming/av"
+)
+
+func tag(typeID byte, ts uint32, data []byte) []byte {
+	b := []byte{
+		typeID,
+		byte(len(data) >> 16), byte(len(data) >> 8), byte(len(data)),
+		byte(ts >> 16), byte(ts >> 8), byte(ts), byte(ts >> 24),
+		0x00, 0x00, 0x00,
+	}
+	b = append(b, data...)
+	size := len(data) + headerLen
+	return append(b, byte(size>>24), byte(size>>16), byte(size>>8), byte(size))
+}
+
+func flvFile(tags ...[]byte) []byte {
+	b := append([]byte(nil), flvHeader...)
+	b = append(b, 0x00, 0x00, 0x00, 0x00)
+	for _, t := range tags {
+		b = append(b, t...)
+	}
+	return b
+}
+
+func TestReader(t *testing.T) {
+	at := assert.New(t)
+
+	data := flvFile(
+		tag(av.TAG_SCRIPTDATAAMF0, 0, []byte{0x02, 0x00, 0x00}),
+		tag(av.TAG_VIDEO, 0, []byte{0x17, 0x00, 0x00, 0x00, 0x00, 0x01}),
+		// unknown tags and empty tags are skipped
+		tag(0x10, 0, []byte{0x01}),
+		tag(av.TAG_AUDIO, 0, nil),
+		tag(av.TAG_AUDIO, 20, []byte{0xaf, 0x01, 0x21}),
+		// the extended byte holds the upper 8 bits of the timestamp
+		tag(av.TAG_VIDEO, 0x01000040, []byte{0x27, 0x01, 0x00, 0x00, 0x00, 0x02}),
+	)
+	r, err := NewReader(bytes.NewReader(data), av.Info{URL: "test.flv"})
+	if !at.NoError(err) {
+		return
+	}
+
+	var p av.Packet
+	at.NoError(r.Read(&p))
+	at.True(p.IsMetadata)
+
+	at.NoError(r.Read(&p))
+	at.True(p.IsVideo)
+	at.True(p.Header.(av.VideoPacketHeader).IsSeq())
+
+	at.NoError(r.Read(&p))
+	at.True(p.IsAudio)
+	at.Equal(p.TimeStamp, uint32(20))
+	at.Equal(p.Header.(av.AudioPacketHeader).SoundFormat(), uint8(av.SOUND_AAC))
+
+	at.NoError(r.Read(&p))
+	at.Equal(p.TimeStamp, uint32(0x01000040))
+	at.False(p.Header.(av.VideoPacketHeader).IsKeyFrame())
+	at.Equal(p.Data, []byte{0x27, 0x01, 0x00, 0x00, 0x00, 0x02})
+
+	at.Equal(r.Read(&p), io.EOF)
+	at.Equal(r.Info().URL, "test.flv")
+}
+
+func TestReaderTruncated(t *testing.T) {
+	at := assert.New(t)
+
+	data := flvFile(
+		tag(av.TAG_AUDIO, 0, []byte{0xaf, 0x01, 0x21}),
+		tag(av.TAG_AUDIO, 20, []byte{0xaf, 0x01, 0x21}),
+	)
+	r, err := NewReader(bytes.NewReader(data[:len(data)-5]), av.Info{})
+	if !at.NoError(err) {
+		return
+	}
+
+	var p av.Packet
+	at.NoError(r.Read(&p))
+	// the tag is cut within its data
+	at.Equal(r.Read(&p), io.ErrUnexpectedEOF)
+
+	// a header cut short or with another signature is rejected
+	_, err = NewReader(bytes.NewReader(data[:5]), av.Info{})
+	at.Equal(err, io.ErrUnexpectedEOF)
+	_, err = NewReader(bytes.NewReader(append([]byte("FLX"), data[3:]...)), av.Info{})
+	at.Equal(err, ErrInvalidHeader)
+}
+
+func TestReaderInvalidTag(t *testing.T) {
+	at := assert.New(t)
+
+	for _, data := range [][]byte{
+		flvFile(tag(av.TAG_AUDIO, 0, []byte{0xaf})),
+		flvFile(tag(av.TAG_VIDEO, 0, []byte{0x17, 0x01, 0x00})),
+	} {
+		r, err := NewReader(bytes.NewReader(data), av.Info{})
+		if !at.NoError(err) {
+			return
+		}
+		var p av.Packet
+		at.Equal(r.Read(&p), ErrInvalidTag)
+	}
+
+	// other audio formats have a single byte header
+	r, err := NewReader(bytes.NewReader(flvFile(tag(av.TAG_AUDIO, 0, []byte{0x2f}))), av.Info{})
+	if !at.NoError(err) {
+		return
+	}
+	var p av.Packet
+	at.NoError(r.Read(&p))
+	at.Equal(p.Header.(av.AudioPacketHeader).SoundFormat(), uint8(2))
+}
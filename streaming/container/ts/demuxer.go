@@ -0,0 +1,261 @@
+package ts
+
+import (
+	"fmt"
+	"io"
+)
+
+const (
+	StreamTypeMP3  = 0x03
+	StreamTypeMP3b = 0x04
+	StreamTypeAAC  = 0x0f
+	StreamTypeH264 = 0x1b
+
+	patPID = 0x0000
+)
+
+var (
+	ErrSyncByte = fmt.Errorf("ts sync byte not found")
+)
+
+// Frame is a reassembled PES payload of a single elementary stream.
+type Frame struct {
+	PID        uint16
+	StreamType byte
+	// PTS and DTS are in 90kHz units.
+	PTS  int64
+	DTS  int64
+	Data []byte
+}
+
+func (f Frame) IsVideo() bool {
+	return f.StreamType == StreamTypeH264
+}
+
+func (f Frame) IsAudio() bool {
+	switch f.StreamType {
+	case StreamTypeAAC, StreamTypeMP3, StreamTypeMP3b:
+		return true
+	}
+	return false
+}
+
+type pesStream struct {
+	streamType byte
+	pts, dts   int64
+	started    bool
+	data       []byte
+	// cc is the continuity counter of the last packet, -1 before the first one.
+	cc int
+}
+
+// Demuxer reads MPEG-TS packets and returns the elementary stream frames of the first program.
+type Demuxer struct {
+	r       io.Reader
+	pkt     [tsPacketLen]byte
+	pmtPID  int
+	streams map[uint16]*pesStream
+	ready   []Frame
+	eof     bool
+	// ccErrors counts the packets lost according to the continuity counters.
+	ccErrors int
+}
+
+func NewDemuxer(r io.Reader) *Demuxer {
+	return &Demuxer{
+		r:       r,
+		pmtPID:  -1,
+		streams: map[uint16]*pesStream{},
+	}
+}
+
+// ContinuityErrors returns the number of continuity counter jumps, the frames they hit were dropped.
+func (d *Demuxer) ContinuityErrors() int {
+	return d.ccErrors
+}
+
+// ReadFrame returns the next complete frame, io.EOF is returned once every buffered frame was returned.
+func (d *Demuxer) ReadFrame() (Frame, error) {
+	for len(d.ready) == 0 {
+		if d.eof {
+			return Frame{}, io.EOF
+		}
+
+		if _, err := io.ReadFull(d.r, d.pkt[:]); err != nil {
+			if err != io.EOF && err != io.ErrUnexpectedEOF {
+				return Frame{}, err
+			}
+			d.eof = true
+			for pid, s := range d.streams {
+				d.flush(pid, s)
+			}
+			continue
+		}
+
+		if err := d.handlePacket(d.pkt[:]); err != nil {
+			return Frame{}, err
+		}
+	}
+
+	f := d.ready[0]
+	d.ready = d.ready[1:]
+	return f, nil
+}
+
+func (d *Demuxer) handlePacket(pkt []byte) error {
+	if pkt[0] != 0x47 {
+		return ErrSyncByte
+	}
+
+	start := pkt[1]&0x40 != 0
+	pid := uint16(pkt[1]&0x1f)<<8 | uint16(pkt[2])
+	adaptation := (pkt[3] >> 4) & 0x3
+	cc := int(pkt[3] & 0x0f)
+
+	payload := pkt[4:]
+	discontinuity := false
+	if adaptation&0x2 != 0 {
+		l := int(payload[0])
+		if l+1 > len(payload) {
+			return nil
+		}
+		discontinuity = l > 0 && payload[1]&0x80 != 0
+		payload = payload[l+1:]
+	}
+	if adaptation&0x1 == 0 || len(payload) == 0 {
+		return nil
+	}
+
+	switch {
+	case pid == patPID:
+		if start {
+			d.parsePAT(payload)
+		}
+	case int(pid) == d.pmtPID:
+		if start {
+			d.parsePMT(payload)
+		}
+	default:
+		s, ok := d.streams[pid]
+		if !ok {
+			return nil
+		}
+		if s.cc >= 0 && !discontinuity {
+			if cc == s.cc {
+				// a duplicate packet
+				return nil
+			}
+			if cc != (s.cc+1)&0x0f {
+				// the frame in progress misses data
+				d.ccErrors++
+				s.started = false
+				s.data = s.data[:0]
+			}
+		}
+		s.cc = cc
+		if start {
+			d.flush(pid, s)
+			d.parsePES(s, payload)
+		} else if s.started {
+			s.data = append(s.data, payload...)
+		}
+	}
+
+	return nil
+}
+
+// section returns the table section after the pointer field.
+func section(payload []byte) []byte {
+	pointer := int(payload[0])
+	if pointer+1 >= len(payload) {
+		return nil
+	}
+	b := payload[pointer+1:]
+	if len(b) < 3 {
+		return nil
+	}
+	l := int(b[1]&0x0f)<<8 | int(b[2])
+	if 3+l > len(b) || l < 9 {
+		return nil
+	}
+	// strip the crc
+	return b[:3+l-4]
+}
+
+func (d *Demuxer) parsePAT(payload []byte) {
+	b := section(payload)
+	if b == nil {
+		return
+	}
+	for i := 8; i+4 <= len(b); i += 4 {
+		program := uint16(b[i])<<8 | uint16(b[i+1])
+		if program == 0 {
+			continue
+		}
+		d.pmtPID = int(b[i+2]&0x1f)<<8 | int(b[i+3])
+		return
+	}
+}
+
+func (d *Demuxer) parsePMT(payload []byte) {
+	b := section(payload)
+	if b == nil || len(b) < 12 {
+		return
+	}
+	infoLen := int(b[10]&0x0f)<<8 | int(b[11])
+	for i := 12 + infoLen; i+5 <= len(b); {
+		streamType := b[i]
+		pid := uint16(b[i+1]&0x1f)<<8 | uint16(b[i+2])
+		esLen := int(b[i+3]&0x0f)<<8 | int(b[i+4])
+		if _, ok := d.streams[pid]; !ok {
+			d.streams[pid] = &pesStream{streamType: streamType, cc: -1}
+		}
+		i += 5 + esLen
+	}
+}
+
+func readTs(b []byte) int64 {
+	return int64(b[0]>>1&0x07)<<30 | int64(b[1])<<22 | int64(b[2]>>1)<<15 | int64(b[3])<<7 | int64(b[4]>>1)
+}
+
+func (d *Demuxer) parsePES(s *pesStream, payload []byte) {
+	if len(payload) < 9 || payload[0] != 0x00 || payload[1] != 0x00 || payload[2] != 0x01 {
+		return
+	}
+	flags := payload[7]
+	headerLen := int(payload[8])
+	if 9+headerLen > len(payload) {
+		return
+	}
+
+	s.pts, s.dts = 0, 0
+	if flags&0x80 != 0 && headerLen >= 5 {
+		s.pts = readTs(payload[9:])
+		s.dts = s.pts
+	}
+	if flags&0x40 != 0 && headerLen >= 10 {
+		s.dts = readTs(payload[14:])
+	}
+
+	s.started = true
+	s.data = append(s.data[:0], payload[9+headerLen:]...)
+}
+
+func (d *Demuxer) flush(pid uint16, s *pesStream) {
+	if !s.started || len(s.data) == 0 {
+		return
+	}
+
+	data := make([]byte, len(s.data))
+	copy(data, s.data)
+	d.ready = append(d.ready, Frame{
+		PID:        pid,
+		StreamType: s.streamType,
+		PTS:        s.pts,
+		DTS:        s.dts,
+		Data:       data,
+	})
+
+	s.started = false
+	s.data = s.data[:0]
+}
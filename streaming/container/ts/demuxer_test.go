@@ -0,0 +1,153 @@
+package ts
+
+import (
+	"bytes"
+	"io"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/viderstv/common/streaming/av"
+	"github.com/viderstv/common/streaming/container/flv"
+)
+
+// adts header for aac lc, 48khz, stereo with 2 bytes of payload
+var adtsFrame = []byte{0xff, 0xf1, 0x4c, 0x80, 0x01, 0x3f, 0xfc, 0x21, 0x19}
+
+func videoFrame(n int) []byte {
+	frame := []byte{0x00, 0x00, 0x00, 0x01, 0x65, 0x88}
+	return append(frame, bytes.Repeat([]byte{byte(n)}, 600)...)
+}
+
+// muxed returns a stream with the tables and frames video and audio frames, the packet offsets of every
+// video frame are returned as well.
+func muxed(t *testing.T, frames int) ([]byte, [][2]int) {
+	keyframe := &flv.Tag{}
+	if _, err := keyframe.ParseMediaTagHeader([]byte{0x17, 0x01, 0x00, 0x00, 0x00}, true); err != nil {
+		t.Fatal(err)
+	}
+
+	buf := &bytes.Buffer{}
+	m := NewMuxer()
+	buf.Write(m.PAT())
+	buf.Write(m.PMT(av.SOUND_AAC, true))
+
+	var offsets [][2]int
+	for i := 0; i < frames; i++ {
+		start := buf.Len()
+		if err := m.Mux(&av.Packet{IsVideo: true, Header: keyframe, TimeStamp: uint32(i * 40), Data: videoFrame(i)}, buf); err != nil {
+			t.Fatal(err)
+		}
+		offsets = append(offsets, [2]int{start, buf.Len()})
+		if err := m.Mux(&av.Packet{IsAudio: true, TimeStamp: uint32(i * 40), Data: adtsFrame}, buf); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return buf.Bytes(), offsets
+}
+
+func readAll(d *Demuxer) ([]Frame, error) {
+	var frames []Frame
+	for {
+		f, err := d.ReadFrame()
+		if err != nil {
+			return frames, err
+		}
+		frames = append(frames, f)
+	}
+}
+
+func videoFrames(frames []Frame) []Frame {
+	var ret []Frame
+	for _, f := range frames {
+		if f.IsVideo() {
+			ret = append(ret, f)
+		}
+	}
+	return ret
+}
+
+func TestDemuxer(t *testing.T) {
+	at := assert.New(t)
+
+	data, _ := muxed(t, 3)
+	d := NewDemuxer(bytes.NewReader(data))
+	frames, err := readAll(d)
+	at.Equal(err, io.EOF)
+	at.Len(frames, 6)
+
+	video := videoFrames(frames)
+	at.Len(video, 3)
+	for i, f := range video {
+		at.Equal(f.StreamType, byte(StreamTypeH264))
+		at.True(bytes.HasSuffix(f.Data, videoFrame(i)))
+		at.Equal(f.DTS-video[0].DTS, int64(i*40*90))
+	}
+	for _, f := range frames {
+		if f.IsAudio() {
+			at.Equal(f.StreamType, byte(StreamTypeAAC))
+			at.Equal(f.Data, adtsFrame)
+		}
+	}
+	at.Equal(d.ContinuityErrors(), 0)
+}
+
+func TestDemuxerTruncated(t *testing.T) {
+	at := assert.New(t)
+
+	data, offsets := muxed(t, 3)
+	// the stream ends in the middle of the packets of the last video frame
+	data = data[:offsets[2][0]+tsPacketLen+100]
+
+	frames, err := readAll(NewDemuxer(bytes.NewReader(data)))
+	at.Equal(err, io.EOF)
+	video := videoFrames(frames)
+	if at.Len(video, 3) {
+		at.True(bytes.HasSuffix(video[1].Data, videoFrame(1)))
+		// the partial frame is returned with what arrived
+		at.True(len(video[2].Data) < len(videoFrame(2)))
+	}
+
+	// a stream cut within the first packet has no frames
+	frames, err = readAll(NewDemuxer(bytes.NewReader(data[:100])))
+	at.Equal(err, io.EOF)
+	at.Empty(frames)
+}
+
+func TestDemuxerContinuity(t *testing.T) {
+	at := assert.New(t)
+
+	data, offsets := muxed(t, 3)
+	// lose the second packet of the second video frame
+	lost := offsets[1][0] + tsPacketLen
+	data = append(append([]byte(nil), data[:lost]...), data[lost+tsPacketLen:]...)
+
+	d := NewDemuxer(bytes.NewReader(data))
+	frames, err := readAll(d)
+	at.Equal(err, io.EOF)
+	at.Equal(d.ContinuityErrors(), 1)
+
+	// the damaged frame is dropped, the next one starts clean
+	video := videoFrames(frames)
+	if at.Len(video, 2) {
+		at.True(bytes.HasSuffix(video[0].Data, videoFrame(0)))
+		at.True(bytes.HasSuffix(video[1].Data, videoFrame(2)))
+	}
+
+	// duplicate packets are skipped
+	data, offsets = muxed(t, 2)
+	dup := offsets[0][0] + tsPacketLen
+	data = append(append(append([]byte(nil), data[:dup+tsPacketLen]...), data[dup:dup+tsPacketLen]...), data[dup+tsPacketLen:]...)
+	d = NewDemuxer(bytes.NewReader(data))
+	frames, err = readAll(d)
+	at.Equal(err, io.EOF)
+	at.Equal(d.ContinuityErrors(), 0)
+	at.True(bytes.HasSuffix(videoFrames(frames)[0].Data, videoFrame(0)))
+}
+
+func TestDemuxerSyncByte(t *testing.T) {
+	data, _ := muxed(t, 1)
+	data[tsPacketLen] = 0x00
+
+	_, err := readAll(NewDemuxer(bytes.NewReader(data)))
+	assert.Equal(t, err, ErrSyncByte)
+}
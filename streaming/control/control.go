@@ -0,0 +1,90 @@
+package control
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	"github.com/viderstv/common/instance"
+	"github.com/viderstv/common/structures"
+)
+
+var ErrStreamNotFound = fmt.Errorf("stream not found")
+
+// Target applies the commands, handler.RtmpHandler implements it.
+type Target interface {
+	StopStream(key string) bool
+	MuteAudio(key string, mute bool) bool
+	RequestKeyframe(key string) bool
+	UpdateTitle(key string, title string) bool
+}
+
+// Controller applies the structures.RedisRtmpEvent commands received over redis to the streams of a target.
+type Controller struct {
+	redis  instance.Redis
+	target Target
+	config Config
+}
+
+func New(redis instance.Redis, target Target, config Config) *Controller {
+	return &Controller{
+		redis:  redis,
+		target: target,
+		config: config.fill(),
+	}
+}
+
+// Run receives events until ctx is done, events for streams of other instances are ignored.
+func (c *Controller) Run(ctx context.Context) {
+	ch := make(chan string, 64)
+	c.redis.Subscribe(ctx, ch, c.config.Channel)
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case payload := <-ch:
+			var event structures.RedisRtmpEvent
+			if err := json.Unmarshal([]byte(payload), &event); err != nil {
+				c.config.Logger.Warn("invalid rtmp event: ", err)
+				continue
+			}
+			if err := c.Handle(event); err != nil && err != ErrStreamNotFound {
+				c.config.Logger.Warn("failed to handle rtmp event: ", err)
+			}
+		}
+	}
+}
+
+// Handle applies an event, ErrStreamNotFound if the target has no stream with its key.
+func (c *Controller) Handle(event structures.RedisRtmpEvent) error {
+	ok := true
+	switch event.Type {
+	case structures.RedisRtmpEventTypeKill:
+		if ok = c.target.StopStream(event.Key); ok {
+			c.config.OnKill(event.Key)
+		}
+	case structures.RedisRtmpEventTypeMuteAudio:
+		ok = c.target.MuteAudio(event.Key, event.Mute)
+	case structures.RedisRtmpEventTypeRequestKeyframe:
+		ok = c.target.RequestKeyframe(event.Key)
+	case structures.RedisRtmpEventTypeUpdateTitle:
+		ok = c.target.UpdateTitle(event.Key, event.Title)
+	default:
+		return fmt.Errorf("unknown rtmp event type %d", event.Type)
+	}
+	if !ok {
+		return ErrStreamNotFound
+	}
+
+	return nil
+}
+
+// Send publishes an event to the controllers listening on channel.
+func Send(ctx context.Context, redis instance.Redis, channel string, event structures.RedisRtmpEvent) error {
+	data, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+	return redis.Publish(ctx, channel, string(data))
+}
@@ -0,0 +1,75 @@
+package control
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/viderstv/common/streaming/internal/redistest"
+	"github.com/viderstv/common/structures"
+)
+
+type testTarget struct {
+	calls chan string
+}
+
+func (t *testTarget) StopStream(key string) bool {
+	if key == "missing" {
+		return false
+	}
+	t.calls <- "stop " + key
+	return true
+}
+func (t *testTarget) MuteAudio(key string, mute bool) bool {
+	if mute {
+		t.calls <- "mute " + key
+	} else {
+		t.calls <- "unmute " + key
+	}
+	return true
+}
+func (t *testTarget) RequestKeyframe(key string) bool { return false }
+func (t *testTarget) UpdateTitle(key string, title string) bool {
+	t.calls <- "title " + key + " " + title
+	return true
+}
+
+func TestController(t *testing.T) {
+	at := assert.New(t)
+
+	redis := redistest.New()
+	target := &testTarget{calls: make(chan string, 1)}
+	killed := make(chan string, 1)
+	c := New(redis, target, Config{OnKill: func(key string) { killed <- key }})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go c.Run(ctx)
+	<-redis.Subscribed()
+
+	next := func() string {
+		select {
+		case call := <-target.calls:
+			return call
+		case <-time.After(time.Second):
+			t.Fatal("event not handled")
+		}
+		return ""
+	}
+
+	at.NoError(Send(ctx, redis, DefaultChannel, structures.RedisRtmpEvent{Type: structures.RedisRtmpEventTypeMuteAudio, Key: "a", Mute: true}))
+	at.Equal(next(), "mute a")
+	at.NoError(Send(ctx, redis, DefaultChannel, structures.RedisRtmpEvent{Type: structures.RedisRtmpEventTypeUpdateTitle, Key: "a", Title: "new title"}))
+	at.Equal(next(), "title a new title")
+	at.NoError(Send(ctx, redis, DefaultChannel, structures.RedisRtmpEvent{Type: structures.RedisRtmpEventTypeKill, Key: "a"}))
+	at.Equal(next(), "stop a")
+	at.Equal(<-killed, "a")
+
+	// streams of other instances are not killed here
+	at.Equal(c.Handle(structures.RedisRtmpEvent{Type: structures.RedisRtmpEventTypeKill, Key: "missing"}), ErrStreamNotFound)
+	at.Len(killed, 0)
+
+	at.Equal(c.Handle(structures.RedisRtmpEvent{Type: structures.RedisRtmpEventTypeRequestKeyframe, Key: "a"}), ErrStreamNotFound)
+	at.Error(c.Handle(structures.RedisRtmpEvent{Type: 100}))
+}
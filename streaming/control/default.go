@@ -0,0 +1,36 @@
+package control
+
+import (
+	"github.com/sirupsen/logrus"
+)
+
+const DefaultChannel = "rtmp-events"
+
+type Config struct {
+	// Channel is the redis channel the events are received on.
+	Channel string
+	Logger  logrus.FieldLogger
+	// OnKill is called after a stream was stopped, to close outputs like HLS sources which are not viewers
+	// of the handler.
+	OnKill func(key string)
+}
+
+func (c Config) fill() Config {
+	if c.Channel == "" {
+		c.Channel = DefaultConfig.Channel
+	}
+	if c.Logger == nil {
+		c.Logger = DefaultConfig.Logger
+	}
+	if c.OnKill == nil {
+		c.OnKill = DefaultConfig.OnKill
+	}
+
+	return c
+}
+
+var DefaultConfig = Config{
+	Channel: DefaultChannel,
+	Logger:  logrus.StandardLogger(),
+	OnKill:  func(key string) {},
+}
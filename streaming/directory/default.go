@@ -0,0 +1,58 @@
+package directory
+
+import (
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/viderstv/common/streaming/av"
+)
+
+type Config struct {
+	// PodIP is recorded as the origin of the streams this pod owns.
+	PodIP string
+	// Prefix is prepended to the stream keys in redis.
+	Prefix string
+	// TTL is how long an ownership lasts without renewal, another pod can take over a stream after it.
+	TTL time.Duration
+	// RenewInterval is the time between two renewals, well below TTL.
+	RenewInterval time.Duration
+	// StreamKey maps a publisher to the key it owns, the stream name by default, which is the user id
+	// after authentication.
+	StreamKey func(info av.Info) string
+	// OnLost is called when this pod lost a stream it owned, the publisher should be stopped. It is not
+	// called for a lease taken over by a newer lease of this pod.
+	OnLost func(key string)
+	Logger logrus.FieldLogger
+}
+
+func (c Config) fill() Config {
+	if c.Prefix == "" {
+		c.Prefix = DefaultConfig.Prefix
+	}
+	if c.TTL <= 0 {
+		c.TTL = DefaultConfig.TTL
+	}
+	if c.RenewInterval <= 0 || c.RenewInterval >= c.TTL {
+		c.RenewInterval = c.TTL / 3
+	}
+	if c.StreamKey == nil {
+		c.StreamKey = DefaultConfig.StreamKey
+	}
+	if c.OnLost == nil {
+		c.OnLost = DefaultConfig.OnLost
+	}
+	if c.Logger == nil {
+		c.Logger = DefaultConfig.Logger
+	}
+
+	return c
+}
+
+var DefaultConfig = Config{
+	Prefix:        "stream-owner:",
+	TTL:           time.Second * 15,
+	RenewInterval: time.Second * 5,
+	StreamKey:     func(info av.Info) string { return info.Name },
+	OnLost:        func(key string) {},
+	Logger:        logrus.StandardLogger(),
+}
@@ -0,0 +1,221 @@
+package directory
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+	"github.com/viderstv/common/instance"
+	"github.com/viderstv/common/utils/uid"
+)
+
+var ErrNotFound = fmt.Errorf("stream has no owner")
+
+// Owner is stored as json for every owned stream key.
+type Owner struct {
+	PodIP string `json:"pod_ip"`
+	// Instance identifies the directory which owns the stream, a restarted pod with the same ip is another owner.
+	Instance string `json:"instance"`
+	// Lease identifies the publish session, a publisher reconnecting to the same pod takes over with a new lease.
+	Lease string    `json:"lease"`
+	Since time.Time `json:"since"`
+}
+
+// claimScript sets the owner in ARGV[1] unless another instance owns the key. A renewal, ARGV[4] set, also
+// fails once another lease of the same instance took over. The current owner is returned on failure.
+const claimScript = `
+local current = redis.call("GET", KEYS[1])
+if current then
+	local owner = cjson.decode(current)
+	if owner.instance ~= ARGV[2] or (ARGV[4] == "1" and owner.lease ~= ARGV[3]) then
+		return current
+	end
+end
+redis.call("SET", KEYS[1], ARGV[1], "PX", ARGV[5])
+return false
+`
+
+// releaseScript deletes the key if it is still owned by the lease in ARGV[1].
+const releaseScript = `
+local current = redis.call("GET", KEYS[1])
+if current and cjson.decode(current).lease == ARGV[1] then
+	return redis.call("DEL", KEYS[1])
+end
+return 0
+`
+
+var (
+	claim   = redis.NewScript(claimScript)
+	release = redis.NewScript(releaseScript)
+)
+
+// OwnedError is returned when another pod owns the stream.
+type OwnedError struct {
+	Owner Owner
+}
+
+func (e *OwnedError) Error() string {
+	return fmt.Sprintf("stream is owned by %s", e.Owner.PodIP)
+}
+
+// Directory records which ingest pod owns a stream key in redis. Owners renew their ownership while they
+// publish, once a pod stops renewing its streams expire and can be taken over by another pod.
+// Ownership is claimed, renewed and released per lease with lua scripts, so a lease never touches the
+// ownership of a newer one.
+type Directory struct {
+	redis    instance.Redis
+	scripter redis.Scripter
+	config   Config
+	instance string
+
+	publishers *publishers
+}
+
+func New(redis instance.Redis, config Config) *Directory {
+	return newDirectory(redis, redis.RawClient(), config)
+}
+
+func newDirectory(redis instance.Redis, scripter redis.Scripter, config Config) *Directory {
+	return &Directory{
+		redis:    redis,
+		scripter: scripter,
+		config:   config.fill(),
+		instance: uid.NewId(),
+
+		publishers: &publishers{publishers: map[string]*publisher{}},
+	}
+}
+
+func (d *Directory) redisKey(key string) string {
+	return d.config.Prefix + key
+}
+
+// Resolve returns the owner of a stream, ErrNotFound if it is not published.
+func (d *Directory) Resolve(ctx context.Context, key string) (Owner, error) {
+	v, err := d.redis.Get(ctx, d.redisKey(key))
+	if err == redis.Nil {
+		return Owner{}, ErrNotFound
+	}
+	if err != nil {
+		return Owner{}, err
+	}
+
+	var data []byte
+	switch v := v.(type) {
+	case string:
+		data = []byte(v)
+	case []byte:
+		data = v
+	default:
+		return Owner{}, fmt.Errorf("invalid owner %T", v)
+	}
+	return decodeOwner(data)
+}
+
+func decodeOwner(data []byte) (Owner, error) {
+	var owner Owner
+	if err := json.Unmarshal(data, &owner); err != nil {
+		return Owner{}, err
+	}
+	return owner, nil
+}
+
+// Watch sends the owner of a stream whenever it changes, a zero Owner while it has none, until ctx is done.
+// Viewers and muxers follow a failover to a new origin with it.
+func (d *Directory) Watch(ctx context.Context, key string) <-chan Owner {
+	ch := make(chan Owner, 1)
+	go func() {
+		defer close(ch)
+
+		ticker := time.NewTicker(d.config.RenewInterval)
+		defer ticker.Stop()
+
+		first := true
+		var last Owner
+		for {
+			owner, err := d.Resolve(ctx, key)
+			if err == nil || err == ErrNotFound {
+				if first || owner != last {
+					select {
+					case ch <- owner:
+					case <-ctx.Done():
+						return
+					}
+					first = false
+					last = owner
+				}
+			} else {
+				d.config.Logger.Warn("failed to resolve stream owner: ", err)
+			}
+
+			select {
+			case <-ticker.C:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	return ch
+}
+
+// Acquire takes the ownership of a stream, an *OwnedError if another pod owns it. A previous lease of this
+// pod for the stream is taken over. The returned lease is renewed until it is released.
+func (d *Directory) Acquire(ctx context.Context, key string) (*Lease, error) {
+	owner := Owner{
+		PodIP:    d.config.PodIP,
+		Instance: d.instance,
+		Lease:    uid.NewId(),
+		Since:    time.Now(),
+	}
+	if err := d.claim(ctx, key, owner, false); err != nil {
+		return nil, err
+	}
+
+	l := &Lease{
+		key:       key,
+		directory: d,
+		owner:     owner,
+		renewed:   time.Now(),
+		stop:      make(chan struct{}),
+		lost:      make(chan struct{}),
+		done:      make(chan struct{}),
+	}
+	go l.renew()
+	return l, nil
+}
+
+// claim sets the owner unless another instance owns the stream, or another lease when renewing.
+func (d *Directory) claim(ctx context.Context, key string, owner Owner, renew bool) error {
+	data, err := json.Marshal(owner)
+	if err != nil {
+		return err
+	}
+
+	renewArg := "0"
+	if renew {
+		renewArg = "1"
+	}
+	current, err := claim.Run(ctx, d.scripter, []string{d.redisKey(key)},
+		string(data), owner.Instance, owner.Lease, renewArg, d.config.TTL.Milliseconds(),
+	).Text()
+	if err == redis.Nil {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	taken, err := decodeOwner([]byte(current))
+	if err != nil {
+		return err
+	}
+	return &OwnedError{Owner: taken}
+}
+
+// release deletes the ownership if it is still held by the lease.
+func (d *Directory) release(ctx context.Context, key string, lease string) error {
+	return release.Run(ctx, d.scripter, []string{d.redisKey(key)}, lease).Err()
+}
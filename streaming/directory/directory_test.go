@@ -0,0 +1,264 @@
+package directory
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+	"github.com/stretchr/testify/assert"
+	"github.com/viderstv/common/streaming/av"
+	"github.com/viderstv/common/streaming/internal/avtest"
+	"github.com/viderstv/common/streaming/internal/redistest"
+	"github.com/viderstv/common/streaming/protocol/rtmp"
+	"github.com/viderstv/common/streaming/protocol/rtmp/core"
+	"github.com/viderstv/common/streaming/protocol/rtmp/handler"
+)
+
+// testRedis runs the scripts of the directory like redis would.
+type testRedis struct {
+	*redistest.Redis
+}
+
+func newTestRedis() *testRedis {
+	return &testRedis{Redis: redistest.New()}
+}
+
+func (r *testRedis) Eval(ctx context.Context, script string, keys []string, args ...interface{}) *redis.Cmd {
+	var cmd *redis.Cmd
+	r.Tx(func(tx redistest.Tx) {
+		current, ok := tx.Get(keys[0])
+		var owner Owner
+		if ok {
+			if err := json.Unmarshal([]byte(current), &owner); err != nil {
+				cmd = redis.NewCmdResult(nil, err)
+				return
+			}
+		}
+
+		switch script {
+		case claimScript:
+			if ok && (owner.Instance != args[1] || (args[3] == "1" && owner.Lease != args[2])) {
+				cmd = redis.NewCmdResult(current, nil)
+				return
+			}
+			tx.Set(keys[0], args[0].(string), time.Duration(args[4].(int64))*time.Millisecond)
+			cmd = redis.NewCmdResult(nil, redis.Nil)
+		case releaseScript:
+			if ok && owner.Lease == args[0] {
+				tx.Del(keys[0])
+				cmd = redis.NewCmdResult(int64(1), nil)
+				return
+			}
+			cmd = redis.NewCmdResult(int64(0), nil)
+		default:
+			cmd = redis.NewCmdResult(nil, fmt.Errorf("unknown script"))
+		}
+	})
+	return cmd
+}
+
+func (r *testRedis) EvalSha(ctx context.Context, sha1 string, keys []string, args ...interface{}) *redis.Cmd {
+	return redis.NewCmdResult(nil, fmt.Errorf("NOSCRIPT No matching script"))
+}
+
+func (r *testRedis) ScriptExists(ctx context.Context, hashes ...string) *redis.BoolSliceCmd {
+	return redis.NewBoolSliceResult(make([]bool, len(hashes)), nil)
+}
+
+func (r *testRedis) ScriptLoad(ctx context.Context, script string) *redis.StringCmd {
+	return redis.NewStringResult("", nil)
+}
+
+func newTestDirectory(r *testRedis, config Config) *Directory {
+	return newDirectory(r, r, config)
+}
+
+func TestDirectory(t *testing.T) {
+	at := assert.New(t)
+	ctx := context.Background()
+
+	r := newTestRedis()
+	config := Config{TTL: 100 * time.Millisecond, RenewInterval: 20 * time.Millisecond}
+	config.PodIP = "10.0.0.1"
+	a := newTestDirectory(r, config)
+	config.PodIP = "10.0.0.2"
+	b := newTestDirectory(r, config)
+
+	_, err := a.Resolve(ctx, "stream")
+	at.Equal(err, ErrNotFound)
+
+	lease, err := a.Acquire(ctx, "stream")
+	at.NoError(err)
+	// the lease is renewed past its ttl
+	time.Sleep(200 * time.Millisecond)
+	owner, err := b.Resolve(ctx, "stream")
+	at.NoError(err)
+	at.Equal(owner.PodIP, "10.0.0.1")
+
+	_, err = b.Acquire(ctx, "stream")
+	owned, ok := err.(*OwnedError)
+	at.True(ok)
+	at.Equal(owned.Owner.PodIP, "10.0.0.1")
+
+	// a released stream can be taken over right away
+	at.NoError(lease.Release(ctx))
+	lease, err = b.Acquire(ctx, "stream")
+	at.NoError(err)
+	defer lease.Release(ctx)
+	owner, err = a.Resolve(ctx, "stream")
+	at.NoError(err)
+	at.Equal(owner.PodIP, "10.0.0.2")
+}
+
+func TestDirectoryFailover(t *testing.T) {
+	at := assert.New(t)
+	ctx := context.Background()
+
+	r := newTestRedis()
+	lost := make(chan string, 1)
+	a := newTestDirectory(r, Config{PodIP: "10.0.0.1", TTL: 100 * time.Millisecond, RenewInterval: 20 * time.Millisecond, OnLost: func(key string) { lost <- key }})
+	b := newTestDirectory(r, Config{PodIP: "10.0.0.2", TTL: 100 * time.Millisecond, RenewInterval: 20 * time.Millisecond})
+
+	watchCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	owners := b.Watch(watchCtx, "stream")
+	at.Equal(<-owners, Owner{})
+
+	lease, err := a.Acquire(ctx, "stream")
+	at.NoError(err)
+	at.Equal((<-owners).PodIP, "10.0.0.1")
+
+	// pod a stalls, its ownership expires and pod b takes over
+	_ = r.Del(ctx, "stream-owner:stream")
+	takeover, err := b.Acquire(ctx, "stream")
+	at.NoError(err)
+	defer takeover.Release(ctx)
+
+	select {
+	case <-lease.Lost():
+	case <-time.After(time.Second):
+		t.Fatal("lease not lost")
+	}
+	at.Equal(<-lost, "stream")
+	for owner := range owners {
+		if owner.PodIP == "10.0.0.2" {
+			break
+		}
+	}
+}
+
+// rtmpDirectory wires the rtmp hooks of a directory to a handler like the ingest does.
+func rtmpDirectory(r *testRedis, ip string, duplicate handler.DuplicatePublish) rtmp.Config {
+	d := newTestDirectory(r, Config{PodIP: ip, TTL: 100 * time.Millisecond, RenewInterval: 20 * time.Millisecond})
+	h := handler.New(d.Handler(handler.Config{DuplicatePublish: duplicate}))
+	return d.RTMP(rtmp.Config{
+		HandlePublisher: func(info av.Info, reader av.ReadCloser) { h.HandleReader(reader) },
+	})
+}
+
+// publish authenticates and hands over a publisher like the rtmp server does.
+func publish(config rtmp.Config, info av.Info) (*avtest.Reader, error) {
+	if err := config.Authenticate(&info, nil); err != nil {
+		return nil, err
+	}
+	reader := avtest.NewReader(info)
+	config.HandlePublisher(info, reader)
+	return reader, nil
+}
+
+func TestDirectoryRTMP(t *testing.T) {
+	at := assert.New(t)
+
+	r := newTestRedis()
+	a := rtmpDirectory(r, "10.0.0.1", handler.ReplaceOld)
+	b := rtmpDirectory(r, "10.0.0.2", handler.ReplaceOld)
+
+	first := av.Info{ID: "1", Key: "user", Name: "user", Publisher: true}
+	_, err := publish(a, first)
+	at.NoError(err)
+	second := av.Info{ID: "2", Key: "user", Name: "user", Publisher: true}
+	_, err = publish(b, second)
+	status, ok := err.(*core.StatusError)
+	at.True(ok)
+	at.Equal(status.Code, core.StatusPublishBadName)
+	// viewers do not own streams
+	at.NoError(b.Authenticate(&av.Info{ID: "3", Name: "user"}, nil))
+
+	a.OnStreamClose(first, nil)
+	reader, err := publish(b, second)
+	at.NoError(err)
+	_ = reader.Close()
+	b.OnStreamClose(second, nil)
+}
+
+func TestDirectoryRejectNew(t *testing.T) {
+	at := assert.New(t)
+	ctx := context.Background()
+
+	r := newTestRedis()
+	config := rtmpDirectory(r, "10.0.0.1", handler.RejectNew)
+
+	live, err := publish(config, av.Info{ID: "1", Key: "user", Name: "user", Publisher: true})
+	at.NoError(err)
+	owner, err := newTestDirectory(r, Config{}).Resolve(ctx, "user")
+	at.NoError(err)
+
+	// the duplicate passes authentication on the same pod, the handler rejects it
+	duplicate, err := publish(config, av.Info{ID: "2", Key: "user", Name: "user", Publisher: true})
+	at.NoError(err)
+	at.True(duplicate.Closed())
+	config.OnStreamClose(duplicate.Info(), nil)
+
+	// the live publisher keeps its lease
+	time.Sleep(50 * time.Millisecond)
+	at.False(live.Closed())
+	current, err := newTestDirectory(r, Config{}).Resolve(ctx, "user")
+	at.NoError(err)
+	at.Equal(current.Lease, owner.Lease)
+
+	_ = live.Close()
+	config.OnStreamClose(live.Info(), nil)
+	_, err = newTestDirectory(r, Config{}).Resolve(ctx, "user")
+	at.Equal(err, ErrNotFound)
+}
+
+func TestDirectoryReconnect(t *testing.T) {
+	at := assert.New(t)
+	ctx := context.Background()
+
+	r := newTestRedis()
+	lost := make(chan string, 1)
+	d := newTestDirectory(r, Config{PodIP: "10.0.0.1", TTL: 100 * time.Millisecond, RenewInterval: 20 * time.Millisecond, OnLost: func(key string) { lost <- key }})
+
+	old, err := d.Acquire(ctx, "stream")
+	at.NoError(err)
+
+	// the publisher reconnects to the same pod before its old connection closed
+	lease, err := d.Acquire(ctx, "stream")
+	at.NoError(err)
+	defer lease.Release(ctx)
+
+	select {
+	case <-old.Lost():
+	case <-time.After(time.Second):
+		t.Fatal("old lease not lost")
+	}
+	// the pod still owns the stream
+	at.Len(lost, 0)
+
+	// releasing the old lease keeps the new one
+	at.NoError(old.Release(ctx))
+	owner, err := d.Resolve(ctx, "stream")
+	at.NoError(err)
+	at.Equal(owner.Lease, lease.owner.Lease)
+
+	time.Sleep(50 * time.Millisecond)
+	select {
+	case <-lease.Lost():
+		t.Fatal("new lease lost")
+	default:
+	}
+}
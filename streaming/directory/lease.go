@@ -0,0 +1,88 @@
+package directory
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// Lease is the ownership of a stream, renewed in the background.
+type Lease struct {
+	key       string
+	directory *Directory
+	owner     Owner
+	renewed   time.Time
+
+	once sync.Once
+	stop chan struct{}
+	lost chan struct{}
+	done chan struct{}
+}
+
+func (l *Lease) Key() string {
+	return l.key
+}
+
+// Lost is closed when the ownership was taken over or could not be renewed within the ttl.
+func (l *Lease) Lost() <-chan struct{} {
+	return l.lost
+}
+
+func (l *Lease) renew() {
+	defer close(l.done)
+
+	config := l.directory.config
+	ticker := time.NewTicker(config.RenewInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-l.stop:
+			return
+		case <-ticker.C:
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), config.RenewInterval)
+		err := l.directory.claim(ctx, l.key, l.owner, true)
+		cancel()
+		switch err.(type) {
+		case nil:
+			l.renewed = time.Now()
+			continue
+		case *OwnedError:
+			if err.(*OwnedError).Owner.Instance == l.directory.instance {
+				// a newer publisher on this pod took over, it still owns the stream.
+				close(l.lost)
+				return
+			}
+			config.Logger.Warnf("stream %s was taken over: %v", l.key, err)
+		default:
+			if time.Since(l.renewed) < config.TTL {
+				config.Logger.Warn("failed to renew stream ownership: ", err)
+				continue
+			}
+			config.Logger.Errorf("stream %s ownership expired: %v", l.key, err)
+		}
+
+		close(l.lost)
+		config.OnLost(l.key)
+		return
+	}
+}
+
+// Release stops renewing and removes the ownership if this lease still holds it, so another pod can take
+// over without waiting for the ttl.
+func (l *Lease) Release(ctx context.Context) error {
+	l.once.Do(func() {
+		close(l.stop)
+	})
+	<-l.done
+
+	select {
+	case <-l.lost:
+		return nil
+	default:
+	}
+
+	return l.directory.release(ctx, l.key, l.owner.Lease)
+}
@@ -0,0 +1,197 @@
+package directory
+
+import (
+	"context"
+	"net"
+	"sync"
+
+	"github.com/viderstv/common/streaming/av"
+	"github.com/viderstv/common/streaming/protocol/rtmp"
+	"github.com/viderstv/common/streaming/protocol/rtmp/core"
+	"github.com/viderstv/common/streaming/protocol/rtmp/handler"
+)
+
+// publisher is an rtmp publisher, its lease is set once the handler accepted it.
+type publisher struct {
+	reader av.ReadCloser
+	lease  *Lease
+}
+
+type publishers struct {
+	mtx        sync.Mutex
+	publishers map[string]*publisher
+}
+
+func (p *publishers) add(id string, reader av.ReadCloser) {
+	p.mtx.Lock()
+	p.publishers[id] = &publisher{reader: reader}
+	p.mtx.Unlock()
+}
+
+func (p *publishers) get(id string) av.ReadCloser {
+	p.mtx.Lock()
+	defer p.mtx.Unlock()
+	if pub := p.publishers[id]; pub != nil {
+		return pub.reader
+	}
+	return nil
+}
+
+// setLease returns false when the publisher closed in the meantime.
+func (p *publishers) setLease(id string, lease *Lease) bool {
+	p.mtx.Lock()
+	defer p.mtx.Unlock()
+	pub := p.publishers[id]
+	if pub == nil {
+		return false
+	}
+	pub.lease = lease
+	return true
+}
+
+func (p *publishers) takeLease(id string) *Lease {
+	p.mtx.Lock()
+	defer p.mtx.Unlock()
+	pub := p.publishers[id]
+	if pub == nil {
+		return nil
+	}
+	lease := pub.lease
+	pub.lease = nil
+	return lease
+}
+
+func (p *publishers) remove(id string) *Lease {
+	p.mtx.Lock()
+	defer p.mtx.Unlock()
+	pub := p.publishers[id]
+	if pub == nil {
+		return nil
+	}
+	delete(p.publishers, id)
+	return pub.lease
+}
+
+func (d *Directory) releaseLease(lease *Lease) {
+	ctx, cancel := context.WithTimeout(context.Background(), d.config.RenewInterval)
+	defer cancel()
+	if err := lease.Release(ctx); err != nil {
+		d.config.Logger.Warn("failed to release stream ownership: ", err)
+	}
+}
+
+// RTMP returns config with publishers of a stream owned by another pod rejected with
+// NetStream.Publish.BadName after they authenticated. The ownership itself is taken by Handler once the
+// handler accepted the publisher, so a duplicate it rejects never touches the lease of the live one.
+// The callbacks already set are still called.
+func (d *Directory) RTMP(config rtmp.Config) rtmp.Config {
+	authenticate := config.Authenticate
+	if authenticate == nil && config.AuthStream != nil {
+		authStream := config.AuthStream
+		authenticate = func(info *av.Info, addr net.Addr) error {
+			if authStream(info, addr) {
+				return nil
+			}
+			if info.Publisher {
+				return core.NewStatusError(core.StatusPublishUnauthorized, "Invalid stream key.")
+			}
+			return core.NewStatusError(core.StatusPlayStreamNotFound, "Stream not found.")
+		}
+	}
+	config.Authenticate = func(info *av.Info, addr net.Addr) error {
+		if authenticate != nil {
+			if err := authenticate(info, addr); err != nil {
+				return err
+			}
+		}
+		if !info.Publisher {
+			return nil
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), d.config.RenewInterval)
+		defer cancel()
+		owner, err := d.Resolve(ctx, d.config.StreamKey(*info))
+		if err == ErrNotFound {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if owner.Instance != d.instance {
+			return core.NewStatusError(core.StatusPublishBadName, "Stream is already publishing.")
+		}
+		return nil
+	}
+
+	handlePublisher := config.HandlePublisher
+	config.HandlePublisher = func(info av.Info, reader av.ReadCloser) {
+		d.publishers.add(info.ID, reader)
+		if handlePublisher != nil {
+			handlePublisher(info, reader)
+		}
+	}
+
+	onStreamClose := config.OnStreamClose
+	config.OnStreamClose = func(info av.Info, addr net.Addr) {
+		if lease := d.publishers.remove(info.ID); lease != nil {
+			d.releaseLease(lease)
+		}
+		if onStreamClose != nil {
+			onStreamClose(info, addr)
+		}
+	}
+
+	return config
+}
+
+// Handler returns config with the rtmp publishers of RTMP taking the ownership of their stream when they
+// become its publisher, a stream another pod took in the meantime closes the publisher. Publishers are
+// closed when the ownership is lost and release it when they detach. The callbacks already set are still
+// called.
+func (d *Directory) Handler(config handler.Config) handler.Config {
+	onPublish := config.OnPublish
+	config.OnPublish = func(info av.Info) {
+		if reader := d.publishers.get(info.ID); reader != nil {
+			d.acquire(info, reader)
+		}
+		if onPublish != nil {
+			onPublish(info)
+		}
+	}
+
+	onUnpublish := config.OnUnpublish
+	config.OnUnpublish = func(info av.Info) {
+		if lease := d.publishers.takeLease(info.ID); lease != nil {
+			d.releaseLease(lease)
+		}
+		if onUnpublish != nil {
+			onUnpublish(info)
+		}
+	}
+
+	return config
+}
+
+// acquire takes the ownership for an accepted publisher, a previous lease of this pod is taken over.
+func (d *Directory) acquire(info av.Info, reader av.ReadCloser) {
+	ctx, cancel := context.WithTimeout(context.Background(), d.config.RenewInterval)
+	defer cancel()
+	lease, err := d.Acquire(ctx, d.config.StreamKey(info))
+	if err != nil {
+		d.config.Logger.Warn("failed to take stream ownership: ", err)
+		_ = reader.Close()
+		return
+	}
+	if !d.publishers.setLease(info.ID, lease) {
+		d.releaseLease(lease)
+		return
+	}
+
+	go func() {
+		select {
+		case <-lease.Lost():
+			_ = reader.Close()
+		case <-reader.Running():
+		}
+	}()
+}
@@ -0,0 +1,36 @@
+package events
+
+import (
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+type Config struct {
+	Transports []Transport
+	Logger     logrus.FieldLogger
+	// QueueSize is the number of events buffered while the transports are slow, further events are dropped.
+	QueueSize int
+	// SendTimeout limits sending an event over one transport.
+	SendTimeout time.Duration
+}
+
+func (c Config) fill() Config {
+	if c.Logger == nil {
+		c.Logger = DefaultConfig.Logger
+	}
+	if c.QueueSize <= 0 {
+		c.QueueSize = DefaultConfig.QueueSize
+	}
+	if c.SendTimeout <= 0 {
+		c.SendTimeout = DefaultConfig.SendTimeout
+	}
+
+	return c
+}
+
+var DefaultConfig = Config{
+	Logger:      logrus.StandardLogger(),
+	QueueSize:   1024,
+	SendTimeout: time.Second * 5,
+}
@@ -0,0 +1,102 @@
+package events
+
+import (
+	"context"
+	"encoding/json"
+	"sync"
+	"time"
+
+	"github.com/viderstv/common/structures"
+)
+
+// Emitter sends events over its transports in the background, in the order they were emitted.
+type Emitter struct {
+	config Config
+	queue  chan structures.StreamEvent
+	once   sync.Once
+	done   chan struct{}
+	// closed is guarded by closeMtx, late events of a closing server are dropped instead of sent on the closed queue.
+	closeMtx sync.RWMutex
+	closed   bool
+
+	// active holds the ids of the publishers and viewers which started, so only those are reported as ended.
+	activeMtx sync.Mutex
+	active    map[string]bool
+}
+
+func New(config Config) *Emitter {
+	config = config.fill()
+	e := &Emitter{
+		config: config,
+		queue:  make(chan structures.StreamEvent, config.QueueSize),
+		done:   make(chan struct{}),
+		active: map[string]bool{},
+	}
+	go e.run()
+	return e
+}
+
+// Emit queues an event, it is dropped when the queue is full or the emitter is closed.
+func (e *Emitter) Emit(event structures.StreamEvent) {
+	if event.Timestamp.IsZero() {
+		event.Timestamp = time.Now()
+	}
+
+	e.closeMtx.RLock()
+	defer e.closeMtx.RUnlock()
+	if e.closed {
+		return
+	}
+
+	select {
+	case e.queue <- event:
+	default:
+		e.config.Logger.Warn("event queue full, dropping event: ", event.Type)
+	}
+}
+
+// Close sends the queued events and stops the emitter, events emitted afterwards are dropped.
+func (e *Emitter) Close() {
+	e.once.Do(func() {
+		e.closeMtx.Lock()
+		e.closed = true
+		close(e.queue)
+		e.closeMtx.Unlock()
+	})
+	<-e.done
+}
+
+func (e *Emitter) run() {
+	defer close(e.done)
+
+	for event := range e.queue {
+		data, err := json.Marshal(event)
+		if err != nil {
+			e.config.Logger.Error("failed to marshal event: ", err)
+			continue
+		}
+
+		for _, t := range e.config.Transports {
+			ctx, cancel := context.WithTimeout(context.Background(), e.config.SendTimeout)
+			if err := t.Send(ctx, event, data); err != nil {
+				e.config.Logger.Error("failed to send event: ", err)
+			}
+			cancel()
+		}
+	}
+}
+
+func (e *Emitter) start(id string) {
+	e.activeMtx.Lock()
+	e.active[id] = true
+	e.activeMtx.Unlock()
+}
+
+func (e *Emitter) end(id string) bool {
+	e.activeMtx.Lock()
+	defer e.activeMtx.Unlock()
+
+	ok := e.active[id]
+	delete(e.active, id)
+	return ok
+}
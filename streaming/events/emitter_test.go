@@ -0,0 +1,123 @@
+package events
+
+import (
+	"context"
+	"encoding/json"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/viderstv/common/streaming/av"
+	"github.com/viderstv/common/streaming/health"
+	"github.com/viderstv/common/streaming/internal/avtest"
+	"github.com/viderstv/common/streaming/protocol/hls"
+	"github.com/viderstv/common/streaming/protocol/hls/item"
+	"github.com/viderstv/common/streaming/protocol/rtmp"
+	"github.com/viderstv/common/streaming/protocol/rtmp/handler"
+	"github.com/viderstv/common/structures"
+)
+
+type testTransport struct {
+	events []structures.StreamEvent
+}
+
+func (t *testTransport) Send(ctx context.Context, event structures.StreamEvent, data []byte) error {
+	var decoded structures.StreamEvent
+	if err := json.Unmarshal(data, &decoded); err != nil {
+		return err
+	}
+	t.events = append(t.events, decoded)
+	return nil
+}
+
+func TestEmitterRTMP(t *testing.T) {
+	at := assert.New(t)
+
+	transport := &testTransport{}
+	e := New(Config{Transports: []Transport{transport}})
+
+	closed := 0
+	config := e.RTMP(rtmp.Config{
+		OnStreamClose: func(info av.Info, addr net.Addr) { closed++ },
+	})
+	unpublished := make(chan struct{}, 1)
+	h := handler.New(e.Handler(handler.Config{
+		DuplicatePublish: handler.RejectNew,
+		OnUnpublish:      func(publisher av.Info) { unpublished <- struct{}{} },
+	}))
+
+	publisher := avtest.NewReader(av.Info{ID: "p", Key: "key", App: "live", Name: "user", Publisher: true})
+	viewer := av.Info{ID: "v", Key: "key", App: "live", Name: "user"}
+	h.HandleReader(publisher)
+	config.HandleViewer(viewer, nil)
+
+	// a duplicate publisher is rejected by the handler and never reported
+	duplicate := avtest.NewReader(av.Info{ID: "d", Key: "key", App: "live", Name: "user", Publisher: true})
+	h.HandleReader(duplicate)
+	at.True(duplicate.Closed())
+	config.OnStreamClose(duplicate.Info(), nil)
+
+	config.OnStreamClose(viewer, nil)
+	_ = publisher.Close()
+	select {
+	case <-unpublished:
+	case <-time.After(time.Second):
+		t.Fatal("publisher not detached")
+	}
+	config.OnStreamClose(publisher.Info(), nil)
+	// a connection which never started a stream
+	config.OnStreamClose(av.Info{ID: "c"}, nil)
+	e.Close()
+
+	at.Equal(closed, 4)
+	var types []structures.StreamEventType
+	for _, event := range transport.events {
+		types = append(types, event.Type)
+		at.Equal(event.Name, "user")
+		at.False(event.Timestamp.IsZero())
+		at.NotEqual(event.ConnID, "d")
+	}
+	at.Equal(types, []structures.StreamEventType{
+		structures.StreamEventTypePublishStarted,
+		structures.StreamEventTypeViewerJoined,
+		structures.StreamEventTypeViewerLeft,
+		structures.StreamEventTypePublishEnded,
+	})
+	at.Equal(transport.events[2].ConnID, "v")
+}
+
+func TestEmitterHLSAndHealth(t *testing.T) {
+	at := assert.New(t)
+
+	transport := &testTransport{}
+	e := New(Config{Transports: []Transport{transport}})
+
+	segment := item.New("1.ts", 1)
+	segment.SetDuration(2 * time.Second)
+	segment.SetDiscontinuity(true, 1)
+	e.HLS(hls.Config{}).OnSegment(av.Info{Key: "key", Name: "user"}, segment)
+	e.Health(health.Config{}).OnWarning(health.Report{Key: "key", Name: "user"}, health.Warning{Type: health.WarningLowFPS, Value: 10, Limit: 20})
+	e.Close()
+
+	at.Len(transport.events, 2)
+	at.Equal(transport.events[0].Type, structures.StreamEventTypeSegmentProduced)
+	at.Equal(*transport.events[0].Segment, structures.StreamEventSegment{SeqNum: 1, Name: "1.ts", Duration: 2 * time.Second, Discontinuity: true})
+	at.Equal(transport.events[1].Type, structures.StreamEventTypeHealthWarning)
+	at.Equal(*transport.events[1].Health, structures.StreamEventHealth{Type: "low_fps", Value: 10, Limit: 20})
+}
+
+func TestEmitterClosed(t *testing.T) {
+	at := assert.New(t)
+
+	transport := &testTransport{}
+	e := New(Config{Transports: []Transport{transport}})
+	e.Close()
+
+	// streams closing during shutdown still report, their events are dropped
+	at.NotPanics(func() {
+		e.Emit(structures.StreamEvent{Type: structures.StreamEventTypePublishEnded})
+	})
+	e.Close()
+	at.Empty(transport.events)
+}
@@ -0,0 +1,120 @@
+package events
+
+import (
+	"net"
+
+	"github.com/viderstv/common/streaming/av"
+	"github.com/viderstv/common/streaming/health"
+	"github.com/viderstv/common/streaming/protocol/hls"
+	"github.com/viderstv/common/streaming/protocol/hls/item"
+	"github.com/viderstv/common/streaming/protocol/rtmp"
+	"github.com/viderstv/common/streaming/protocol/rtmp/handler"
+	"github.com/viderstv/common/structures"
+)
+
+func newEvent(t structures.StreamEventType, info av.Info) structures.StreamEvent {
+	return structures.StreamEvent{
+		Type:   t,
+		Key:    info.Key,
+		App:    info.App,
+		Name:   info.Name,
+		ConnID: info.ID,
+	}
+}
+
+// RTMP returns config with its viewer and close callbacks also emitting events, the callbacks already set
+// are still called. Publishers are reported by Handler, the rtmp server hands them over before the handler
+// decides whether they become the publisher of their stream.
+func (e *Emitter) RTMP(config rtmp.Config) rtmp.Config {
+	handleViewer := config.HandleViewer
+	config.HandleViewer = func(info av.Info, writer av.WriteCloser) {
+		e.start(info.ID)
+		e.Emit(newEvent(structures.StreamEventTypeViewerJoined, info))
+		if handleViewer != nil {
+			handleViewer(info, writer)
+		}
+	}
+
+	onStreamClose := config.OnStreamClose
+	config.OnStreamClose = func(info av.Info, addr net.Addr) {
+		// connections which were rejected or never started a stream are not reported.
+		if !info.Publisher && e.end(info.ID) {
+			e.Emit(newEvent(structures.StreamEventTypeViewerLeft, info))
+		}
+		if onStreamClose != nil {
+			onStreamClose(info, addr)
+		}
+	}
+
+	return config
+}
+
+// Handler returns config with its publish callbacks also emitting events, the callbacks already set are
+// still called. Publishers rejected as duplicates never attach to a stream and are not reported.
+func (e *Emitter) Handler(config handler.Config) handler.Config {
+	onPublish := config.OnPublish
+	config.OnPublish = func(publisher av.Info) {
+		e.start(publisher.ID)
+		e.Emit(newEvent(structures.StreamEventTypePublishStarted, publisher))
+		if onPublish != nil {
+			onPublish(publisher)
+		}
+	}
+
+	onUnpublish := config.OnUnpublish
+	config.OnUnpublish = func(publisher av.Info) {
+		if e.end(publisher.ID) {
+			e.Emit(newEvent(structures.StreamEventTypePublishEnded, publisher))
+		}
+		if onUnpublish != nil {
+			onUnpublish(publisher)
+		}
+	}
+
+	return config
+}
+
+// HLS returns config with its segment callback also emitting events.
+func (e *Emitter) HLS(config hls.Config) hls.Config {
+	onSegment := config.OnSegment
+	config.OnSegment = func(info av.Info, segment *item.Item) {
+		event := newEvent(structures.StreamEventTypeSegmentProduced, info)
+		event.Segment = &structures.StreamEventSegment{
+			SeqNum:        segment.SeqNum(),
+			Name:          segment.Name(),
+			Duration:      segment.Duration(),
+			Size:          segment.Size(),
+			Discontinuity: segment.Discontinuity(),
+		}
+		e.Emit(event)
+		if onSegment != nil {
+			onSegment(info, segment)
+		}
+	}
+
+	return config
+}
+
+// Health returns config with its warning callback also emitting events.
+func (e *Emitter) Health(config health.Config) health.Config {
+	onWarning := config.OnWarning
+	config.OnWarning = func(report health.Report, warning health.Warning) {
+		e.Emit(structures.StreamEvent{
+			Type: structures.StreamEventTypeHealthWarning,
+			Key:  report.Key,
+			App:  report.App,
+			Name: report.Name,
+			Health: &structures.StreamEventHealth{
+				Type:    string(warning.Type),
+				Message: warning.Message,
+				Value:   warning.Value,
+				Limit:   warning.Limit,
+			},
+		})
+		if onWarning != nil {
+			onWarning(report, warning)
+		}
+	}
+
+	return config
+}
@@ -0,0 +1,67 @@
+package events
+
+import (
+	"context"
+
+	"github.com/streadway/amqp"
+	"github.com/viderstv/common/instance"
+	"github.com/viderstv/common/structures"
+)
+
+const (
+	DefaultRedisChannel = "stream-events"
+	DefaultRabbitMQKey  = "stream-events"
+)
+
+// Transport delivers an event encoded as json.
+type Transport interface {
+	Send(ctx context.Context, event structures.StreamEvent, data []byte) error
+}
+
+// RedisTransport publishes events to a redis channel.
+type RedisTransport struct {
+	redis instance.Redis
+	// Channel selects the channel of an event, DefaultRedisChannel for all events by default.
+	Channel func(event structures.StreamEvent) string
+}
+
+func NewRedisTransport(redis instance.Redis) *RedisTransport {
+	return &RedisTransport{
+		redis: redis,
+		Channel: func(event structures.StreamEvent) string {
+			return DefaultRedisChannel
+		},
+	}
+}
+
+func (t *RedisTransport) Send(ctx context.Context, event structures.StreamEvent, data []byte) error {
+	return t.redis.Publish(ctx, t.Channel(event), string(data))
+}
+
+// RabbitMQTransport publishes events as persistent messages to an exchange.
+type RabbitMQTransport struct {
+	rmq instance.RabbitMQ
+	// Exchange is the default exchange by default, which routes to the queue named by the routing key.
+	Exchange string
+	// RoutingKey selects the routing key of an event, DefaultRabbitMQKey for all events by default.
+	RoutingKey func(event structures.StreamEvent) string
+}
+
+func NewRabbitMQTransport(rmq instance.RabbitMQ) *RabbitMQTransport {
+	return &RabbitMQTransport{
+		rmq: rmq,
+		RoutingKey: func(event structures.StreamEvent) string {
+			return DefaultRabbitMQKey
+		},
+	}
+}
+
+func (t *RabbitMQTransport) Send(ctx context.Context, event structures.StreamEvent, data []byte) error {
+	return t.rmq.RawChannel().Publish(t.Exchange, t.RoutingKey(event), false, false, amqp.Publishing{
+		ContentType:  "application/json",
+		DeliveryMode: amqp.Persistent,
+		Timestamp:    event.Timestamp,
+		Type:         event.Type.String(),
+		Body:         data,
+	})
+}
@@ -0,0 +1,287 @@
+package health
+
+import (
+	"fmt"
+	"math"
+	"sync"
+	"time"
+
+	"github.com/viderstv/common/streaming/av"
+)
+
+type WarningType string
+
+const (
+	WarningKeyframeInterval WarningType = "keyframe_interval"
+	WarningLowFPS           WarningType = "low_fps"
+	WarningHighFPS          WarningType = "high_fps"
+	WarningLowVideoBitrate  WarningType = "low_video_bitrate"
+	WarningHighVideoBitrate WarningType = "high_video_bitrate"
+	WarningHighAudioBitrate WarningType = "high_audio_bitrate"
+	WarningJitter           WarningType = "timestamp_jitter"
+)
+
+type Warning struct {
+	Type    WarningType `json:"type"`
+	Message string      `json:"message"`
+	// Value and Limit are in the unit of the stat, seconds for durations.
+	Value float64 `json:"value"`
+	Limit float64 `json:"limit"`
+}
+
+// Stats are measured over the window of the analyzer, durations are in nanoseconds in json.
+type Stats struct {
+	// KeyframeInterval is the longest time between keyframes, including the time since the last one.
+	KeyframeInterval time.Duration `json:"keyframe_interval"`
+	VideoBitrate     float64       `json:"video_bitrate"`
+	AudioBitrate     float64       `json:"audio_bitrate"`
+	FPS              float64       `json:"fps"`
+	Jitter           time.Duration `json:"jitter"`
+}
+
+// Report is the result of a check of the stats against the policy.
+type Report struct {
+	Key       string    `json:"key"`
+	App       string    `json:"app"`
+	Name      string    `json:"name"`
+	Healthy   bool      `json:"healthy"`
+	Stats     Stats     `json:"stats"`
+	Warnings  []Warning `json:"warnings"`
+	Timestamp time.Time `json:"timestamp"`
+}
+
+type sample struct {
+	timestamp uint32
+	bytes     int
+	video     bool
+	keyframe  bool
+}
+
+// Analyzer measures the packets of a publisher and checks them against the policy every check interval
+// of media time.
+type Analyzer struct {
+	info   av.Info
+	config Config
+
+	samples   []sample
+	started   bool
+	lastCheck uint32
+	// lastVideo and lastAudio are the timestamps of the last packet of each track, -1 before the first.
+	lastVideo int64
+	lastAudio int64
+	raised    map[WarningType]bool
+	last      Report
+
+	mtx sync.Mutex
+}
+
+func NewAnalyzer(info av.Info, config Config) *Analyzer {
+	return &Analyzer{
+		info:      info,
+		config:    config.fill(),
+		raised:    map[WarningType]bool{},
+		lastVideo: -1,
+		lastAudio: -1,
+	}
+}
+
+func (a *Analyzer) Observe(p *av.Packet) {
+	if p.IsMetadata {
+		return
+	}
+	s := sample{timestamp: p.TimeStamp, bytes: len(p.Data)}
+	if p.IsVideo {
+		vh, ok := p.Header.(av.VideoPacketHeader)
+		if !ok || vh.IsSeq() {
+			return
+		}
+		s.video = true
+		s.keyframe = vh.IsKeyFrame()
+	} else if ah, ok := p.Header.(av.AudioPacketHeader); ok && ah.SoundFormat() == av.SOUND_AAC && ah.AACPacketType() == av.AAC_SEQHDR {
+		return
+	}
+
+	a.mtx.Lock()
+	last := &a.lastAudio
+	if s.video {
+		last = &a.lastVideo
+	}
+	// a track going back in time restarted its timestamps without flagging a discontinuity
+	if p.Discontinuity || !a.started || int64(p.TimeStamp) < *last {
+		a.samples = a.samples[:0]
+		a.started = true
+		a.lastCheck = p.TimeStamp
+		a.lastVideo = -1
+		a.lastAudio = -1
+	}
+	*last = int64(p.TimeStamp)
+	a.samples = append(a.samples, s)
+	i := 0
+	// the tracks interleave, an older sample of the other track can follow a newer one
+	for time.Duration(int64(p.TimeStamp)-int64(a.samples[i].timestamp))*time.Millisecond > a.config.Window {
+		i++
+	}
+	a.samples = a.samples[i:]
+
+	if time.Duration(int64(p.TimeStamp)-int64(a.lastCheck))*time.Millisecond < a.config.CheckInterval {
+		a.mtx.Unlock()
+		return
+	}
+	a.lastCheck = p.TimeStamp
+	report, raised := a.check()
+	a.mtx.Unlock()
+
+	a.config.OnReport(report)
+	for _, w := range raised {
+		a.config.OnWarning(report, w)
+	}
+}
+
+// Report returns the result of the last check.
+func (a *Analyzer) Report() Report {
+	a.mtx.Lock()
+	defer a.mtx.Unlock()
+	return a.last
+}
+
+// Stats measures the current window.
+func (a *Analyzer) Stats() Stats {
+	a.mtx.Lock()
+	defer a.mtx.Unlock()
+	return a.stats()
+}
+
+func (a *Analyzer) stats() Stats {
+	var ret Stats
+	if len(a.samples) < 2 {
+		return ret
+	}
+
+	// the first sample opens the window, its size is not part of the measured span. The tracks interleave,
+	// the newest sample is not always the last one and the timestamps are compared as int64.
+	first := int64(a.samples[0].timestamp)
+	last := first
+	for _, s := range a.samples {
+		if int64(s.timestamp) > last {
+			last = int64(s.timestamp)
+		}
+	}
+	span := float64(last-first) / 1000
+
+	var (
+		videoBytes, audioBytes int
+		frames                 []int64
+		hasKey                 bool
+		lastKey                int64
+	)
+	for i, s := range a.samples {
+		if s.video {
+			frames = append(frames, int64(s.timestamp))
+			if s.keyframe {
+				if hasKey {
+					ret.KeyframeInterval = maxDuration(ret.KeyframeInterval, time.Duration(int64(s.timestamp)-lastKey)*time.Millisecond)
+				}
+				hasKey = true
+				lastKey = int64(s.timestamp)
+			}
+		}
+		if i == 0 {
+			continue
+		}
+		if s.video {
+			videoBytes += s.bytes
+		} else {
+			audioBytes += s.bytes
+		}
+	}
+	if hasKey {
+		// the time since the last keyframe counts up to the newest video frame, not the newest audio packet.
+		ret.KeyframeInterval = maxDuration(ret.KeyframeInterval, time.Duration(a.lastVideo-lastKey)*time.Millisecond)
+	} else {
+		ret.KeyframeInterval = time.Duration(last-first) * time.Millisecond
+	}
+	if span > 0 {
+		ret.VideoBitrate = float64(videoBytes*8) / span
+		ret.AudioBitrate = float64(audioBytes*8) / span
+	}
+
+	if len(frames) > 2 {
+		videoSpan := float64(frames[len(frames)-1] - frames[0])
+		mean := videoSpan / float64(len(frames)-1)
+		if videoSpan > 0 {
+			ret.FPS = 1000 / mean
+		}
+		var deviation float64
+		for i := 1; i < len(frames); i++ {
+			deviation += math.Abs(float64(frames[i]-frames[i-1]) - mean)
+		}
+		ret.Jitter = time.Duration(deviation / float64(len(frames)-1) * float64(time.Millisecond))
+	}
+
+	return ret
+}
+
+// check compares the stats with the policy and returns the warnings which were not raised before, a.mtx must be held.
+func (a *Analyzer) check() (Report, []Warning) {
+	stats := a.stats()
+	policy := a.config.Policy
+
+	warnings := []Warning{}
+	warn := func(t WarningType, value, limit float64, format string, args ...interface{}) {
+		warnings = append(warnings, Warning{Type: t, Message: fmt.Sprintf(format, args...), Value: value, Limit: limit})
+	}
+	if policy.MaxKeyframeInterval > 0 && stats.KeyframeInterval > policy.MaxKeyframeInterval {
+		warn(WarningKeyframeInterval, stats.KeyframeInterval.Seconds(), policy.MaxKeyframeInterval.Seconds(),
+			"keyframe interval is %s, it should be at most %s", stats.KeyframeInterval, policy.MaxKeyframeInterval)
+	}
+	if policy.MinFPS > 0 && stats.FPS < policy.MinFPS {
+		warn(WarningLowFPS, stats.FPS, policy.MinFPS, "frame rate is %.1f fps, it should be at least %.1f fps", stats.FPS, policy.MinFPS)
+	}
+	if policy.MaxFPS > 0 && stats.FPS > policy.MaxFPS {
+		warn(WarningHighFPS, stats.FPS, policy.MaxFPS, "frame rate is %.1f fps, it should be at most %.1f fps", stats.FPS, policy.MaxFPS)
+	}
+	if policy.MinVideoBitrate > 0 && stats.VideoBitrate < policy.MinVideoBitrate {
+		warn(WarningLowVideoBitrate, stats.VideoBitrate, policy.MinVideoBitrate,
+			"video bitrate is %.0f kbps, it should be at least %.0f kbps", stats.VideoBitrate/1000, policy.MinVideoBitrate/1000)
+	}
+	if policy.MaxVideoBitrate > 0 && stats.VideoBitrate > policy.MaxVideoBitrate {
+		warn(WarningHighVideoBitrate, stats.VideoBitrate, policy.MaxVideoBitrate,
+			"video bitrate is %.0f kbps, it should be at most %.0f kbps", stats.VideoBitrate/1000, policy.MaxVideoBitrate/1000)
+	}
+	if policy.MaxAudioBitrate > 0 && stats.AudioBitrate > policy.MaxAudioBitrate {
+		warn(WarningHighAudioBitrate, stats.AudioBitrate, policy.MaxAudioBitrate,
+			"audio bitrate is %.0f kbps, it should be at most %.0f kbps", stats.AudioBitrate/1000, policy.MaxAudioBitrate/1000)
+	}
+	if policy.MaxJitter > 0 && stats.Jitter > policy.MaxJitter {
+		warn(WarningJitter, stats.Jitter.Seconds(), policy.MaxJitter.Seconds(),
+			"frame timestamps vary by %s, the frame rate should be constant", stats.Jitter)
+	}
+
+	var raised []Warning
+	current := make(map[WarningType]bool, len(warnings))
+	for _, w := range warnings {
+		current[w.Type] = true
+		if !a.raised[w.Type] {
+			raised = append(raised, w)
+		}
+	}
+	a.raised = current
+
+	a.last = Report{
+		Key:       a.info.Key,
+		App:       a.info.App,
+		Name:      a.info.Name,
+		Healthy:   len(warnings) == 0,
+		Stats:     stats,
+		Warnings:  warnings,
+		Timestamp: time.Now(),
+	}
+	return a.last, raised
+}
+
+func maxDuration(a, b time.Duration) time.Duration {
+	if a > b {
+		return a
+	}
+	return b
+}
@@ -0,0 +1,158 @@
+package health
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/viderstv/common/streaming/av"
+	"github.com/viderstv/common/streaming/container/flv"
+	"github.com/viderstv/common/streaming/internal/redistest"
+)
+
+func packet(t *testing.T, ts uint32, video, key bool, size int) *av.Packet {
+	data := make([]byte, size)
+	switch {
+	case !video:
+		data[0] = av.SOUND_AAC<<4 | 0x0f
+		data[1] = av.AAC_RAW
+	case key:
+		data[0] = 0x17
+		data[1] = av.AVC_NALU
+	default:
+		data[0] = 0x27
+		data[1] = av.AVC_NALU
+	}
+	tag := &flv.Tag{}
+	if _, err := tag.ParseMediaTagHeader(data, video); err != nil {
+		t.Fatal(err)
+	}
+	return &av.Packet{IsVideo: video, IsAudio: !video, Header: tag, TimeStamp: ts, Data: data}
+}
+
+// feed sends seconds of 30 fps video with 1250 byte frames and 50 audio packets of 500 bytes per second.
+func feed(t *testing.T, a *Analyzer, start uint32, seconds int, keyEvery int) uint32 {
+	ts := start
+	for i := 0; i < seconds*30; i++ {
+		ts = start + uint32(i*1000/30)
+		a.Observe(packet(t, ts, true, i%keyEvery == 0, 1250))
+		if i%3 != 2 {
+			a.Observe(packet(t, ts, false, false, 500))
+		}
+	}
+	return ts
+}
+
+func TestAnalyzer(t *testing.T) {
+	at := assert.New(t)
+
+	var (
+		reports  []Report
+		warnings []Warning
+	)
+	a := NewAnalyzer(av.Info{Key: "key", Name: "user"}, Config{
+		Policy:    DefaultPolicy,
+		OnReport:  func(r Report) { reports = append(reports, r) },
+		OnWarning: func(r Report, w Warning) { warnings = append(warnings, w) },
+	})
+
+	// a keyframe every 2 seconds is healthy
+	ts := feed(t, a, 0, 11, 60)
+	at.Len(reports, 2)
+	at.Empty(warnings)
+	report := a.Report()
+	at.True(report.Healthy)
+	at.Equal(report.Name, "user")
+	at.InDelta(report.Stats.FPS, 30, 0.1)
+	at.InDelta(report.Stats.VideoBitrate, 300000, 1000)
+	at.InDelta(report.Stats.AudioBitrate, 80000, 1000)
+	at.Equal(report.Stats.KeyframeInterval, 2*time.Second)
+	at.True(report.Stats.Jitter < time.Millisecond)
+
+	// a keyframe every 10 seconds is raised once
+	feed(t, a, ts+33, 20, 300)
+	at.Len(warnings, 1)
+	at.Equal(warnings[0].Type, WarningKeyframeInterval)
+	at.Equal(warnings[0].Limit, 2.0)
+	report = a.Report()
+	at.False(report.Healthy)
+	at.Len(report.Warnings, 1)
+}
+
+func TestAnalyzerJitter(t *testing.T) {
+	at := assert.New(t)
+
+	a := NewAnalyzer(av.Info{}, Config{Policy: DefaultPolicy})
+	// frames alternate between 20 and 60 ms, 25 fps on average
+	ts := uint32(0)
+	for i := 0; i < 300; i++ {
+		a.Observe(packet(t, ts, true, i%50 == 0, 1000))
+		ts += 20 + uint32(i%2)*40
+	}
+
+	report := a.Report()
+	at.Equal(report.Stats.Jitter, 20*time.Millisecond)
+	at.Len(report.Warnings, 1)
+	at.Equal(report.Warnings[0].Type, WarningJitter)
+}
+
+func TestAnalyzerBackward(t *testing.T) {
+	at := assert.New(t)
+
+	var reports []Report
+	a := NewAnalyzer(av.Info{}, Config{OnReport: func(r Report) { reports = append(reports, r) }})
+	// a zero policy takes the default one
+	at.Equal(a.config.Policy, DefaultPolicy)
+
+	feed(t, a, 0, 11, 60)
+	at.Len(reports, 2)
+
+	// the publisher restarts its timestamps, the window starts over
+	feed(t, a, 0, 6, 60)
+	at.Len(reports, 3)
+	report := a.Report()
+	at.True(report.Healthy)
+	at.InDelta(report.Stats.FPS, 30, 0.1)
+	at.Equal(report.Stats.KeyframeInterval, 2*time.Second)
+}
+
+func TestAnalyzerInterleaved(t *testing.T) {
+	at := assert.New(t)
+
+	a := NewAnalyzer(av.Info{}, Config{})
+	// a keyframe every second, the audio of a frame arrives after the next frame
+	for i := 0; i < 60; i++ {
+		ts := uint32(i * 1000 / 30)
+		a.Observe(packet(t, ts, true, i%30 == 0, 1250))
+		if i > 0 {
+			a.Observe(packet(t, ts-10, false, false, 500))
+		}
+	}
+	a.Observe(packet(t, 2000, true, true, 1250))
+	// the last sample is older than the last keyframe
+	a.Observe(packet(t, 1990, false, false, 500))
+
+	stats := a.Stats()
+	at.Equal(stats.KeyframeInterval, time.Second)
+	at.InDelta(stats.VideoBitrate, 300000, 10000)
+	at.True(stats.AudioBitrate > 0)
+}
+
+func TestRedisPublisher(t *testing.T) {
+	at := assert.New(t)
+
+	redis := redistest.New()
+	p := NewRedisPublisher(redis, logrus.New())
+	p.Warning(Report{Name: "user"}, Warning{Type: WarningLowFPS})
+
+	msg := <-redis.Published
+	at.Equal(msg.Channel, "stream-health:user")
+
+	var event Event
+	at.NoError(json.Unmarshal([]byte(msg.Content), &event))
+	at.Equal(event.Type, EventWarning)
+	at.Equal(event.Warning.Type, WarningLowFPS)
+	at.Equal(event.Report.Name, "user")
+}
@@ -0,0 +1,68 @@
+package health
+
+import (
+	"time"
+)
+
+// Policy are the limits a stream is checked against, a zero limit is not checked.
+type Policy struct {
+	MaxKeyframeInterval time.Duration
+	MinFPS              float64
+	MaxFPS              float64
+	// Bitrates are in bits per second.
+	MinVideoBitrate float64
+	MaxVideoBitrate float64
+	MaxAudioBitrate float64
+	// MaxJitter is the mean deviation of the video frame durations, variable frame rates exceed it.
+	MaxJitter time.Duration
+}
+
+type Config struct {
+	// Policy defaults to DefaultConfig.Policy when it is zero.
+	Policy Policy
+	// Window is the media time the stats are measured over.
+	Window time.Duration
+	// CheckInterval is the media time between two checks against the policy.
+	CheckInterval time.Duration
+	// OnReport is called with the result of every check.
+	OnReport func(report Report)
+	// OnWarning is called for every warning which was not raised by the previous check.
+	OnWarning func(report Report, warning Warning)
+}
+
+func (c Config) fill() Config {
+	if c.Policy == (Policy{}) {
+		c.Policy = DefaultConfig.Policy
+	}
+	if c.Window <= 0 {
+		c.Window = DefaultConfig.Window
+	}
+	if c.CheckInterval <= 0 {
+		c.CheckInterval = DefaultConfig.CheckInterval
+	}
+	if c.OnReport == nil {
+		c.OnReport = DefaultConfig.OnReport
+	}
+	if c.OnWarning == nil {
+		c.OnWarning = DefaultConfig.OnWarning
+	}
+
+	return c
+}
+
+var DefaultPolicy = Policy{
+	MaxKeyframeInterval: time.Second * 2,
+	MinFPS:              20,
+	MaxFPS:              61,
+	MaxVideoBitrate:     8_000_000,
+	MaxAudioBitrate:     320_000,
+	MaxJitter:           time.Millisecond * 10,
+}
+
+var DefaultConfig = Config{
+	Policy:        DefaultPolicy,
+	Window:        time.Second * 10,
+	CheckInterval: time.Second * 5,
+	OnReport:      func(report Report) {},
+	OnWarning:     func(report Report, warning Warning) {},
+}
@@ -0,0 +1,30 @@
+package health
+
+import (
+	"github.com/viderstv/common/streaming/av"
+)
+
+// Reader analyzes the packets read from a publisher.
+type Reader struct {
+	av.ReadCloser
+	analyzer *Analyzer
+}
+
+func NewReader(r av.ReadCloser, config Config) *Reader {
+	return &Reader{
+		ReadCloser: r,
+		analyzer:   NewAnalyzer(r.Info(), config),
+	}
+}
+
+func (r *Reader) Read(p *av.Packet) error {
+	if err := r.ReadCloser.Read(p); err != nil {
+		return err
+	}
+	r.analyzer.Observe(p)
+	return nil
+}
+
+func (r *Reader) Analyzer() *Analyzer {
+	return r.analyzer
+}
@@ -0,0 +1,79 @@
+package health
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/viderstv/common/instance"
+)
+
+const redisPublishTimeout = time.Second * 5
+
+type EventType string
+
+const (
+	EventReport  EventType = "report"
+	EventWarning EventType = "warning"
+)
+
+// Event is published as json to the health channel of a stream.
+type Event struct {
+	Type    EventType `json:"type"`
+	Report  Report    `json:"report"`
+	Warning *Warning  `json:"warning,omitempty"`
+}
+
+// RedisChannel is the channel the events of a stream are published to, the stream name is the user id
+// after authentication.
+func RedisChannel(report Report) string {
+	return "stream-health:" + report.Name
+}
+
+// RedisPublisher pushes reports and warnings to the streamer dashboard, its methods are used as
+// Config.OnReport and Config.OnWarning. Events are published in the background so a slow redis does not
+// hold up the publisher.
+type RedisPublisher struct {
+	redis  instance.Redis
+	logger logrus.FieldLogger
+	// Channel selects the channel of a report, RedisChannel by default.
+	Channel func(report Report) string
+}
+
+func NewRedisPublisher(redis instance.Redis, logger logrus.FieldLogger) *RedisPublisher {
+	return &RedisPublisher{
+		redis:   redis,
+		logger:  logger,
+		Channel: RedisChannel,
+	}
+}
+
+func (p *RedisPublisher) Report(report Report) {
+	go p.publish(Event{Type: EventReport, Report: report})
+}
+
+func (p *RedisPublisher) Warning(report Report, warning Warning) {
+	go p.publish(Event{Type: EventWarning, Report: report, Warning: &warning})
+}
+
+// Config returns config with the callbacks set to publish.
+func (p *RedisPublisher) Config(config Config) Config {
+	config.OnReport = p.Report
+	config.OnWarning = p.Warning
+	return config
+}
+
+func (p *RedisPublisher) publish(event Event) {
+	data, err := json.Marshal(event)
+	if err != nil {
+		p.logger.Error("failed to marshal health event: ", err)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), redisPublishTimeout)
+	defer cancel()
+	if err := p.redis.Publish(ctx, p.Channel(event.Report), string(data)); err != nil {
+		p.logger.Error("failed to publish health event: ", err)
+	}
+}
@@ -0,0 +1,96 @@
+// Package avtest has publishers and viewers for the tests of the streaming packages, the test controls
+// which packets they read and sees the packets written to them.
+package avtest
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/viderstv/common/streaming/av"
+)
+
+// Reader is an av.ReadCloser which reads the packets given to Send.
+type Reader struct {
+	info    av.Info
+	packets chan *av.Packet
+	once    sync.Once
+	closed  chan struct{}
+}
+
+func NewReader(info av.Info) *Reader {
+	return &Reader{
+		info:    info,
+		packets: make(chan *av.Packet),
+		closed:  make(chan struct{}),
+	}
+}
+
+func (r *Reader) Read(p *av.Packet) error {
+	select {
+	case pkt := <-r.packets:
+		*p = *pkt
+		return nil
+	case <-r.closed:
+		return fmt.Errorf("closed")
+	}
+}
+
+// Send waits for p to be read.
+func (r *Reader) Send(t *testing.T, p *av.Packet) {
+	select {
+	case r.packets <- p:
+	case <-time.After(time.Second):
+		t.Fatal("reader not read")
+	}
+}
+
+func (r *Reader) Info() av.Info { return r.info }
+func (r *Reader) Alive() bool   { return true }
+func (r *Reader) Close() error {
+	r.once.Do(func() {
+		close(r.closed)
+	})
+	return nil
+}
+func (r *Reader) Running() <-chan struct{} { return r.closed }
+
+// Closed reports if Close was called.
+func (r *Reader) Closed() bool {
+	select {
+	case <-r.closed:
+		return true
+	default:
+		return false
+	}
+}
+
+// Writer is an av.WriteCloser which queues up to 16 written packets for Next.
+type Writer struct {
+	Reader
+}
+
+func NewWriter(info av.Info) *Writer {
+	w := &Writer{Reader: *NewReader(info)}
+	w.packets = make(chan *av.Packet, 16)
+	return w
+}
+
+func (w *Writer) Write(p *av.Packet) error {
+	w.packets <- p
+	return nil
+}
+
+func (w *Writer) CalcBaseTimestamp() {}
+
+// Next returns the next written packet.
+func (w *Writer) Next(t *testing.T) *av.Packet {
+	select {
+	case p := <-w.packets:
+		return p
+	case <-time.After(time.Second):
+		t.Fatal("no packet written")
+	}
+	return nil
+}
@@ -0,0 +1,173 @@
+// Package redistest is an in memory instance.Redis for the tests of the streaming packages.
+package redistest
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+	"github.com/viderstv/common/instance"
+)
+
+// Message is a published message.
+type Message struct {
+	Channel string
+	Content string
+}
+
+type value struct {
+	value   string
+	expires time.Time
+}
+
+// Redis implements keys with a ttl and publish and subscribe, the other methods of instance.Redis panic.
+type Redis struct {
+	instance.Redis
+
+	mtx        sync.Mutex
+	values     map[string]value
+	subs       map[string][]chan string
+	subscribed chan struct{}
+	once       sync.Once
+
+	// Published receives every published message while it has room.
+	Published chan Message
+}
+
+func New() *Redis {
+	return &Redis{
+		values:     map[string]value{},
+		subs:       map[string][]chan string{},
+		subscribed: make(chan struct{}),
+		Published:  make(chan Message, 64),
+	}
+}
+
+// Tx reads and writes keys within Redis.Tx, it emulates lua scripts.
+type Tx struct {
+	r *Redis
+}
+
+// Get returns a key which did not expire.
+func (tx Tx) Get(key string) (string, bool) {
+	v, ok := tx.r.values[key]
+	if ok && !v.expires.IsZero() && !time.Now().Before(v.expires) {
+		delete(tx.r.values, key)
+		return "", false
+	}
+	return v.value, ok
+}
+
+// Set stores a key, a ttl of 0 keeps it forever.
+func (tx Tx) Set(key string, v string, ttl time.Duration) {
+	var expires time.Time
+	if ttl > 0 {
+		expires = time.Now().Add(ttl)
+	}
+	tx.r.values[key] = value{value: v, expires: expires}
+}
+
+func (tx Tx) Del(key string) {
+	delete(tx.r.values, key)
+}
+
+// Tx runs fn atomically.
+func (r *Redis) Tx(fn func(tx Tx)) {
+	r.mtx.Lock()
+	defer r.mtx.Unlock()
+	fn(Tx{r: r})
+}
+
+func (r *Redis) Get(ctx context.Context, key string) (interface{}, error) {
+	var (
+		v  string
+		ok bool
+	)
+	r.Tx(func(tx Tx) {
+		v, ok = tx.Get(key)
+	})
+	if !ok {
+		return nil, redis.Nil
+	}
+	return v, nil
+}
+
+func (r *Redis) Set(ctx context.Context, key string, v string) error {
+	r.Tx(func(tx Tx) {
+		tx.Set(key, v, 0)
+	})
+	return nil
+}
+
+func (r *Redis) SetEX(ctx context.Context, key string, v string, ttl time.Duration) error {
+	r.Tx(func(tx Tx) {
+		tx.Set(key, v, ttl)
+	})
+	return nil
+}
+
+func (r *Redis) SetNX(ctx context.Context, key string, v string, ttl time.Duration) (bool, error) {
+	set := false
+	r.Tx(func(tx Tx) {
+		if _, ok := tx.Get(key); !ok {
+			tx.Set(key, v, ttl)
+			set = true
+		}
+	})
+	return set, nil
+}
+
+func (r *Redis) Expire(ctx context.Context, key string, ttl time.Duration) error {
+	r.Tx(func(tx Tx) {
+		if v, ok := tx.Get(key); ok {
+			tx.Set(key, v, ttl)
+		}
+	})
+	return nil
+}
+
+func (r *Redis) Del(ctx context.Context, key string) error {
+	r.Tx(func(tx Tx) {
+		tx.Del(key)
+	})
+	return nil
+}
+
+// Subscribe delivers the messages of the channels to ch.
+func (r *Redis) Subscribe(ctx context.Context, ch chan string, subscribeTo ...string) {
+	r.mtx.Lock()
+	for _, channel := range subscribeTo {
+		r.subs[channel] = append(r.subs[channel], ch)
+	}
+	r.mtx.Unlock()
+
+	r.once.Do(func() {
+		close(r.subscribed)
+	})
+}
+
+// Subscribed is closed once the first subscription was made.
+func (r *Redis) Subscribed() <-chan struct{} {
+	return r.subscribed
+}
+
+func (r *Redis) Publish(ctx context.Context, channel string, content string) error {
+	select {
+	case r.Published <- Message{Channel: channel, Content: content}:
+	default:
+	}
+
+	r.mtx.Lock()
+	subs := append([]chan string(nil), r.subs[channel]...)
+	r.mtx.Unlock()
+
+	for _, ch := range subs {
+		select {
+		case ch <- content:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+	return nil
+}
@@ -0,0 +1,135 @@
+package metrics
+
+import (
+	"sync"
+	"time"
+
+	"github.com/viderstv/common/streaming/av"
+)
+
+const DefaultMeterWindow = time.Second * 5
+
+// Ingest describes the media received by a stream, rates are measured over the meter window in media time.
+type Ingest struct {
+	// Bitrate in bits per second.
+	Bitrate          float64
+	FPS              float64
+	KeyframeInterval time.Duration
+	Bytes            uint64
+	Packets          uint64
+}
+
+type meterSample struct {
+	timestamp uint32
+	bytes     int
+	video     bool
+}
+
+// Meter measures bitrate, frame rate and keyframe interval from packet timestamps, so the rates do not
+// depend on how fast the packets arrive.
+type Meter struct {
+	window  time.Duration
+	samples []meterSample
+
+	hasKey      bool
+	lastKey     uint32
+	keyInterval time.Duration
+
+	bytes   uint64
+	packets uint64
+
+	mtx sync.Mutex
+}
+
+func NewMeter(window time.Duration) *Meter {
+	if window <= 0 {
+		window = DefaultMeterWindow
+	}
+	return &Meter{
+		window: window,
+	}
+}
+
+func (m *Meter) Observe(p *av.Packet) {
+	if p.IsMetadata {
+		return
+	}
+
+	m.mtx.Lock()
+	defer m.mtx.Unlock()
+
+	m.bytes += uint64(len(p.Data))
+	m.packets++
+
+	if p.Discontinuity {
+		m.samples = m.samples[:0]
+		m.hasKey = false
+	}
+
+	video := false
+	if vh, ok := p.Header.(av.VideoPacketHeader); ok && p.IsVideo {
+		if vh.IsSeq() {
+			return
+		}
+		video = true
+		if vh.IsKeyFrame() {
+			if m.hasKey {
+				m.keyInterval = time.Duration(p.TimeStamp-m.lastKey) * time.Millisecond
+			}
+			m.hasKey = true
+			m.lastKey = p.TimeStamp
+		}
+	}
+
+	m.samples = append(m.samples, meterSample{timestamp: p.TimeStamp, bytes: len(p.Data), video: video})
+	i := 0
+	for time.Duration(p.TimeStamp-m.samples[i].timestamp)*time.Millisecond > m.window {
+		i++
+	}
+	m.samples = m.samples[i:]
+}
+
+func (m *Meter) Ingest() Ingest {
+	m.mtx.Lock()
+	defer m.mtx.Unlock()
+
+	ret := Ingest{
+		KeyframeInterval: m.keyInterval,
+		Bytes:            m.bytes,
+		Packets:          m.packets,
+	}
+	if len(m.samples) < 2 {
+		return ret
+	}
+
+	// the first sample opens the window, its size and frame are not part of the measured span.
+	first := m.samples[0]
+	last := m.samples[len(m.samples)-1]
+	if span := float64(last.timestamp-first.timestamp) / 1000; span > 0 {
+		bytes := 0
+		for _, s := range m.samples[1:] {
+			bytes += s.bytes
+		}
+		ret.Bitrate = float64(bytes*8) / span
+	}
+
+	var (
+		frames                int
+		firstVideo, lastVideo uint32
+	)
+	for _, s := range m.samples {
+		if !s.video {
+			continue
+		}
+		if frames == 0 {
+			firstVideo = s.timestamp
+		}
+		lastVideo = s.timestamp
+		frames++
+	}
+	if span := float64(lastVideo-firstVideo) / 1000; frames > 1 && span > 0 {
+		ret.FPS = float64(frames-1) / span
+	}
+
+	return ret
+}
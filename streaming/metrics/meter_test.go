@@ -0,0 +1,49 @@
+package metrics
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/viderstv/common/streaming/av"
+	"github.com/viderstv/common/streaming/container/flv"
+)
+
+func videoPacket(t *testing.T, ts uint32, key bool, size int) *av.Packet {
+	data := make([]byte, size)
+	data[0] = 0x27
+	if key {
+		data[0] = 0x17
+	}
+	data[1] = av.AVC_NALU
+	tag := &flv.Tag{}
+	if _, err := tag.ParseMediaTagHeader(data, true); err != nil {
+		t.Fatal(err)
+	}
+	return &av.Packet{IsVideo: true, Header: tag, TimeStamp: ts, Data: data}
+}
+
+func TestMeter(t *testing.T) {
+	at := assert.New(t)
+
+	m := NewMeter(time.Second * 2)
+	// 25 fps with 1000 byte frames and a keyframe every second, for 4 seconds.
+	for i := 0; i <= 100; i++ {
+		m.Observe(videoPacket(t, uint32(i*40), i%25 == 0, 1000))
+	}
+
+	ingest := m.Ingest()
+	at.Equal(ingest.FPS, 25.0)
+	at.Equal(ingest.Bitrate, 200000.0)
+	at.Equal(ingest.KeyframeInterval, time.Second)
+	at.Equal(ingest.Bytes, uint64(101000))
+	at.Equal(ingest.Packets, uint64(101))
+
+	// a discontinuity starts a new window
+	p := videoPacket(t, 100000, false, 1000)
+	p.Discontinuity = true
+	m.Observe(p)
+	ingest = m.Ingest()
+	at.Equal(ingest.FPS, 0.0)
+	at.Equal(ingest.Bitrate, 0.0)
+}
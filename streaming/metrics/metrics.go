@@ -0,0 +1,91 @@
+package metrics
+
+import (
+	"net/http"
+	"sort"
+	"sync"
+)
+
+type Type string
+
+const (
+	TypeCounter   Type = "counter"
+	TypeGauge     Type = "gauge"
+	TypeHistogram Type = "histogram"
+)
+
+type Label struct {
+	Name  string
+	Value string
+}
+
+type Sample struct {
+	// Suffix is appended to the family name, histograms use _bucket, _sum and _count.
+	Suffix string
+	Labels []Label
+	Value  float64
+}
+
+type Family struct {
+	Name    string
+	Help    string
+	Type    Type
+	Samples []Sample
+}
+
+// Collector returns its current metrics on every scrape.
+type Collector interface {
+	Collect() []Family
+}
+
+type CollectorFunc func() []Family
+
+func (f CollectorFunc) Collect() []Family {
+	return f()
+}
+
+// Registry gathers the metrics of the registered collectors and serves them in the Prometheus text format.
+type Registry struct {
+	collectors []Collector
+	mtx        sync.Mutex
+}
+
+func NewRegistry() *Registry {
+	return &Registry{}
+}
+
+func (r *Registry) Register(c Collector) {
+	r.mtx.Lock()
+	r.collectors = append(r.collectors, c)
+	r.mtx.Unlock()
+}
+
+// Gather collects all families ordered by name, families of the same name from several collectors are merged.
+func (r *Registry) Gather() []Family {
+	r.mtx.Lock()
+	collectors := append([]Collector(nil), r.collectors...)
+	r.mtx.Unlock()
+
+	byName := map[string]int{}
+	var ret []Family
+	for _, c := range collectors {
+		for _, f := range c.Collect() {
+			if i, ok := byName[f.Name]; ok {
+				ret[i].Samples = append(ret[i].Samples, f.Samples...)
+				continue
+			}
+			byName[f.Name] = len(ret)
+			ret = append(ret, f)
+		}
+	}
+	sort.Slice(ret, func(i, j int) bool {
+		return ret[i].Name < ret[j].Name
+	})
+
+	return ret
+}
+
+func (r *Registry) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	w.Header().Set("Content-Type", ContentType)
+	_ = WriteText(w, r.Gather())
+}
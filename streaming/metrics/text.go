@@ -0,0 +1,60 @@
+package metrics
+
+import (
+	"bufio"
+	"io"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// ContentType is the Prometheus text exposition format written by WriteText.
+const ContentType = "text/plain; version=0.0.4; charset=utf-8"
+
+var (
+	helpEscaper  = strings.NewReplacer(`\`, `\\`, "\n", `\n`)
+	labelEscaper = strings.NewReplacer(`\`, `\\`, "\n", `\n`, `"`, `\"`)
+)
+
+func WriteText(w io.Writer, families []Family) error {
+	bw := bufio.NewWriter(w)
+
+	for _, f := range families {
+		if f.Help != "" {
+			_, _ = bw.WriteString("# HELP " + f.Name + " " + helpEscaper.Replace(f.Help) + "\n")
+		}
+		if f.Type != "" {
+			_, _ = bw.WriteString("# TYPE " + f.Name + " " + string(f.Type) + "\n")
+		}
+		for _, s := range f.Samples {
+			_, _ = bw.WriteString(f.Name + s.Suffix)
+			if len(s.Labels) != 0 {
+				_ = bw.WriteByte('{')
+				for i, l := range s.Labels {
+					if i != 0 {
+						_ = bw.WriteByte(',')
+					}
+					_, _ = bw.WriteString(l.Name + `="` + labelEscaper.Replace(l.Value) + `"`)
+				}
+				_ = bw.WriteByte('}')
+			}
+			_ = bw.WriteByte(' ')
+			_, _ = bw.WriteString(formatFloat(s.Value))
+			_ = bw.WriteByte('\n')
+		}
+	}
+
+	return bw.Flush()
+}
+
+func formatFloat(v float64) string {
+	switch {
+	case math.IsInf(v, 1):
+		return "+Inf"
+	case math.IsInf(v, -1):
+		return "-Inf"
+	case math.IsNaN(v):
+		return "NaN"
+	}
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
@@ -0,0 +1,58 @@
+package metrics
+
+import (
+	"bytes"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWriteText(t *testing.T) {
+	at := assert.New(t)
+
+	var c Counter
+	c.Add(3)
+	h := NewHistogram(2, 1)
+	h.Observe(0.5)
+	h.Observe(1.5)
+	h.Observe(4)
+
+	r := NewRegistry()
+	r.Register(CollectorFunc(func() []Family {
+		return []Family{{
+			Name:    "test_seconds",
+			Help:    "A histogram.",
+			Type:    TypeHistogram,
+			Samples: h.Samples(Labels("stream", "a")...),
+		}, {
+			Name:    "test_total",
+			Help:    "A counter\nwith two lines.",
+			Type:    TypeCounter,
+			Samples: []Sample{c.Sample(Labels("name", `a "b"`)...)},
+		}}
+	}))
+	r.Register(CollectorFunc(func() []Family {
+		return []Family{{Name: "test_total", Samples: []Sample{{Value: 1}}}}
+	}))
+
+	buf := bytes.NewBuffer(nil)
+	at.NoError(WriteText(buf, r.Gather()))
+	at.Equal(buf.String(), `# HELP test_seconds A histogram.
+# TYPE test_seconds histogram
+test_seconds_bucket{stream="a",le="1"} 1
+test_seconds_bucket{stream="a",le="2"} 2
+test_seconds_bucket{stream="a",le="+Inf"} 3
+test_seconds_sum{stream="a"} 6
+test_seconds_count{stream="a"} 3
+# HELP test_total A counter\nwith two lines.
+# TYPE test_total counter
+test_total{name="a \"b\""} 3
+test_total 1
+`)
+
+	rec := httptest.NewRecorder()
+	r.ServeHTTP(rec, httptest.NewRequest("GET", "/metrics", nil))
+	at.Equal(rec.Header().Get("Content-Type"), ContentType)
+	at.Equal(rec.Body.String(), buf.String())
+}
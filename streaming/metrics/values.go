@@ -0,0 +1,94 @@
+package metrics
+
+import (
+	"math"
+	"sort"
+	"sync"
+	"sync/atomic"
+)
+
+// Counter is a monotonically increasing count, usable at its zero value.
+type Counter struct {
+	n uint64
+}
+
+func (c *Counter) Inc() {
+	atomic.AddUint64(&c.n, 1)
+}
+
+func (c *Counter) Add(n uint64) {
+	atomic.AddUint64(&c.n, n)
+}
+
+func (c *Counter) Value() uint64 {
+	return atomic.LoadUint64(&c.n)
+}
+
+func (c *Counter) Sample(labels ...Label) Sample {
+	return Sample{Labels: labels, Value: float64(c.Value())}
+}
+
+// Histogram counts observations into cumulative buckets.
+type Histogram struct {
+	bounds []float64
+	counts []uint64
+	sum    float64
+	count  uint64
+	mtx    sync.Mutex
+}
+
+// NewHistogram creates a histogram with the upper bounds of its buckets, the +Inf bucket is implied.
+func NewHistogram(bounds ...float64) *Histogram {
+	bounds = append([]float64(nil), bounds...)
+	sort.Float64s(bounds)
+	return &Histogram{
+		bounds: bounds,
+		counts: make([]uint64, len(bounds)),
+	}
+}
+
+func (h *Histogram) Observe(v float64) {
+	h.mtx.Lock()
+	defer h.mtx.Unlock()
+
+	if i := sort.SearchFloat64s(h.bounds, v); i < len(h.bounds) {
+		h.counts[i]++
+	}
+	h.sum += v
+	h.count++
+}
+
+// Samples returns the _bucket, _sum and _count samples with the labels.
+func (h *Histogram) Samples(labels ...Label) []Sample {
+	h.mtx.Lock()
+	defer h.mtx.Unlock()
+
+	ret := make([]Sample, 0, len(h.bounds)+3)
+	var cumulative uint64
+	for i, b := range h.bounds {
+		cumulative += h.counts[i]
+		ret = append(ret, Sample{Suffix: "_bucket", Labels: withLabel(labels, "le", formatFloat(b)), Value: float64(cumulative)})
+	}
+	ret = append(ret,
+		Sample{Suffix: "_bucket", Labels: withLabel(labels, "le", formatFloat(math.Inf(1))), Value: float64(h.count)},
+		Sample{Suffix: "_sum", Labels: labels, Value: h.sum},
+		Sample{Suffix: "_count", Labels: labels, Value: float64(h.count)},
+	)
+
+	return ret
+}
+
+func withLabel(labels []Label, name, value string) []Label {
+	ret := make([]Label, len(labels), len(labels)+1)
+	copy(ret, labels)
+	return append(ret, Label{Name: name, Value: value})
+}
+
+// Labels builds labels from name, value pairs.
+func Labels(pairs ...string) []Label {
+	ret := make([]Label, 0, len(pairs)/2)
+	for i := 0; i+1 < len(pairs); i += 2 {
+		ret = append(ret, Label{Name: pairs[i], Value: pairs[i+1]})
+	}
+	return ret
+}
@@ -0,0 +1,314 @@
+package aac
+
+import (
+	"fmt"
+
+	"github.com/viderstv/common/utils/bits"
+)
+
+const (
+	ObjectTypeMain = 1
+	ObjectTypeLC   = 2
+	ObjectTypeSSR  = 3
+	ObjectTypeLTP  = 4
+	ObjectTypeSBR  = 5
+	ObjectTypePS   = 29
+
+	objectTypeEscape      = 31
+	sampleRateIndexEscape = 0x0f
+
+	syncExtensionSBR = 0x2b7
+	syncExtensionPS  = 0x548
+)
+
+// AudioSpecificConfig is the decoded ISO 14496-3 AudioSpecificConfig from the aac sequence header.
+type AudioSpecificConfig struct {
+	// ObjectType is the object type of the core coder, LC for HE-AAC streams.
+	ObjectType      int
+	SampleRateIndex int
+	// SampleRate is the rate of the core coder.
+	SampleRate    int
+	ChannelConfig int
+	Channels      int
+	FrameLength   int
+
+	// SBR and PS are set for HE-AAC v1 and v2 streams.
+	SBR bool
+	PS  bool
+	// ExtensionSampleRate is the output rate of the sbr tool.
+	ExtensionSampleRate int
+}
+
+var (
+	// channels for each channel configuration, Table 1.19.
+	channelConfigs = []int{0, 1, 2, 3, 4, 5, 6, 8}
+	channelLayouts = []string{"", "mono", "stereo", "3.0", "4.0", "5.0", "5.1", "7.1"}
+)
+
+// ChannelLayout returns the layout name of a channel configuration in the same format ffprobe reports it.
+func ChannelLayout(channelConfig int) string {
+	if channelConfig < 0 || channelConfig >= len(channelLayouts) {
+		return ""
+	}
+	return channelLayouts[channelConfig]
+}
+
+func readObjectType(r *bits.Reader) (int, error) {
+	v, err := r.ReadBits(5)
+	if err != nil {
+		return 0, err
+	}
+	if v == objectTypeEscape {
+		ext, err := r.ReadBits(6)
+		if err != nil {
+			return 0, err
+		}
+		v = 32 + ext
+	}
+	return int(v), nil
+}
+
+func readSampleRate(r *bits.Reader) (int, int, error) {
+	index, err := r.ReadBits(4)
+	if err != nil {
+		return 0, 0, err
+	}
+	if index == sampleRateIndexEscape {
+		rate, err := r.ReadBits(24)
+		return int(index), int(rate), err
+	}
+	if int(index) >= len(aacRates) {
+		return 0, 0, ErrSpecificBufInvalid
+	}
+	return int(index), aacRates[index], nil
+}
+
+// rateIndex returns the index of the closest standard sample rate.
+func rateIndex(rate int) int {
+	best := 0
+	for i, v := range aacRates {
+		if abs(v-rate) < abs(aacRates[best]-rate) {
+			best = i
+		}
+	}
+	return best
+}
+
+func abs(v int) int {
+	if v < 0 {
+		return -v
+	}
+	return v
+}
+
+// ParseAudioSpecificConfig decodes an AudioSpecificConfig including explicit and backward
+// compatible SBR/PS signaling.
+func ParseAudioSpecificConfig(b []byte) (AudioSpecificConfig, error) {
+	cfg := AudioSpecificConfig{FrameLength: 1024}
+	if len(b) < 2 {
+		return cfg, ErrSpecificBufInvalid
+	}
+
+	r := bits.NewReader(b)
+	objectType, err := readObjectType(r)
+	if err != nil {
+		return cfg, ErrSpecificBufInvalid
+	}
+	if cfg.SampleRateIndex, cfg.SampleRate, err = readSampleRate(r); err != nil {
+		return cfg, ErrSpecificBufInvalid
+	}
+	channelConfig, err := r.ReadBits(4)
+	if err != nil {
+		return cfg, ErrSpecificBufInvalid
+	}
+	cfg.ChannelConfig = int(channelConfig)
+
+	// explicit hierarchical signaling, the extension sample rate and the core object type follow.
+	if objectType == ObjectTypeSBR || objectType == ObjectTypePS {
+		cfg.SBR = true
+		cfg.PS = objectType == ObjectTypePS
+		if _, cfg.ExtensionSampleRate, err = readSampleRate(r); err != nil {
+			return cfg, ErrSpecificBufInvalid
+		}
+		if objectType, err = readObjectType(r); err != nil {
+			return cfg, ErrSpecificBufInvalid
+		}
+	}
+	cfg.ObjectType = objectType
+
+	if cfg.ChannelConfig < len(channelConfigs) {
+		cfg.Channels = channelConfigs[cfg.ChannelConfig]
+	}
+
+	switch cfg.ObjectType {
+	case 1, 2, 3, 4, 6, 7, 17, 19, 20, 21, 22, 23:
+		if err := cfg.parseGASpecificConfig(r); err != nil {
+			return cfg, err
+		}
+	default:
+		// we cannot look for a sync extension after a config we do not understand.
+		return cfg, nil
+	}
+
+	// backward compatible signaling appends a sync extension after the core config.
+	if !cfg.SBR && r.Left() >= 16 {
+		if v, _ := r.ReadBits(11); v == syncExtensionSBR {
+			ext, err := readObjectType(r)
+			if err == nil && ext == ObjectTypeSBR {
+				if sbr, _ := r.ReadFlag(); sbr {
+					cfg.SBR = true
+					if _, cfg.ExtensionSampleRate, err = readSampleRate(r); err != nil {
+						return cfg, ErrSpecificBufInvalid
+					}
+					if r.Left() >= 12 {
+						if v, _ := r.ReadBits(11); v == syncExtensionPS {
+							cfg.PS, _ = r.ReadFlag()
+						}
+					}
+				}
+			}
+		}
+	}
+
+	if cfg.SBR && cfg.ExtensionSampleRate == 0 {
+		cfg.ExtensionSampleRate = cfg.SampleRate * 2
+	}
+
+	// parametric stereo always decodes to two channels.
+	if cfg.PS && cfg.Channels == 1 {
+		cfg.Channels = 2
+	}
+
+	return cfg, nil
+}
+
+func (c *AudioSpecificConfig) parseGASpecificConfig(r *bits.Reader) error {
+	frameLengthFlag, err := r.ReadFlag()
+	if err != nil {
+		return ErrSpecificBufInvalid
+	}
+	if frameLengthFlag {
+		c.FrameLength = 960
+	}
+	if dependsOnCoreCoder, _ := r.ReadFlag(); dependsOnCoreCoder {
+		if err := r.Skip(14); err != nil {
+			return ErrSpecificBufInvalid
+		}
+	}
+	extensionFlag, err := r.ReadFlag()
+	if err != nil {
+		return ErrSpecificBufInvalid
+	}
+
+	if c.ChannelConfig == 0 {
+		if c.Channels, err = parseProgramConfigElement(r); err != nil {
+			return ErrSpecificBufInvalid
+		}
+	}
+
+	if c.ObjectType == 6 || c.ObjectType == 20 {
+		_ = r.Skip(3) // layerNr
+	}
+	if extensionFlag {
+		switch c.ObjectType {
+		case 22:
+			_ = r.Skip(5 + 11) // numOfSubFrame, layer_length
+		case 17, 19, 20, 23:
+			_ = r.Skip(3) // resilience flags
+		}
+		_ = r.Skip(1) // extensionFlag3
+	}
+
+	return nil
+}
+
+// parseProgramConfigElement returns the number of output channels described by a pce.
+func parseProgramConfigElement(r *bits.Reader) (int, error) {
+	if err := r.Skip(4 + 2 + 4); err != nil { // element_instance_tag, object_type, sampling_frequency_index
+		return 0, err
+	}
+	front, _ := r.ReadBits(4)
+	side, _ := r.ReadBits(4)
+	back, _ := r.ReadBits(4)
+	lfe, _ := r.ReadBits(2)
+	assoc, _ := r.ReadBits(3)
+	cc, err := r.ReadBits(4)
+	if err != nil {
+		return 0, err
+	}
+	for i := 0; i < 3; i++ {
+		// mono_mixdown, stereo_mixdown and matrix_mixdown
+		if present, _ := r.ReadFlag(); present {
+			n := 4
+			if i == 2 {
+				n = 3
+			}
+			_ = r.Skip(n)
+		}
+	}
+
+	channels := 0
+	for _, n := range []uint32{front, side, back} {
+		for i := uint32(0); i < n; i++ {
+			cpe, err := r.ReadFlag()
+			if err != nil {
+				return 0, err
+			}
+			_ = r.Skip(4)
+			channels++
+			if cpe {
+				channels++
+			}
+		}
+	}
+	channels += int(lfe)
+	if err := r.Skip(int(lfe)*4 + int(assoc)*4 + int(cc)*5); err != nil {
+		return 0, err
+	}
+
+	return channels, nil
+}
+
+// OutputSampleRate is the rate of the decoded audio, which is the sbr rate for HE-AAC.
+func (c AudioSpecificConfig) OutputSampleRate() int {
+	if c.SBR && c.ExtensionSampleRate != 0 {
+		return c.ExtensionSampleRate
+	}
+	return c.SampleRate
+}
+
+// AudioObjectType is the object type signaled to players, 5 for HE-AAC and 29 for HE-AAC v2.
+func (c AudioSpecificConfig) AudioObjectType() int {
+	switch {
+	case c.PS:
+		return ObjectTypePS
+	case c.SBR:
+		return ObjectTypeSBR
+	}
+	return c.ObjectType
+}
+
+// Codec returns the RFC 6381 codec string, for example mp4a.40.2.
+func (c AudioSpecificConfig) Codec() string {
+	return fmt.Sprintf("mp4a.40.%d", c.AudioObjectType())
+}
+
+func (c AudioSpecificConfig) ProfileName() string {
+	return profileName(c.AudioObjectType())
+}
+
+func (c AudioSpecificConfig) ChannelLayout() string {
+	if c.ChannelConfig == 0 {
+		switch c.Channels {
+		case 1:
+			return "mono"
+		case 2:
+			return "stereo"
+		}
+		return ""
+	}
+	if c.PS && c.ChannelConfig == 1 {
+		return "stereo"
+	}
+	return ChannelLayout(c.ChannelConfig)
+}
@@ -0,0 +1,115 @@
+package aac
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/viderstv/common/streaming/av"
+)
+
+var (
+	// aac lc, 44.1khz, stereo
+	ascLC = []byte{0x12, 0x10}
+	// explicit sbr, 22.05khz core, 44.1khz output, stereo
+	ascHEv1 = []byte{0x2b, 0x92, 0x08, 0x00}
+	// explicit ps, 24khz core, 48khz output, mono core
+	ascHEv2 = []byte{0xeb, 0x09, 0x88, 0x00}
+	// lc 24khz stereo with a backward compatible sbr and ps sync extension
+	ascBackward = []byte{0x13, 0x10, 0x56, 0xe5, 0x9d, 0x48, 0x80}
+	// lc with an explicit 44100 frequency
+	ascExplicitRate = []byte{0x17, 0x80, 0x56, 0x22, 0x10}
+	// lc 48khz, 7.1
+	asc71 = []byte{0x11, 0xb8}
+)
+
+func TestParseAudioSpecificConfig(t *testing.T) {
+	at := assert.New(t)
+
+	cfg, err := ParseAudioSpecificConfig(ascLC)
+	at.Equal(err, nil)
+	at.Equal(cfg.ObjectType, ObjectTypeLC)
+	at.Equal(cfg.SampleRate, 44100)
+	at.Equal(cfg.OutputSampleRate(), 44100)
+	at.Equal(cfg.Channels, 2)
+	at.Equal(cfg.FrameLength, 1024)
+	at.False(cfg.SBR)
+	at.Equal(cfg.Codec(), "mp4a.40.2")
+	at.Equal(cfg.ProfileName(), "LC")
+	at.Equal(cfg.ChannelLayout(), "stereo")
+
+	cfg, err = ParseAudioSpecificConfig(ascHEv1)
+	at.Equal(err, nil)
+	at.Equal(cfg.ObjectType, ObjectTypeLC)
+	at.True(cfg.SBR)
+	at.False(cfg.PS)
+	at.Equal(cfg.SampleRate, 22050)
+	at.Equal(cfg.OutputSampleRate(), 44100)
+	at.Equal(cfg.Codec(), "mp4a.40.5")
+	at.Equal(cfg.ProfileName(), "HE-AAC")
+
+	cfg, err = ParseAudioSpecificConfig(ascHEv2)
+	at.Equal(err, nil)
+	at.True(cfg.SBR)
+	at.True(cfg.PS)
+	at.Equal(cfg.SampleRate, 24000)
+	at.Equal(cfg.OutputSampleRate(), 48000)
+	at.Equal(cfg.Channels, 2)
+	at.Equal(cfg.ChannelLayout(), "stereo")
+	at.Equal(cfg.Codec(), "mp4a.40.29")
+	at.Equal(cfg.ProfileName(), "HE-AACv2")
+
+	cfg, err = ParseAudioSpecificConfig(ascBackward)
+	at.Equal(err, nil)
+	at.Equal(cfg.ObjectType, ObjectTypeLC)
+	at.True(cfg.SBR)
+	at.True(cfg.PS)
+	at.Equal(cfg.SampleRate, 24000)
+	at.Equal(cfg.OutputSampleRate(), 48000)
+	at.Equal(cfg.Codec(), "mp4a.40.29")
+
+	cfg, err = ParseAudioSpecificConfig(ascExplicitRate)
+	at.Equal(err, nil)
+	at.Equal(cfg.SampleRateIndex, 15)
+	at.Equal(cfg.SampleRate, 44100)
+	at.Equal(cfg.Channels, 2)
+
+	cfg, err = ParseAudioSpecificConfig(asc71)
+	at.Equal(err, nil)
+	at.Equal(cfg.SampleRate, 48000)
+	at.Equal(cfg.ChannelConfig, 7)
+	at.Equal(cfg.Channels, 8)
+	at.Equal(cfg.ChannelLayout(), "7.1")
+
+	_, err = ParseAudioSpecificConfig([]byte{0x12})
+	at.Equal(err, ErrSpecificBufInvalid)
+}
+
+func TestParserHEAAC(t *testing.T) {
+	at := assert.New(t)
+
+	p := NewParser()
+	at.Equal(p.Parse(ascHEv1, av.AAC_SEQHDR, nil), nil)
+	at.Equal(p.ObjectType(), ObjectTypeSBR)
+	// adts timing follows the core coder
+	at.Equal(p.SampleRate(), 22050)
+
+	buf := bytes.NewBuffer(nil)
+	at.Equal(p.Parse([]byte{0x21, 0x19}, av.AAC_RAW, buf), nil)
+
+	h, err := ParseADTSHeader(buf.Bytes())
+	at.Equal(err, nil)
+	at.Equal(h.ObjectType, ObjectTypeLC)
+	at.Equal(h.SampleRate, 22050)
+	at.Equal(h.Channels, 2)
+	at.Equal(h.FrameLength, 9)
+
+	p = NewParser()
+	at.Equal(p.Parse(ascExplicitRate, av.AAC_SEQHDR, nil), nil)
+	buf.Reset()
+	at.Equal(p.Parse([]byte{0x21, 0x19}, av.AAC_RAW, buf), nil)
+
+	h, err = ParseADTSHeader(buf.Bytes())
+	at.Equal(err, nil)
+	at.Equal(h.SampleRate, 44100)
+}
@@ -7,20 +7,11 @@ import (
 	"github.com/viderstv/common/streaming/av"
 )
 
-// type mpegExtension struct {
-// 	objectType byte
-// 	sampleRate byte
-// }
-
+// mpegCfgInfo holds the fields written into every adts header.
 type mpegCfgInfo struct {
 	objectType byte
 	sampleRate byte
 	channel    byte
-	// sbr            byte
-	// ps             byte
-	// frameLen       byte
-	// exceptionLogTs int64
-	// extension      *mpegExtension
 }
 
 var aacRates = []int{96000, 88200, 64000, 48000, 44100, 32000, 24000, 22050, 16000, 12000, 11025, 8000, 7350}
@@ -38,6 +29,7 @@ type Parser struct {
 	gettedSpecific bool
 	adtsHeader     []byte
 	cfgInfo        *mpegCfgInfo
+	config         AudioSpecificConfig
 }
 
 func NewParser() *Parser {
@@ -49,13 +41,20 @@ func NewParser() *Parser {
 }
 
 func (p *Parser) specificInfo(src []byte) error {
-	if len(src) < 2 {
-		return ErrSpecificBufInvalid
+	cfg, err := ParseAudioSpecificConfig(src)
+	if err != nil {
+		return err
 	}
 	p.gettedSpecific = true
-	p.cfgInfo.objectType = (src[0] >> 3) & 0xff
-	p.cfgInfo.sampleRate = ((src[0] & 0x07) << 1) | src[1]>>7
-	p.cfgInfo.channel = (src[1] >> 3) & 0x0f
+	p.config = cfg
+
+	// adts can only describe the core coder, sbr and ps are signaled implicitly.
+	p.cfgInfo.objectType = byte(cfg.ObjectType)
+	p.cfgInfo.sampleRate = byte(cfg.SampleRateIndex)
+	if cfg.SampleRateIndex == sampleRateIndexEscape {
+		p.cfgInfo.sampleRate = byte(rateIndex(cfg.SampleRate))
+	}
+	p.cfgInfo.channel = byte(cfg.ChannelConfig)
 	return nil
 }
 
@@ -71,7 +70,7 @@ func (p *Parser) adts(src []byte, w io.Writer) error {
 	p.adtsHeader[1] = 0xf1
 
 	p.adtsHeader[2] &= 0x00
-	p.adtsHeader[2] = p.adtsHeader[2] | (p.cfgInfo.objectType-1)<<6
+	p.adtsHeader[2] = p.adtsHeader[2] | ((p.cfgInfo.objectType-1)&0x03)<<6
 	p.adtsHeader[2] = p.adtsHeader[2] | (p.cfgInfo.sampleRate)<<2
 
 	p.adtsHeader[3] &= 0x00
@@ -95,9 +94,12 @@ func (p *Parser) adts(src []byte, w io.Writer) error {
 	return nil
 }
 
+// SampleRate returns the rate of the core coder, every raw frame carries FrameLength samples at this rate.
 func (p *Parser) SampleRate() int {
 	rate := 44100
-	if p.cfgInfo.sampleRate <= byte(len(aacRates)-1) {
+	if p.gettedSpecific && p.config.SampleRate > 0 {
+		rate = p.config.SampleRate
+	} else if p.cfgInfo.sampleRate <= byte(len(aacRates)-1) {
 		rate = aacRates[p.cfgInfo.sampleRate]
 	}
 	return rate
@@ -112,3 +114,75 @@ func (p *Parser) Parse(b []byte, packetType uint8, w io.Writer) (err error) {
 	}
 	return
 }
+
+// Config returns the AudioSpecificConfig of the last sequence header.
+func (p *Parser) Config() AudioSpecificConfig {
+	return p.config
+}
+
+func (p *Parser) ObjectType() int {
+	return p.config.AudioObjectType()
+}
+
+func (p *Parser) Channels() int {
+	return p.config.Channels
+}
+
+// ProfileName returns the profile name in the same format ffprobe reports it.
+func (p *Parser) ProfileName() string {
+	return p.config.ProfileName()
+}
+
+func profileName(objectType int) string {
+	switch objectType {
+	case 1:
+		return "Main"
+	case 2:
+		return "LC"
+	case 3:
+		return "SSR"
+	case 4:
+		return "LTP"
+	case 5:
+		return "HE-AAC"
+	case 23:
+		return "LD"
+	case 29:
+		return "HE-AACv2"
+	case 39:
+		return "ELD"
+	}
+	return fmt.Sprintf("%d", objectType)
+}
+
+type ADTSHeader struct {
+	ObjectType  int
+	SampleRate  int
+	Channels    int
+	FrameLength int
+}
+
+func (h ADTSHeader) ProfileName() string {
+	return profileName(h.ObjectType)
+}
+
+// ParseADTSHeader decodes the fixed and variable header of an adts frame.
+func ParseADTSHeader(b []byte) (ADTSHeader, error) {
+	if len(b) < adtsHeaderLen || b[0] != 0xff || b[1]&0xf0 != 0xf0 {
+		return ADTSHeader{}, ErrAudioBufInvalid
+	}
+
+	h := ADTSHeader{
+		ObjectType:  int(b[2]>>6) + 1,
+		Channels:    int(b[2]&0x01)<<2 | int(b[3]>>6),
+		FrameLength: int(b[3]&0x03)<<11 | int(b[4])<<3 | int(b[5]>>5),
+	}
+
+	index := int(b[2]>>2) & 0x0f
+	if index >= len(aacRates) {
+		return h, ErrAudioBufInvalid
+	}
+	h.SampleRate = aacRates[index]
+
+	return h, nil
+}
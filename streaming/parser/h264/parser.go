@@ -43,6 +43,7 @@ var naluAud = []byte{0x00, 0x00, 0x00, 0x01, 0x09, 0xf0}
 
 type Parser struct {
 	specificInfo []byte
+	sps          []byte
 	pps          *bytes.Buffer
 }
 
@@ -92,6 +93,7 @@ func (p *Parser) parseSpecificInfo(src []byte) error {
 	}
 	sps = append(sps, startCode...)
 	sps = append(sps, src[8:(8+seq.spsLen)]...)
+	p.sps = append(p.sps[:0], src[8:(8+seq.spsLen)]...)
 
 	//get pps
 	tmpBuf := src[(8 + seq.spsLen):]
@@ -107,12 +109,20 @@ func (p *Parser) parseSpecificInfo(src []byte) error {
 	pps = append(pps, startCode...)
 	pps = append(pps, tmpBuf[3:]...)
 
-	p.specificInfo = append(p.specificInfo, sps...)
+	p.specificInfo = append(p.specificInfo[:0], sps...)
 	p.specificInfo = append(p.specificInfo, pps...)
 
 	return nil
 }
 
+// SPS decodes the sequence parameter set from the last sequence header.
+func (p *Parser) SPS() (SPS, error) {
+	if len(p.sps) == 0 {
+		return SPS{}, ErrSpsData
+	}
+	return ParseSPS(p.sps)
+}
+
 func (p *Parser) isNaluHeader(src []byte) bool {
 	if len(src) < naluBytesLen {
 		return false
@@ -223,3 +233,27 @@ func (p *Parser) Parse(b []byte, isSeq bool, w io.Writer) (err error) {
 	}
 	return
 }
+
+// SplitAnnexB returns the nalus of an annex-b byte stream without their start codes.
+func SplitAnnexB(b []byte) [][]byte {
+	nalus := [][]byte{}
+	start := -1
+	for i := 0; i+3 <= len(b); i++ {
+		if b[i] != 0x00 || b[i+1] != 0x00 || b[i+2] != 0x01 {
+			continue
+		}
+		if start >= 0 {
+			end := i
+			if end > start && b[end-1] == 0x00 {
+				end--
+			}
+			nalus = append(nalus, b[start:end])
+		}
+		i += 2
+		start = i + 1
+	}
+	if start >= 0 && start < len(b) {
+		nalus = append(nalus, b[start:])
+	}
+	return nalus
+}
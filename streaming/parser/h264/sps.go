@@ -0,0 +1,281 @@
+package h264
+
+import (
+	"fmt"
+
+	"github.com/viderstv/common/utils/bits"
+)
+
+// SPS holds the decoded fields of a sequence parameter set.
+type SPS struct {
+	ProfileIDC      uint8
+	ConstraintFlags uint8
+	LevelIDC        uint8
+	ChromaFormatIDC uint32
+	BitDepthLuma    uint32
+	BitDepthChroma  uint32
+	FrameMbsOnly    bool
+	MaxRefFrames    uint32
+
+	Width  int
+	Height int
+
+	// SarWidth and SarHeight are the sample aspect ratio, 1:1 when not signaled.
+	SarWidth  int
+	SarHeight int
+
+	FullRange bool
+
+	// NumUnitsInTick and TimeScale are only set when the VUI carries timing info.
+	NumUnitsInTick uint32
+	TimeScale      uint32
+	FixedFrameRate bool
+}
+
+// sample aspect ratios for aspect_ratio_idc 1 through 16, Table E-1.
+var sarTable = [][2]int{
+	{1, 1}, {12, 11}, {10, 11}, {16, 11}, {40, 33}, {24, 11}, {20, 11}, {32, 11},
+	{80, 33}, {18, 11}, {15, 11}, {64, 33}, {160, 99}, {4, 3}, {3, 2}, {2, 1},
+}
+
+const extendedSAR = 255
+
+// FPS returns the frame rate from the VUI timing info or 0 if it is not signaled.
+func (s SPS) FPS() float64 {
+	if s.NumUnitsInTick == 0 || s.TimeScale == 0 {
+		return 0
+	}
+	return float64(s.TimeScale) / float64(2*s.NumUnitsInTick)
+}
+
+// Codec returns the RFC 6381 codec string, for example avc1.64001F.
+func (s SPS) Codec() string {
+	return fmt.Sprintf("avc1.%02X%02X%02X", s.ProfileIDC, s.ConstraintFlags, s.LevelIDC)
+}
+
+// ProfileName returns the profile name in the same format ffprobe reports it.
+func (s SPS) ProfileName() string {
+	switch s.ProfileIDC {
+	case 66:
+		if s.ConstraintFlags&0x40 != 0 {
+			return "Constrained Baseline"
+		}
+		return "Baseline"
+	case 77:
+		return "Main"
+	case 88:
+		return "Extended"
+	case 100:
+		return "High"
+	case 110:
+		return "High 10"
+	case 122:
+		return "High 4:2:2"
+	case 244:
+		return "High 4:4:4 Predictive"
+	}
+	return fmt.Sprintf("%d", s.ProfileIDC)
+}
+
+// unescapeRBSP removes the emulation prevention bytes (0x000003) from a nalu.
+func unescapeRBSP(src []byte) []byte {
+	dst := make([]byte, 0, len(src))
+	zeros := 0
+	for _, b := range src {
+		if zeros >= 2 && b == 0x03 {
+			zeros = 0
+			continue
+		}
+		if b == 0x00 {
+			zeros++
+		} else {
+			zeros = 0
+		}
+		dst = append(dst, b)
+	}
+	return dst
+}
+
+func skipScalingList(r *bits.Reader, size int) error {
+	last, next := int32(8), int32(8)
+	for i := 0; i < size; i++ {
+		if next != 0 {
+			delta, err := r.ReadSE()
+			if err != nil {
+				return err
+			}
+			next = (last + delta + 256) % 256
+		}
+		if next != 0 {
+			last = next
+		}
+	}
+	return nil
+}
+
+// ParseSPS decodes a sequence parameter set nalu, including the nalu header byte.
+func ParseSPS(nalu []byte) (SPS, error) {
+	sps := SPS{
+		ChromaFormatIDC: 1,
+		BitDepthLuma:    8,
+		BitDepthChroma:  8,
+		SarWidth:        1,
+		SarHeight:       1,
+	}
+	if len(nalu) < 4 || nalu[0]&0x1f != nalu_type_sps {
+		return sps, ErrSpsData
+	}
+
+	r := bits.NewReader(unescapeRBSP(nalu[1:]))
+	var err error
+	read := func(n int) uint32 {
+		if err != nil {
+			return 0
+		}
+		var v uint32
+		v, err = r.ReadBits(n)
+		return v
+	}
+	readUE := func() uint32 {
+		if err != nil {
+			return 0
+		}
+		var v uint32
+		v, err = r.ReadUE()
+		return v
+	}
+	readSE := func() int32 {
+		if err != nil {
+			return 0
+		}
+		var v int32
+		v, err = r.ReadSE()
+		return v
+	}
+
+	sps.ProfileIDC = uint8(read(8))
+	sps.ConstraintFlags = uint8(read(8))
+	sps.LevelIDC = uint8(read(8))
+	readUE() // seq_parameter_set_id
+
+	switch sps.ProfileIDC {
+	case 100, 110, 122, 244, 44, 83, 86, 118, 128, 138, 139, 134, 135:
+		sps.ChromaFormatIDC = readUE()
+		if sps.ChromaFormatIDC == 3 {
+			read(1) // separate_colour_plane_flag
+		}
+		sps.BitDepthLuma = readUE() + 8
+		sps.BitDepthChroma = readUE() + 8
+		read(1) // qpprime_y_zero_transform_bypass_flag
+		if read(1) == 1 {
+			n := 8
+			if sps.ChromaFormatIDC == 3 {
+				n = 12
+			}
+			for i := 0; i < n && err == nil; i++ {
+				if read(1) == 1 {
+					size := 16
+					if i >= 6 {
+						size = 64
+					}
+					err = skipScalingList(r, size)
+				}
+			}
+		}
+	}
+
+	readUE() // log2_max_frame_num_minus4
+	switch readUE() {
+	case 0:
+		readUE() // log2_max_pic_order_cnt_lsb_minus4
+	case 1:
+		read(1)  // delta_pic_order_always_zero_flag
+		readSE() // offset_for_non_ref_pic
+		readSE() // offset_for_top_to_bottom_field
+		n := readUE()
+		for i := uint32(0); i < n && err == nil; i++ {
+			readSE()
+		}
+	}
+	sps.MaxRefFrames = readUE()
+	read(1) // gaps_in_frame_num_value_allowed_flag
+
+	widthMbs := readUE() + 1
+	heightMapUnits := readUE() + 1
+	sps.FrameMbsOnly = read(1) == 1
+	if !sps.FrameMbsOnly {
+		read(1) // mb_adaptive_frame_field_flag
+	}
+	read(1) // direct_8x8_inference_flag
+
+	var cropLeft, cropRight, cropTop, cropBottom uint32
+	if read(1) == 1 {
+		cropLeft = readUE()
+		cropRight = readUE()
+		cropTop = readUE()
+		cropBottom = readUE()
+	}
+	if err != nil {
+		return sps, ErrSpsData
+	}
+
+	frameHeightFactor := uint32(2)
+	if sps.FrameMbsOnly {
+		frameHeightFactor = 1
+	}
+
+	cropUnitX, cropUnitY := uint32(1), frameHeightFactor
+	switch sps.ChromaFormatIDC {
+	case 1:
+		cropUnitX, cropUnitY = 2, 2*frameHeightFactor
+	case 2:
+		cropUnitX = 2
+	}
+
+	sps.Width = int(widthMbs*16 - cropUnitX*(cropLeft+cropRight))
+	sps.Height = int(frameHeightFactor*heightMapUnits*16 - cropUnitY*(cropTop+cropBottom))
+
+	if read(1) == 1 {
+		parseVUI(&sps, read, readUE)
+		if err != nil {
+			// a truncated vui only loses the optional timing info.
+			sps.NumUnitsInTick, sps.TimeScale = 0, 0
+		}
+	}
+
+	return sps, nil
+}
+
+func parseVUI(sps *SPS, read func(n int) uint32, readUE func() uint32) {
+	if read(1) == 1 {
+		idc := int(read(8))
+		if idc == extendedSAR {
+			sps.SarWidth = int(read(16))
+			sps.SarHeight = int(read(16))
+		} else if idc > 0 && idc <= len(sarTable) {
+			sps.SarWidth = sarTable[idc-1][0]
+			sps.SarHeight = sarTable[idc-1][1]
+		}
+	}
+	if read(1) == 1 {
+		read(1) // overscan_appropriate_flag
+	}
+	if read(1) == 1 {
+		read(3) // video_format
+		sps.FullRange = read(1) == 1
+		if read(1) == 1 {
+			read(8) // colour_primaries
+			read(8) // transfer_characteristics
+			read(8) // matrix_coefficients
+		}
+	}
+	if read(1) == 1 {
+		readUE() // chroma_sample_loc_type_top_field
+		readUE() // chroma_sample_loc_type_bottom_field
+	}
+	if read(1) == 1 {
+		sps.NumUnitsInTick = read(32)
+		sps.TimeScale = read(32)
+		sps.FixedFrameRate = read(1) == 1
+	}
+}
@@ -0,0 +1,75 @@
+package h264
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+var (
+	spsMain = []byte{
+		0x67, 0x4d, 0x00, 0x1e, 0xab, 0x40, 0x5a, 0x12, 0x6c, 0x09, 0x28, 0x28,
+		0x28, 0x2f, 0x80, 0x00, 0x01, 0xf4, 0x00, 0x00, 0x61, 0xa8, 0x4a,
+	}
+	spsHigh1080 = []byte{
+		0x67, 0x64, 0x00, 0x28, 0xac, 0xd9, 0x40, 0x78, 0x02, 0x27, 0xe5, 0xc0,
+		0x44, 0x00, 0x00, 0x03, 0x00, 0x04, 0x00, 0x00, 0x03, 0x00, 0xf0, 0x3c,
+		0x60, 0xc6, 0x58,
+	}
+)
+
+func TestParseSPS(t *testing.T) {
+	at := assert.New(t)
+
+	sps, err := ParseSPS(spsMain)
+	at.Equal(err, nil)
+	at.Equal(int(sps.ProfileIDC), 77)
+	at.Equal(int(sps.LevelIDC), 30)
+	at.Equal(sps.Width, 720)
+	at.Equal(sps.Height, 576)
+	at.False(sps.FrameMbsOnly)
+	at.Equal(sps.SarWidth, 12)
+	at.Equal(sps.SarHeight, 11)
+	at.Equal(sps.FPS(), float64(25))
+	at.Equal(sps.Codec(), "avc1.4D001E")
+	at.Equal(sps.ProfileName(), "Main")
+
+	sps, err = ParseSPS(spsHigh1080)
+	at.Equal(err, nil)
+	at.Equal(int(sps.ProfileIDC), 100)
+	at.Equal(int(sps.LevelIDC), 40)
+	at.Equal(sps.Width, 1920)
+	at.Equal(sps.Height, 1080)
+	at.Equal(sps.MaxRefFrames, uint32(4))
+	at.Equal(sps.FPS(), float64(30))
+	at.Equal(sps.Codec(), "avc1.640028")
+	at.Equal(sps.ProfileName(), "High")
+}
+
+func TestParseSPSInvalid(t *testing.T) {
+	at := assert.New(t)
+
+	_, err := ParseSPS([]byte{0x68, 0xde, 0x31, 0x12})
+	at.Equal(err, ErrSpsData)
+
+	_, err = ParseSPS(spsHigh1080[:6])
+	at.Equal(err, ErrSpsData)
+}
+
+func TestParserSPS(t *testing.T) {
+	at := assert.New(t)
+	seq := []byte{
+		0x01, 0x4d, 0x00, 0x1e, 0xff, 0xe1, 0x00, 0x17, 0x67, 0x4d, 0x00,
+		0x1e, 0xab, 0x40, 0x5a, 0x12, 0x6c, 0x09, 0x28, 0x28, 0x28, 0x2f,
+		0x80, 0x00, 0x01, 0xf4, 0x00, 0x00, 0x61, 0xa8, 0x4a, 0x01, 0x00,
+		0x04, 0x68, 0xde, 0x31, 0x12,
+	}
+	d := NewParser()
+	_, err := d.SPS()
+	at.Equal(err, ErrSpsData)
+
+	at.Equal(d.Parse(seq, true, nil), nil)
+	sps, err := d.SPS()
+	at.Equal(err, nil)
+	at.Equal(sps.Width, 720)
+}
@@ -0,0 +1,133 @@
+package parser
+
+import (
+	"fmt"
+	"math"
+	"strings"
+
+	"github.com/viderstv/common/streaming/parser/aac"
+	"github.com/viderstv/common/streaming/parser/h264"
+	"github.com/viderstv/common/structures"
+)
+
+// StreamInfo describes the codecs of a stream as far as they are known from the parsed packets.
+type StreamInfo struct {
+	HasVideo     bool
+	VideoCodec   string
+	VideoProfile string
+	// VideoCodecs is the RFC 6381 codec string of the video track.
+	VideoCodecs string
+	Level       int
+	Width       int
+	Height      int
+	FPS         float64
+	SarWidth    int
+	SarHeight   int
+
+	HasAudio     bool
+	AudioCodec   string
+	AudioProfile string
+	// AudioCodecs is the RFC 6381 codec string of the audio track.
+	AudioCodecs string
+	// SampleRate is the output rate, the sbr rate for HE-AAC.
+	SampleRate int
+	Channels   int
+	// ChannelLayout is the layout name as ffprobe reports it, for example stereo or 5.1.
+	ChannelLayout string
+}
+
+// Codecs returns the comma separated RFC 6381 codec string used in CODECS attributes.
+func (s StreamInfo) Codecs() string {
+	codecs := []string{}
+	if s.VideoCodecs != "" {
+		codecs = append(codecs, s.VideoCodecs)
+	}
+	if s.AudioCodecs != "" {
+		codecs = append(codecs, s.AudioCodecs)
+	}
+	return strings.Join(codecs, ",")
+}
+
+// Variant fills a muxer variant from the stream info.
+func (s StreamInfo) Variant(name string, bitrate int) structures.JwtMuxerPayloadVariant {
+	return structures.JwtMuxerPayloadVariant{
+		Name:    name,
+		Codecs:  s.Codecs(),
+		Width:   s.Width,
+		Height:  s.Height,
+		FPS:     int(math.Round(s.FPS)),
+		Bitrate: bitrate,
+	}
+}
+
+func (s StreamInfo) String() string {
+	return fmt.Sprintf("<codecs: %s, resolution: %dx%d, fps: %.2f, sample_rate: %d, channels: %d>", s.Codecs(), s.Width, s.Height, s.FPS, s.SampleRate, s.Channels)
+}
+
+// ApplySPS fills the video fields from a decoded sequence parameter set.
+func (s *StreamInfo) ApplySPS(sps h264.SPS) {
+	s.HasVideo = true
+	s.VideoCodec = "h264"
+	s.VideoProfile = sps.ProfileName()
+	s.VideoCodecs = sps.Codec()
+	s.Level = int(sps.LevelIDC)
+	s.Width = sps.Width
+	s.Height = sps.Height
+	s.FPS = sps.FPS()
+	s.SarWidth = sps.SarWidth
+	s.SarHeight = sps.SarHeight
+}
+
+// ApplyADTS fills the audio fields from an adts header.
+func (s *StreamInfo) ApplyADTS(h aac.ADTSHeader) {
+	s.HasAudio = true
+	s.AudioCodec = "aac"
+	s.AudioProfile = h.ProfileName()
+	s.AudioCodecs = fmt.Sprintf("mp4a.40.%d", h.ObjectType)
+	s.SampleRate = h.SampleRate
+	s.Channels = h.Channels
+	s.ChannelLayout = aac.ChannelLayout(h.Channels)
+	if h.Channels == 7 {
+		// channel configuration 7 is 7.1
+		s.Channels = 8
+	}
+}
+
+// ApplyAudioSpecificConfig fills the audio fields from a decoded aac sequence header.
+func (s *StreamInfo) ApplyAudioSpecificConfig(cfg aac.AudioSpecificConfig) {
+	s.HasAudio = true
+	s.AudioCodec = "aac"
+	s.AudioProfile = cfg.ProfileName()
+	s.AudioCodecs = cfg.Codec()
+	s.SampleRate = cfg.OutputSampleRate()
+	s.Channels = cfg.Channels
+	s.ChannelLayout = cfg.ChannelLayout()
+}
+
+// StreamInfo returns what is known about the stream from the sequence headers parsed so far.
+func (c *CodecParser) StreamInfo() StreamInfo {
+	info := StreamInfo{}
+
+	if c.h264 != nil {
+		if sps, err := c.h264.SPS(); err == nil {
+			info.ApplySPS(sps)
+		}
+	}
+
+	if c.aac != nil {
+		info.ApplyAudioSpecificConfig(c.aac.Config())
+	} else if c.mp3 != nil {
+		info.HasAudio = true
+		info.AudioCodec = "mp3"
+		info.AudioCodecs = "mp4a.40.34"
+		info.SampleRate = c.mp3.SampleRate()
+		info.Channels = c.mp3.Channels()
+		if info.Channels == 1 {
+			info.ChannelLayout = "mono"
+		} else {
+			info.ChannelLayout = "stereo"
+		}
+	}
+
+	return info
+}
@@ -6,6 +6,7 @@ import (
 
 type Parser struct {
 	samplingFrequency int
+	channels          int
 }
 
 func NewParser() *Parser {
@@ -27,6 +28,11 @@ func (p *Parser) Parse(src []byte) error {
 	if len(src) < 3 {
 		return errMp3DataInvalid
 	}
+	// channel_mode '11' is single channel, everything else carries two channels.
+	p.channels = 2
+	if len(src) > 3 && src[3]>>6 == 0x3 {
+		p.channels = 1
+	}
 	index := (src[2] >> 2) & 0x3
 	if index <= byte(len(mp3Rates)-1) {
 		p.samplingFrequency = mp3Rates[index]
@@ -41,3 +47,7 @@ func (p *Parser) SampleRate() int {
 	}
 	return p.samplingFrequency
 }
+
+func (p *Parser) Channels() int {
+	return p.channels
+}
@@ -0,0 +1,90 @@
+package fanout
+
+import (
+	"bufio"
+	"context"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/viderstv/common/streaming/av"
+	"github.com/viderstv/common/utils/uid"
+)
+
+// readTimeout closes a reader which did not receive a packet for that long.
+const readTimeout = time.Second * 10
+
+// Reader reads a stream from a Server, it is attached to a handler like any other publisher.
+type Reader struct {
+	av.RWBaser
+	conn net.Conn
+	br   *bufio.Reader
+	info av.Info
+
+	once   sync.Once
+	closed chan struct{}
+}
+
+// Dial connects to a Server and requests the stream of the JwtInternalRead token, the info is the one of
+// the returned reader.
+func Dial(ctx context.Context, addr string, token string, info av.Info) (*Reader, error) {
+	conn, err := (&net.Dialer{}).DialContext(ctx, "tcp", addr)
+	if err != nil {
+		return nil, err
+	}
+
+	if deadline, ok := ctx.Deadline(); ok {
+		_ = conn.SetDeadline(deadline)
+	}
+
+	br := bufio.NewReader(conn)
+	if err := writeHello(conn, token); err != nil {
+		_ = conn.Close()
+		return nil, err
+	}
+	if err := readStatus(br); err != nil {
+		_ = conn.Close()
+		return nil, err
+	}
+	_ = conn.SetDeadline(time.Time{})
+
+	if info.ID == "" {
+		info.ID = uid.NewId()
+	}
+	info.Publisher = true
+
+	return &Reader{
+		RWBaser: av.NewRWBaser(readTimeout),
+		conn:    conn,
+		br:      br,
+		info:    info,
+		closed:  make(chan struct{}),
+	}, nil
+}
+
+func (r *Reader) Read(p *av.Packet) error {
+	_ = r.conn.SetReadDeadline(time.Now().Add(readTimeout))
+	if _, err := ReadPacket(r.br, p); err != nil {
+		_ = r.Close()
+		return err
+	}
+
+	r.SetPreTime()
+	return nil
+}
+
+func (r *Reader) Info() av.Info {
+	return r.info
+}
+
+func (r *Reader) Running() <-chan struct{} {
+	return r.closed
+}
+
+func (r *Reader) Close() error {
+	r.once.Do(func() {
+		close(r.closed)
+		_ = r.conn.Close()
+	})
+	return nil
+}
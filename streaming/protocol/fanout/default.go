@@ -0,0 +1,58 @@
+package fanout
+
+import (
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/viderstv/common/streaming/av"
+	"github.com/viderstv/common/structures"
+)
+
+type Config struct {
+	// JwtSecret verifies the JwtInternalRead tokens of the clients, it is required.
+	JwtSecret string
+	// StreamInfo maps the claims of a client to the info of the stream it reads, the key of the stream in
+	// the handler is derived from it. The user id is used as the key by default, the key authenticated
+	// publishers get.
+	StreamInfo func(claims *structures.JwtInternalRead) av.Info
+	// HandshakeTimeout is the time a client has to send its token.
+	HandshakeTimeout time.Duration
+	// WriteTimeout closes a client which does not read for that long.
+	WriteTimeout time.Duration
+	// QueueSize is the number of packets queued per client, a client falling further behind is closed.
+	QueueSize int
+	Logger    logrus.FieldLogger
+}
+
+func (c Config) fill() Config {
+	if c.StreamInfo == nil {
+		c.StreamInfo = DefaultConfig.StreamInfo
+	}
+	if c.HandshakeTimeout <= 0 {
+		c.HandshakeTimeout = DefaultConfig.HandshakeTimeout
+	}
+	if c.WriteTimeout <= 0 {
+		c.WriteTimeout = DefaultConfig.WriteTimeout
+	}
+	if c.QueueSize <= 0 {
+		c.QueueSize = DefaultConfig.QueueSize
+	}
+	if c.Logger == nil {
+		c.Logger = DefaultConfig.Logger
+	}
+
+	return c
+}
+
+var DefaultConfig = Config{
+	StreamInfo: func(claims *structures.JwtInternalRead) av.Info {
+		return av.Info{
+			Key:  claims.UserID.Hex(),
+			Name: claims.UserID.Hex(),
+		}
+	},
+	HandshakeTimeout: time.Second * 5,
+	WriteTimeout:     time.Second * 10,
+	QueueSize:        1024,
+	Logger:           logrus.StandardLogger(),
+}
@@ -0,0 +1,224 @@
+package fanout
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt"
+	"github.com/stretchr/testify/assert"
+	"github.com/viderstv/common/streaming/av"
+	"github.com/viderstv/common/streaming/container/flv"
+	"github.com/viderstv/common/streaming/internal/avtest"
+	"github.com/viderstv/common/streaming/protocol/rtmp/handler"
+	"github.com/viderstv/common/structures"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+const secret = "secret"
+
+func packet(t *testing.T, video bool, ts uint32, data []byte) *av.Packet {
+	tag := &flv.Tag{}
+	if _, err := tag.ParseMediaTagHeader(data, video); err != nil {
+		t.Fatal(err)
+	}
+	return &av.Packet{IsVideo: video, IsAudio: !video, Header: tag, TimeStamp: ts, Data: data}
+}
+
+// token grants reading the stream of the user id, the stream id is another one.
+func token(t *testing.T, id primitive.ObjectID, key string) string {
+	token, err := structures.EncodeJwt(&structures.JwtInternalRead{
+		StreamID: primitive.NewObjectID(),
+		UserID:   id,
+		StandardClaims: jwt.StandardClaims{
+			ExpiresAt: time.Now().Add(time.Minute).Unix(),
+		},
+	}, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return token
+}
+
+func serve(t *testing.T, h *handler.RtmpHandler) string {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s, err := NewServer(h, Config{JwtSecret: secret})
+	if err != nil {
+		t.Fatal(err)
+	}
+	go func() {
+		_ = s.Serve(ln)
+	}()
+	t.Cleanup(func() {
+		_ = s.Shutdown()
+	})
+	return ln.Addr().String()
+}
+
+func TestFrameRoundTrip(t *testing.T) {
+	at := assert.New(t)
+
+	buf := &bytes.Buffer{}
+	seq := packet(t, true, 0, []byte{0x17, 0x00, 0x00, 0x00, 0x00, 0x01})
+	frame := packet(t, true, 40, []byte{0x27, 0x01, 0x00, 0x00, 0x28, 0x02})
+	frame.Discontinuity = true
+	audio := packet(t, false, 20, []byte{0xaf, 0x01, 0x03})
+	meta := &av.Packet{IsMetadata: true, TimeStamp: 0, Data: []byte{0x02}}
+	for _, p := range []*av.Packet{seq, frame, audio, meta} {
+		at.NoError(WritePacket(buf, p))
+	}
+
+	p := &av.Packet{}
+	flags, err := ReadPacket(buf, p)
+	at.NoError(err)
+	at.Equal(flags, FlagKeyframe|FlagCodecConfig)
+	at.True(p.IsVideo)
+	at.True(p.Header.(av.VideoPacketHeader).IsSeq())
+
+	flags, err = ReadPacket(buf, p)
+	at.NoError(err)
+	at.Equal(flags, FlagDiscontinuity)
+	at.Equal(p.TimeStamp, uint32(40))
+	at.Equal(p.Header.(av.VideoPacketHeader).CompositionTime(), int32(40))
+	at.Equal(p.Data, frame.Data)
+	at.True(p.Discontinuity)
+
+	flags, err = ReadPacket(buf, p)
+	at.NoError(err)
+	at.Equal(flags, byte(0))
+	at.True(p.IsAudio)
+	at.Equal(p.Header.(av.AudioPacketHeader).SoundFormat(), uint8(av.SOUND_AAC))
+
+	_, err = ReadPacket(buf, p)
+	at.NoError(err)
+	at.True(p.IsMetadata)
+	at.Nil(p.Header)
+
+	_, err = ReadPacket(bytes.NewReader([]byte{0xff, 0xff, 0xff, 0xff}), p)
+	at.Equal(err, ErrFrameTooLarge)
+
+	// bodies too short for their flv header are rejected
+	for _, cut := range []*av.Packet{
+		{IsAudio: true, Data: []byte{0xaf}},
+		{IsAudio: true},
+		{IsVideo: true, Data: []byte{0x17, 0x01, 0x00, 0x00}},
+	} {
+		buf.Reset()
+		at.NoError(WritePacket(buf, cut))
+		_, err = ReadPacket(buf, p)
+		at.Equal(err, ErrBadFrame)
+	}
+}
+
+func TestFanout(t *testing.T) {
+	at := assert.New(t)
+
+	id := primitive.NewObjectID()
+	h := handler.New(handler.Config{})
+	addr := serve(t, h)
+
+	r := avtest.NewReader(av.Info{ID: "publisher", Key: id.Hex(), Name: id.Hex(), Publisher: true})
+	h.HandleReader(r)
+	r.Send(t, packet(t, true, 0, []byte{0x17, 0x00, 0x00, 0x00, 0x00, 0x01}))
+	r.Send(t, packet(t, true, 0, []byte{0x17, 0x01, 0x00, 0x00, 0x00, 0x02}))
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	client, err := Dial(ctx, addr, token(t, id, secret), av.Info{Key: id.Hex()})
+	if !at.NoError(err) {
+		return
+	}
+	defer client.Close()
+
+	for i := 0; ; i++ {
+		if info, _ := h.Stream(id.Hex()); info.Viewers == 1 {
+			break
+		} else if i == 100 {
+			t.Fatal("client not attached")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	// the client starts with the codec config and the cached gop on the next packet
+	r.Send(t, packet(t, false, 20, []byte{0xaf, 0x01, 0x03}))
+	p := &av.Packet{}
+	at.NoError(client.Read(p))
+	at.True(p.Header.(av.VideoPacketHeader).IsSeq())
+	at.NoError(client.Read(p))
+	at.True(p.Header.(av.VideoPacketHeader).IsKeyFrame())
+	at.False(p.Header.(av.VideoPacketHeader).IsSeq())
+
+	at.NoError(client.Read(p))
+	at.True(p.IsAudio)
+	at.Equal(p.TimeStamp, uint32(20))
+
+	r.Send(t, packet(t, true, 40, []byte{0x27, 0x01, 0x00, 0x00, 0x00, 0x03}))
+	at.NoError(client.Read(p))
+	at.Equal(p.TimeStamp, uint32(40))
+	at.Equal(p.Data, []byte{0x27, 0x01, 0x00, 0x00, 0x00, 0x03})
+
+	// the client is closed with the stream
+	h.StopStream(id.Hex())
+	at.Error(client.Read(p))
+}
+
+func TestServerNoSecret(t *testing.T) {
+	_, err := NewServer(handler.New(handler.Config{}), Config{})
+	assert.Equal(t, err, ErrNoSecret)
+}
+
+func TestFanoutRejected(t *testing.T) {
+	at := assert.New(t)
+
+	id := primitive.NewObjectID()
+	h := handler.New(handler.Config{})
+	addr := serve(t, h)
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+
+	_, err := Dial(ctx, addr, token(t, id, "other"), av.Info{})
+	var serr *StatusError
+	if at.True(errors.As(err, &serr)) {
+		at.Equal(serr.Status, StatusUnauthorized)
+	}
+
+	_, err = Dial(ctx, addr, token(t, id, secret), av.Info{})
+	if at.True(errors.As(err, &serr)) {
+		at.Equal(serr.Status, StatusNotFound)
+	}
+}
+
+func TestReaderTruncated(t *testing.T) {
+	at := assert.New(t)
+
+	buf := bytes.NewBuffer(nil)
+	at.NoError(WritePacket(buf, packet(t, false, 0, []byte{0xaf, 0x01, 0x03})))
+	at.NoError(WritePacket(buf, packet(t, false, 20, []byte{0xaf, 0x01, 0x03})))
+
+	server, conn := net.Pipe()
+	go func() {
+		// the server goes away within the second frame
+		_, _ = server.Write(buf.Bytes()[:buf.Len()-2])
+		_ = server.Close()
+	}()
+	r := &Reader{
+		RWBaser: av.NewRWBaser(readTimeout),
+		conn:    conn,
+		br:      bufio.NewReader(conn),
+		closed:  make(chan struct{}),
+	}
+
+	p := &av.Packet{}
+	at.NoError(r.Read(p))
+	// a cut frame is an error, not the end of the stream
+	at.Equal(r.Read(p), io.ErrUnexpectedEOF)
+}
@@ -0,0 +1,227 @@
+package fanout
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+
+	"github.com/viderstv/common/streaming/av"
+	"github.com/viderstv/common/streaming/container/flv"
+)
+
+// The protocol starts with a hello from the client, the magic, the version and a JwtInternalRead token
+// prefixed with its uint16 length. The server answers with a status byte and a uint16 length prefixed
+// message, then sends the stream as frames:
+//
+//	uint32 length of the rest of the frame
+//	uint8  kind, audio, video or metadata
+//	uint8  flags, keyframe, codec config and discontinuity
+//	uint32 timestamp in milliseconds
+//	int32  composition time in milliseconds
+//	       the flv tag body
+//
+// Codec config frames carry the AVC and AAC sequence headers, they are sent to every client before the
+// cached GOP.
+const (
+	magic   = "VFAN"
+	version = 1
+
+	frameHeaderLen = 10
+	// maxFrameLen rejects corrupted lengths before allocating them.
+	maxFrameLen = 16 << 20
+)
+
+const (
+	kindAudio byte = iota + 1
+	kindVideo
+	kindMetadata
+)
+
+const (
+	FlagKeyframe byte = 1 << iota
+	FlagCodecConfig
+	FlagDiscontinuity
+)
+
+const (
+	StatusOK byte = iota
+	StatusUnauthorized
+	StatusNotFound
+)
+
+var (
+	ErrBadMagic      = fmt.Errorf("fanout: bad magic")
+	ErrBadVersion    = fmt.Errorf("fanout: unsupported version")
+	ErrFrameTooLarge = fmt.Errorf("fanout: frame too large")
+	ErrBadFrame      = fmt.Errorf("fanout: bad frame")
+)
+
+// StatusError is returned by Dial when the server rejected the request.
+type StatusError struct {
+	Status  byte
+	Message string
+}
+
+func (e *StatusError) Error() string {
+	return "fanout: " + e.Message
+}
+
+func writeString(w io.Writer, s string) error {
+	if len(s) > 0xffff {
+		return ErrFrameTooLarge
+	}
+	b := make([]byte, 2+len(s))
+	binary.BigEndian.PutUint16(b, uint16(len(s)))
+	copy(b[2:], s)
+	_, err := w.Write(b)
+	return err
+}
+
+func readString(r io.Reader) (string, error) {
+	var b [2]byte
+	if _, err := io.ReadFull(r, b[:]); err != nil {
+		return "", err
+	}
+	s := make([]byte, binary.BigEndian.Uint16(b[:]))
+	if _, err := io.ReadFull(r, s); err != nil {
+		return "", err
+	}
+	return string(s), nil
+}
+
+func writeHello(w io.Writer, token string) error {
+	if _, err := w.Write(append([]byte(magic), version)); err != nil {
+		return err
+	}
+	return writeString(w, token)
+}
+
+func readHello(r io.Reader) (string, error) {
+	var b [len(magic) + 1]byte
+	if _, err := io.ReadFull(r, b[:]); err != nil {
+		return "", err
+	}
+	if string(b[:len(magic)]) != magic {
+		return "", ErrBadMagic
+	}
+	if b[len(magic)] != version {
+		return "", ErrBadVersion
+	}
+	return readString(r)
+}
+
+func writeStatus(w io.Writer, status byte, message string) error {
+	if _, err := w.Write([]byte{status}); err != nil {
+		return err
+	}
+	return writeString(w, message)
+}
+
+func readStatus(r io.Reader) error {
+	var b [1]byte
+	if _, err := io.ReadFull(r, b[:]); err != nil {
+		return err
+	}
+	message, err := readString(r)
+	if err != nil {
+		return err
+	}
+	if b[0] != StatusOK {
+		return &StatusError{Status: b[0], Message: message}
+	}
+	return nil
+}
+
+// WritePacket writes a packet as a frame.
+func WritePacket(w io.Writer, p *av.Packet) error {
+	if len(p.Data) > maxFrameLen-frameHeaderLen {
+		return ErrFrameTooLarge
+	}
+
+	b := make([]byte, 4+frameHeaderLen, 4+frameHeaderLen+len(p.Data))
+	binary.BigEndian.PutUint32(b, uint32(frameHeaderLen+len(p.Data)))
+
+	var flags byte
+	switch {
+	case p.IsVideo:
+		b[4] = kindVideo
+		if vh, ok := p.Header.(av.VideoPacketHeader); ok {
+			if vh.IsKeyFrame() {
+				flags |= FlagKeyframe
+			}
+			if vh.IsSeq() {
+				flags |= FlagCodecConfig
+			}
+			binary.BigEndian.PutUint32(b[10:], uint32(vh.CompositionTime()))
+		}
+	case p.IsAudio:
+		b[4] = kindAudio
+		if ah, ok := p.Header.(av.AudioPacketHeader); ok && ah.SoundFormat() == av.SOUND_AAC && ah.AACPacketType() == av.AAC_SEQHDR {
+			flags |= FlagCodecConfig
+		}
+	default:
+		b[4] = kindMetadata
+	}
+	if p.Discontinuity {
+		flags |= FlagDiscontinuity
+	}
+	b[5] = flags
+	binary.BigEndian.PutUint32(b[6:], p.TimeStamp)
+
+	_, err := w.Write(append(b, p.Data...))
+	return err
+}
+
+// ReadPacket reads a frame into p, the header of audio and video is parsed from the flv tag body.
+// It returns the flags of the frame.
+func ReadPacket(r io.Reader, p *av.Packet) (byte, error) {
+	var b [4 + frameHeaderLen]byte
+	if _, err := io.ReadFull(r, b[:4]); err != nil {
+		return 0, err
+	}
+	n := binary.BigEndian.Uint32(b[:4])
+	if n > maxFrameLen {
+		return 0, ErrFrameTooLarge
+	}
+	if n < frameHeaderLen {
+		return 0, ErrBadFrame
+	}
+	if _, err := io.ReadFull(r, b[4:]); err != nil {
+		return 0, err
+	}
+
+	data := make([]byte, n-frameHeaderLen)
+	if _, err := io.ReadFull(r, data); err != nil {
+		return 0, err
+	}
+
+	kind, flags := b[4], b[5]
+	*p = av.Packet{
+		IsAudio:       kind == kindAudio,
+		IsVideo:       kind == kindVideo,
+		IsMetadata:    kind == kindMetadata,
+		TimeStamp:     binary.BigEndian.Uint32(b[6:]),
+		Data:          data,
+		Discontinuity: flags&FlagDiscontinuity != 0,
+	}
+	if !p.IsAudio && !p.IsVideo && !p.IsMetadata {
+		return 0, ErrBadFrame
+	}
+	if p.IsMetadata {
+		return flags, nil
+	}
+	// the header is parsed from the body, aac needs its packet type and avc its packet type and composition time.
+	switch {
+	case p.IsVideo && len(data) < 5,
+		p.IsAudio && len(data) < 1,
+		p.IsAudio && data[0]>>4 == av.SOUND_AAC && len(data) < 2:
+		return 0, ErrBadFrame
+	}
+
+	tag := &flv.Tag{}
+	if _, err := tag.ParseMediaTagHeader(data, p.IsVideo); err != nil {
+		return 0, err
+	}
+	p.Header = tag
+	return flags, nil
+}
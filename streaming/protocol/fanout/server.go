@@ -0,0 +1,223 @@
+package fanout
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/viderstv/common/streaming/av"
+	"github.com/viderstv/common/streaming/protocol/rtmp/handler"
+	"github.com/viderstv/common/structures"
+	"github.com/viderstv/common/utils/uid"
+)
+
+// Server serves the streams of a handler to other pods, every client is attached to its stream as a viewer.
+type Server struct {
+	handler *handler.RtmpHandler
+	config  Config
+
+	once     sync.Once
+	lnMtx    sync.Mutex
+	lns      []net.Listener
+	shutdown chan struct{}
+}
+
+// ErrNoSecret is returned by NewServer without a JwtSecret, tokens signed with an empty key are trivial to forge.
+var ErrNoSecret = fmt.Errorf("fanout: no jwt secret configured")
+
+func NewServer(h *handler.RtmpHandler, config Config) (*Server, error) {
+	if config.JwtSecret == "" {
+		return nil, ErrNoSecret
+	}
+
+	return &Server{
+		handler:  h,
+		config:   config.fill(),
+		shutdown: make(chan struct{}),
+	}, nil
+}
+
+// Shutdown stops accepting clients and closes the listeners, the attached clients are closed with their streams.
+func (s *Server) Shutdown() error {
+	s.once.Do(func() {
+		close(s.shutdown)
+	})
+
+	s.lnMtx.Lock()
+	defer s.lnMtx.Unlock()
+	var err error
+	for _, ln := range s.lns {
+		if e := ln.Close(); e != nil && err == nil {
+			err = e
+		}
+	}
+	return err
+}
+
+func (s *Server) Serve(ln net.Listener) error {
+	s.lnMtx.Lock()
+	s.lns = append(s.lns, ln)
+	s.lnMtx.Unlock()
+
+	for {
+		conn, err := ln.Accept()
+		if err != nil {
+			select {
+			case <-s.shutdown:
+				return nil
+			default:
+				return err
+			}
+		}
+		select {
+		case <-s.shutdown:
+			_ = conn.Close()
+			continue
+		default:
+		}
+		go s.handleConn(conn)
+	}
+}
+
+func (s *Server) handleConn(conn net.Conn) {
+	defer func() {
+		if err := recover(); err != nil {
+			s.config.Logger.Error("panic in fanout handleConn: ", err)
+			_ = conn.Close()
+		}
+	}()
+
+	info, status, err := s.accept(conn)
+	if err != nil {
+		s.config.Logger.Debugf("fanout client %s rejected: %s", conn.RemoteAddr(), err)
+		if status != StatusOK {
+			_ = conn.SetWriteDeadline(time.Now().Add(s.config.HandshakeTimeout))
+			_ = writeStatus(conn, status, err.Error())
+		}
+		_ = conn.Close()
+		return
+	}
+
+	_ = conn.SetDeadline(time.Time{})
+	if err := writeStatus(conn, StatusOK, ""); err != nil {
+		_ = conn.Close()
+		return
+	}
+
+	w := newWriter(conn, info, s.config)
+	go w.run()
+	s.handler.HandleWriter(w)
+}
+
+func (s *Server) accept(conn net.Conn) (av.Info, byte, error) {
+	_ = conn.SetDeadline(time.Now().Add(s.config.HandshakeTimeout))
+	token, err := readHello(conn)
+	if err != nil {
+		return av.Info{}, StatusOK, err
+	}
+
+	claims := &structures.JwtInternalRead{}
+	if err := structures.DecodeJwt(claims, s.config.JwtSecret, token); err != nil {
+		return av.Info{}, StatusUnauthorized, fmt.Errorf("unauthorized")
+	}
+
+	info := s.config.StreamInfo(claims)
+	info.ID = uid.NewId()
+	info.Publisher = false
+	if _, ok := s.handler.Stream(s.handler.Key(info)); !ok {
+		return av.Info{}, StatusNotFound, fmt.Errorf("stream not found")
+	}
+
+	return info, StatusOK, nil
+}
+
+// writer is the viewer of a client, packets are queued and written by run so a slow client never blocks the stream.
+type writer struct {
+	av.RWBaser
+	conn   net.Conn
+	info   av.Info
+	config Config
+
+	packets chan *av.Packet
+	once    sync.Once
+	closed  chan struct{}
+}
+
+func newWriter(conn net.Conn, info av.Info, config Config) *writer {
+	return &writer{
+		RWBaser: av.NewRWBaser(config.WriteTimeout),
+		conn:    conn,
+		info:    info,
+		config:  config,
+		packets: make(chan *av.Packet, config.QueueSize),
+		closed:  make(chan struct{}),
+	}
+}
+
+func (w *writer) run() {
+	defer w.Close()
+
+	// the client never sends after the hello, reading detects it going away.
+	go func() {
+		_, _ = io.Copy(io.Discard, w.conn)
+		_ = w.Close()
+	}()
+
+	bw := bufio.NewWriter(w.conn)
+	for {
+		var p *av.Packet
+		select {
+		case <-w.closed:
+			return
+		case p = <-w.packets:
+		}
+
+		_ = w.conn.SetWriteDeadline(time.Now().Add(w.config.WriteTimeout))
+		if err := WritePacket(bw, p); err != nil {
+			return
+		}
+		if len(w.packets) == 0 {
+			if err := bw.Flush(); err != nil {
+				return
+			}
+		}
+		w.SetPreTime()
+	}
+}
+
+func (w *writer) Write(p *av.Packet) error {
+	select {
+	case <-w.closed:
+		return io.ErrClosedPipe
+	default:
+	}
+
+	select {
+	case w.packets <- p:
+		return nil
+	default:
+		// the client lags behind by a full queue, it reconnects and starts over at the next keyframe.
+		w.config.Logger.Warnf("fanout client %s is too slow, closing", w.conn.RemoteAddr())
+		_ = w.Close()
+		return io.ErrShortWrite
+	}
+}
+
+func (w *writer) Info() av.Info {
+	return w.info
+}
+
+func (w *writer) Running() <-chan struct{} {
+	return w.closed
+}
+
+func (w *writer) Close() error {
+	w.once.Do(func() {
+		close(w.closed)
+		_ = w.conn.Close()
+	})
+	return nil
+}
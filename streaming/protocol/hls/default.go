@@ -4,13 +4,23 @@ import (
 	"time"
 
 	"github.com/sirupsen/logrus"
+	"github.com/viderstv/common/streaming/av"
 	"github.com/viderstv/common/streaming/protocol/hls/cache"
+	"github.com/viderstv/common/streaming/protocol/hls/item"
 )
 
 type Config struct {
 	MinSegmentDuration time.Duration
 	Logger             logrus.FieldLogger
 	Cache              *cache.Cache
+	// MaxAVDrift enables audio timestamp correction, once audio drifts from video by more than this
+	// the audio timeline is moved back in small steps. Zero only measures the drift.
+	MaxAVDrift time.Duration
+	// Metrics measures the finished segments and the drift of the open sources when set, one Metrics can be
+	// shared by all sources.
+	Metrics *Metrics
+	// OnSegment is called with every finished segment.
+	OnSegment func(info av.Info, segment *item.Item)
 }
 
 func (c Config) fill() Config {
@@ -20,6 +30,9 @@ func (c Config) fill() Config {
 	if c.Logger == nil {
 		c.Logger = DefaultConfig.Logger
 	}
+	if c.OnSegment == nil {
+		c.OnSegment = DefaultConfig.OnSegment
+	}
 	if c.MinSegmentDuration == 0 {
 		c.MinSegmentDuration = DefaultConfig.MinSegmentDuration
 	}
@@ -30,4 +43,5 @@ func (c Config) fill() Config {
 var DefaultConfig = Config{
 	MinSegmentDuration: time.Second,
 	Logger:             logrus.StandardLogger(),
+	OnSegment:          func(info av.Info, segment *item.Item) {},
 }
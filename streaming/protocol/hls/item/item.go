@@ -17,6 +17,11 @@ type Item struct {
 	duration time.Duration
 	start    time.Time
 
+	// discontinuity is set on the first segment after the timeline was rebased, discontinuitySeq counts
+	// the discontinuities up to this segment, its own included.
+	discontinuity    bool
+	discontinuitySeq int
+
 	size *int32
 
 	data *buffer.Buffer
@@ -65,6 +70,21 @@ func (i *Item) SetDuration(dur time.Duration) {
 	i.duration = dur
 }
 
+// SetDiscontinuity marks the segment to be preceded by EXT-X-DISCONTINUITY, seq is the discontinuity
+// sequence number it starts.
+func (i *Item) SetDiscontinuity(discontinuity bool, seq int) {
+	i.discontinuity = discontinuity
+	i.discontinuitySeq = seq
+}
+
+func (i *Item) Discontinuity() bool {
+	return i.discontinuity
+}
+
+func (i *Item) DiscontinuitySeq() int {
+	return i.discontinuitySeq
+}
+
 func (i *Item) Name() string {
 	return i.name
 }
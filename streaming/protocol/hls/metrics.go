@@ -0,0 +1,86 @@
+package hls
+
+import (
+	"sync"
+	"time"
+
+	"github.com/viderstv/common/streaming/metrics"
+)
+
+var (
+	segmentDurationBuckets = []float64{0.5, 1, 2, 3, 4, 5, 6, 8, 10, 15, 20}
+	segmentSizeBuckets     = []float64{64 << 10, 256 << 10, 512 << 10, 1 << 20, 2 << 20, 4 << 20, 8 << 20, 16 << 20}
+)
+
+// Metrics measures the segments of the sources sharing it through Config.Metrics, it is a metrics.Collector.
+// The audio and video drift of the open sources is reported per stream.
+type Metrics struct {
+	durations       *metrics.Histogram
+	sizes           *metrics.Histogram
+	discontinuities metrics.Counter
+
+	sourcesMtx sync.Mutex
+	sources    map[*Source]struct{}
+}
+
+func NewMetrics() *Metrics {
+	return &Metrics{
+		durations: metrics.NewHistogram(segmentDurationBuckets...),
+		sizes:     metrics.NewHistogram(segmentSizeBuckets...),
+		sources:   map[*Source]struct{}{},
+	}
+}
+
+func (m *Metrics) addSource(s *Source) {
+	m.sourcesMtx.Lock()
+	m.sources[s] = struct{}{}
+	m.sourcesMtx.Unlock()
+}
+
+func (m *Metrics) removeSource(s *Source) {
+	m.sourcesMtx.Lock()
+	delete(m.sources, s)
+	m.sourcesMtx.Unlock()
+}
+
+func (m *Metrics) observeSegment(duration time.Duration, size int, discontinuity bool) {
+	m.durations.Observe(duration.Seconds())
+	m.sizes.Observe(float64(size))
+	if discontinuity {
+		m.discontinuities.Inc()
+	}
+}
+
+func (m *Metrics) Collect() []metrics.Family {
+	drift := metrics.Family{
+		Name: "hls_av_drift_seconds",
+		Help: "Change of the audio to video offset since the first segment, positive when audio moves ahead.",
+		Type: metrics.TypeGauge,
+	}
+	m.sourcesMtx.Lock()
+	for s := range m.sources {
+		info := s.Info()
+		drift.Samples = append(drift.Samples, metrics.Sample{
+			Labels: metrics.Labels("key", info.Key, "app", info.App, "name", info.Name),
+			Value:  s.SyncStats().Drift.Seconds(),
+		})
+	}
+	m.sourcesMtx.Unlock()
+
+	return []metrics.Family{drift, {
+		Name:    "hls_segment_duration_seconds",
+		Help:    "Duration of the finished HLS segments.",
+		Type:    metrics.TypeHistogram,
+		Samples: m.durations.Samples(),
+	}, {
+		Name:    "hls_segment_size_bytes",
+		Help:    "Size of the finished HLS segments.",
+		Type:    metrics.TypeHistogram,
+		Samples: m.sizes.Samples(),
+	}, {
+		Name:    "hls_discontinuities_total",
+		Help:    "HLS segments starting a new timeline.",
+		Type:    metrics.TypeCounter,
+		Samples: []metrics.Sample{m.discontinuities.Sample()},
+	}}
+}
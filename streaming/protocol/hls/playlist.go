@@ -0,0 +1,43 @@
+package hls
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"math"
+
+	"github.com/viderstv/common/streaming/protocol/hls/item"
+)
+
+// WritePlaylist writes the live media playlist of items, uri returns the uri of a segment.
+// Segments without a duration are still being written and left out, discontinuities are marked
+// with EXT-X-DISCONTINUITY.
+func WritePlaylist(w io.Writer, items []*item.Item, uri func(i *item.Item) string) error {
+	segments := make([]*item.Item, 0, len(items))
+	target := 1.0
+	for _, i := range items {
+		if i == nil || i.Duration() <= 0 {
+			continue
+		}
+		segments = append(segments, i)
+		target = math.Max(target, math.Ceil(i.Duration().Seconds()))
+	}
+
+	bw := bufio.NewWriter(w)
+	fmt.Fprintf(bw, "#EXTM3U\n#EXT-X-VERSION:3\n#EXT-X-TARGETDURATION:%d\n", int(target))
+	if len(segments) != 0 {
+		fmt.Fprintf(bw, "#EXT-X-MEDIA-SEQUENCE:%d\n", segments[0].SeqNum())
+		if seq := segments[0].DiscontinuitySeq(); seq != 0 {
+			fmt.Fprintf(bw, "#EXT-X-DISCONTINUITY-SEQUENCE:%d\n", seq)
+		}
+	}
+	for n, i := range segments {
+		// the discontinuity of the first segment is counted by the discontinuity sequence.
+		if i.Discontinuity() && n != 0 {
+			fmt.Fprint(bw, "#EXT-X-DISCONTINUITY\n")
+		}
+		fmt.Fprintf(bw, "#EXTINF:%.3f,\n%s\n", i.Duration().Seconds(), uri(i))
+	}
+
+	return bw.Flush()
+}
@@ -0,0 +1,45 @@
+package hls
+
+import (
+	"bytes"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/viderstv/common/streaming/protocol/hls/item"
+)
+
+func TestWritePlaylist(t *testing.T) {
+	at := assert.New(t)
+
+	items := []*item.Item{}
+	for seq := 3; seq < 7; seq++ {
+		i := item.New(fmt.Sprintf("seg%d", seq), seq)
+		i.SetDiscontinuity(false, 1)
+		items = append(items, i)
+	}
+	items[0].SetDiscontinuity(true, 1)
+	items[0].SetDuration(2 * time.Second)
+	items[1].SetDuration(2500 * time.Millisecond)
+	items[2].SetDiscontinuity(true, 2)
+	items[2].SetDuration(2 * time.Second)
+
+	buf := bytes.NewBuffer(nil)
+	at.Equal(WritePlaylist(buf, items, func(i *item.Item) string {
+		return i.Name() + ".ts"
+	}), nil)
+	at.Equal(buf.String(), `#EXTM3U
+#EXT-X-VERSION:3
+#EXT-X-TARGETDURATION:3
+#EXT-X-MEDIA-SEQUENCE:3
+#EXT-X-DISCONTINUITY-SEQUENCE:1
+#EXTINF:2.000,
+seg3.ts
+#EXTINF:2.500,
+seg4.ts
+#EXT-X-DISCONTINUITY
+#EXTINF:2.000,
+seg5.ts
+`)
+}
@@ -0,0 +1,34 @@
+package sign
+
+import (
+	"time"
+)
+
+type Config struct {
+	// Key is the shared secret used to sign playlist tokens and segment signatures.
+	Key string
+	// PlaylistTTL is how long a playlist token is valid for.
+	PlaylistTTL time.Duration
+	// SegmentTTL is how long a signed segment url is valid for after the playlist was served.
+	SegmentTTL time.Duration
+	// BindIP binds tokens and segment signatures to the ip of the viewer.
+	BindIP bool
+	// TrustForwardedFor uses the first address in X-Forwarded-For as the viewer ip.
+	TrustForwardedFor bool
+}
+
+func (c Config) fill() Config {
+	if c.PlaylistTTL <= 0 {
+		c.PlaylistTTL = DefaultConfig.PlaylistTTL
+	}
+	if c.SegmentTTL <= 0 {
+		c.SegmentTTL = DefaultConfig.SegmentTTL
+	}
+
+	return c
+}
+
+var DefaultConfig = Config{
+	PlaylistTTL: time.Minute * 5,
+	SegmentTTL:  time.Minute,
+}
@@ -0,0 +1,88 @@
+package sign
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"strings"
+
+	"github.com/viderstv/common/errors"
+	"github.com/viderstv/common/structures"
+	"github.com/viderstv/common/utils"
+)
+
+const (
+	requestKey utils.Key = "hls-sign-request"
+	claimsKey  utils.Key = "hls-sign-claims"
+)
+
+// RequestParser extracts the channel, stream and segment from an incoming http request.
+type RequestParser func(r *http.Request) (Request, error)
+
+// Middleware rejects any playlist or segment request which is not signed for the viewer making it.
+func (s *Signer) Middleware(parse RequestParser, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		req, err := parse(r)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusNotFound)
+			return
+		}
+
+		ip := s.ClientIP(r)
+		query := r.URL.Query()
+		ctx := context.WithValue(r.Context(), requestKey, req)
+
+		if req.IsPlaylist() {
+			claims, err := s.VerifyPlaylist(query.Get(QueryToken), req, ip)
+			if err != nil {
+				http.Error(w, err.Error(), statusCode(err))
+				return
+			}
+			ctx = context.WithValue(ctx, claimsKey, claims)
+		} else if err := s.VerifySegment(query, req, ip); err != nil {
+			http.Error(w, err.Error(), statusCode(err))
+			return
+		}
+
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+// ClientIP returns the ip of the viewer which is used for ip binding.
+func (s *Signer) ClientIP(r *http.Request) string {
+	if s.config.TrustForwardedFor {
+		if fwd := r.Header.Get("X-Forwarded-For"); fwd != "" {
+			return strings.TrimSpace(strings.SplitN(fwd, ",", 2)[0])
+		}
+	}
+
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+
+	return host
+}
+
+// RequestFromContext returns the verified request.
+func RequestFromContext(ctx context.Context) (Request, bool) {
+	req, ok := ctx.Value(requestKey).(Request)
+	return req, ok
+}
+
+// ClaimsFromContext returns the verified playlist claims, which are only set for playlist requests.
+func ClaimsFromContext(ctx context.Context) (structures.JwtWatchStream, bool) {
+	claims, ok := ctx.Value(claimsKey).(structures.JwtWatchStream)
+	return claims, ok
+}
+
+func statusCode(err error) int {
+	switch err {
+	case errors.ErrSignatureMissing:
+		return http.StatusUnauthorized
+	case errors.ErrSignatureExpired, errors.ErrSignatureInvalid, errors.ErrSignatureMismatch:
+		return http.StatusForbidden
+	}
+
+	return http.StatusInternalServerError
+}
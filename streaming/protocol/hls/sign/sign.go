@@ -0,0 +1,158 @@
+package sign
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/golang-jwt/jwt"
+	"github.com/viderstv/common/errors"
+	"github.com/viderstv/common/structures"
+	"github.com/viderstv/common/utils"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+const (
+	QueryToken     = "token"
+	QueryUser      = "u"
+	QueryExpiry    = "e"
+	QuerySignature = "sig"
+)
+
+// Request describes what a viewer is asking for, a playlist when Segment is empty.
+type Request struct {
+	ChannelID primitive.ObjectID
+	StreamID  primitive.ObjectID
+	Segment   string
+}
+
+func (r Request) IsPlaylist() bool {
+	return r.Segment == ""
+}
+
+type Signer struct {
+	config     Config
+	segmentKey []byte
+}
+
+func New(config Config) *Signer {
+	config = config.fill()
+
+	// segments are signed with a key derived from the jwt key so a leaked segment signature
+	// can never be replayed as a playlist token.
+	mac := hmac.New(sha256.New, utils.S2B(config.Key))
+	_, _ = mac.Write([]byte("hls-segment"))
+
+	return &Signer{
+		config:     config,
+		segmentKey: mac.Sum(nil),
+	}
+}
+
+// PlaylistToken creates a short lived JwtWatchStream token for a viewer.
+func (s *Signer) PlaylistToken(channelID, streamID, userID primitive.ObjectID, ip string) (string, error) {
+	claims := structures.JwtWatchStream{
+		ChannelID: channelID,
+		StreamID:  streamID,
+		UserID:    userID,
+		StandardClaims: jwt.StandardClaims{
+			IssuedAt:  time.Now().Unix(),
+			ExpiresAt: time.Now().Add(s.config.PlaylistTTL).Unix(),
+		},
+	}
+	if s.config.BindIP {
+		claims.ViewerIP = ip
+	}
+
+	return structures.EncodeJwt(claims, s.config.Key)
+}
+
+// VerifyPlaylist decodes the playlist token and checks it against the request and the viewer ip.
+func (s *Signer) VerifyPlaylist(token string, req Request, ip string) (structures.JwtWatchStream, error) {
+	claims := structures.JwtWatchStream{}
+	if token == "" {
+		return claims, errors.ErrSignatureMissing
+	}
+
+	if err := structures.DecodeJwt(&claims, s.config.Key, token); err != nil {
+		if v, ok := err.(*jwt.ValidationError); ok && v.Errors&jwt.ValidationErrorExpired != 0 {
+			return claims, errors.ErrSignatureExpired
+		}
+		return claims, errors.ErrSignatureInvalid
+	}
+
+	if claims.ChannelID != req.ChannelID || claims.StreamID != req.StreamID {
+		return claims, errors.ErrSignatureMismatch
+	}
+
+	if s.config.BindIP && claims.ViewerIP != ip {
+		return claims, errors.ErrSignatureMismatch
+	}
+
+	return claims, nil
+}
+
+// SignSegment returns the query which must be appended to a segment url in a playlist
+// served to the viewer the claims belong to.
+func (s *Signer) SignSegment(claims structures.JwtWatchStream, segment string) url.Values {
+	expiry := time.Now().Add(s.config.SegmentTTL).Unix()
+
+	query := url.Values{}
+	query.Set(QueryUser, claims.UserID.Hex())
+	query.Set(QueryExpiry, strconv.FormatInt(expiry, 10))
+	query.Set(QuerySignature, s.segmentSignature(Request{
+		ChannelID: claims.ChannelID,
+		StreamID:  claims.StreamID,
+		Segment:   segment,
+	}, claims.UserID.Hex(), expiry, claims.ViewerIP))
+
+	return query
+}
+
+// VerifySegment checks the signature of a segment request.
+func (s *Signer) VerifySegment(query url.Values, req Request, ip string) error {
+	sig := query.Get(QuerySignature)
+	if sig == "" {
+		return errors.ErrSignatureMissing
+	}
+
+	expiry, err := strconv.ParseInt(query.Get(QueryExpiry), 10, 64)
+	if err != nil {
+		return errors.ErrSignatureInvalid
+	}
+
+	if !s.config.BindIP {
+		ip = ""
+	}
+
+	expected := s.segmentSignature(req, query.Get(QueryUser), expiry, ip)
+	if !hmac.Equal(utils.S2B(sig), utils.S2B(expected)) {
+		return errors.ErrSignatureInvalid
+	}
+
+	if time.Now().Unix() > expiry {
+		return errors.ErrSignatureExpired
+	}
+
+	return nil
+}
+
+func (s *Signer) segmentSignature(req Request, userID string, expiry int64, ip string) string {
+	mac := hmac.New(sha256.New, s.segmentKey)
+	_, _ = mac.Write([]byte(req.ChannelID.Hex()))
+	_, _ = mac.Write([]byte{0})
+	_, _ = mac.Write([]byte(req.StreamID.Hex()))
+	_, _ = mac.Write([]byte{0})
+	_, _ = mac.Write([]byte(req.Segment))
+	_, _ = mac.Write([]byte{0})
+	_, _ = mac.Write([]byte(userID))
+	_, _ = mac.Write([]byte{0})
+	_, _ = mac.Write([]byte(strconv.FormatInt(expiry, 10)))
+	_, _ = mac.Write([]byte{0})
+	_, _ = mac.Write([]byte(ip))
+
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
@@ -0,0 +1,82 @@
+package sign
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/viderstv/common/errors"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func TestPlaylistToken(t *testing.T) {
+	at := assert.New(t)
+	s := New(Config{Key: "secret", BindIP: true})
+
+	req := Request{ChannelID: primitive.NewObjectID(), StreamID: primitive.NewObjectID()}
+	token, err := s.PlaylistToken(req.ChannelID, req.StreamID, primitive.NewObjectID(), "10.0.0.1")
+	at.Equal(err, nil)
+
+	_, err = s.VerifyPlaylist(token, req, "10.0.0.1")
+	at.Equal(err, nil)
+
+	_, err = s.VerifyPlaylist(token, req, "10.0.0.2")
+	at.Equal(err, errors.ErrSignatureMismatch)
+
+	_, err = s.VerifyPlaylist(token, Request{ChannelID: req.ChannelID, StreamID: primitive.NewObjectID()}, "10.0.0.1")
+	at.Equal(err, errors.ErrSignatureMismatch)
+
+	_, err = New(Config{Key: "other"}).VerifyPlaylist(token, req, "10.0.0.1")
+	at.Equal(err, errors.ErrSignatureInvalid)
+
+	_, err = s.VerifyPlaylist("", req, "10.0.0.1")
+	at.Equal(err, errors.ErrSignatureMissing)
+}
+
+func TestSegmentSignature(t *testing.T) {
+	at := assert.New(t)
+	s := New(Config{Key: "secret", BindIP: true})
+
+	req := Request{ChannelID: primitive.NewObjectID(), StreamID: primitive.NewObjectID()}
+	token, _ := s.PlaylistToken(req.ChannelID, req.StreamID, primitive.NewObjectID(), "10.0.0.1")
+	claims, err := s.VerifyPlaylist(token, req, "10.0.0.1")
+	at.Equal(err, nil)
+
+	query := s.SignSegment(claims, "segment-1")
+	req.Segment = "segment-1"
+	at.Equal(s.VerifySegment(query, req, "10.0.0.1"), nil)
+	at.Equal(s.VerifySegment(query, req, "10.0.0.2"), errors.ErrSignatureInvalid)
+
+	req.Segment = "segment-2"
+	at.Equal(s.VerifySegment(query, req, "10.0.0.1"), errors.ErrSignatureInvalid)
+
+	expired := New(Config{Key: "secret", BindIP: true})
+	expired.config.SegmentTTL = -time.Hour
+	query = expired.SignSegment(claims, "segment-2")
+	at.Equal(s.VerifySegment(query, req, "10.0.0.1"), errors.ErrSignatureExpired)
+}
+
+func TestMiddleware(t *testing.T) {
+	at := assert.New(t)
+	s := New(Config{Key: "secret"})
+
+	req := Request{ChannelID: primitive.NewObjectID(), StreamID: primitive.NewObjectID()}
+	handler := s.Middleware(func(r *http.Request) (Request, error) {
+		return req, nil
+	}, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, ok := ClaimsFromContext(r.Context())
+		at.True(ok)
+		w.WriteHeader(http.StatusOK)
+	}))
+
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/playlist.m3u8", nil))
+	at.Equal(rec.Code, http.StatusUnauthorized)
+
+	token, _ := s.PlaylistToken(req.ChannelID, req.StreamID, primitive.NewObjectID(), "")
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/playlist.m3u8?token="+token, nil))
+	at.Equal(rec.Code, http.StatusOK)
+}
@@ -0,0 +1,57 @@
+package status
+
+import "time"
+
+// Sync measures how far audio timestamps are ahead of the video timestamps they are interleaved with.
+// Packets arrive in capture order, so an audio packet is expected close to the last video timestamp.
+type Sync struct {
+	hasVideo  bool
+	lastVideo int64
+
+	sum int64
+	n   int64
+
+	hasBaseline bool
+	baseline    time.Duration
+}
+
+func (s *Sync) Update(isVideo bool, timestamp uint32) {
+	if isVideo {
+		s.hasVideo = true
+		s.lastVideo = int64(timestamp)
+		return
+	}
+	if !s.hasVideo {
+		return
+	}
+	s.sum += int64(timestamp) - s.lastVideo
+	s.n++
+}
+
+// Offset returns the average audio offset since the last reset, false without audio and video.
+func (s *Sync) Offset() (time.Duration, bool) {
+	if s.n == 0 {
+		return 0, false
+	}
+	return time.Duration(s.sum/s.n) * time.Millisecond, true
+}
+
+// Segment ends a measuring period and returns its offset and the drift from the first period,
+// interleaving leaves a constant offset which is not drift.
+func (s *Sync) Segment() (offset, drift time.Duration, ok bool) {
+	offset, ok = s.Offset()
+	s.sum, s.n = 0, 0
+	if !ok {
+		return 0, 0, false
+	}
+	if !s.hasBaseline {
+		s.hasBaseline = true
+		s.baseline = offset
+	}
+	return offset, offset - s.baseline, true
+}
+
+// Reset forgets the baseline, used when the timeline starts over.
+func (s *Sync) Reset() {
+	*s = Sync{}
+}
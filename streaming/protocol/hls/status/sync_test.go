@@ -0,0 +1,42 @@
+package status
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSync(t *testing.T) {
+	at := assert.New(t)
+
+	s := &Sync{}
+	// audio before the first video frame is not measured
+	s.Update(false, 0)
+	_, ok := s.Offset()
+	at.False(ok)
+
+	segment := func(start, audioLead uint32) {
+		for ts := start; ts < start+1000; ts += 40 {
+			s.Update(true, ts)
+			s.Update(false, ts+10+audioLead)
+			s.Update(false, ts+30+audioLead)
+		}
+	}
+
+	segment(0, 0)
+	offset, drift, ok := s.Segment()
+	at.True(ok)
+	at.Equal(offset, 20*time.Millisecond)
+	at.Equal(drift, time.Duration(0))
+
+	segment(1000, 150)
+	offset, drift, _ = s.Segment()
+	at.Equal(offset, 170*time.Millisecond)
+	at.Equal(drift, 150*time.Millisecond)
+
+	s.Reset()
+	segment(2000, 150)
+	_, drift, _ = s.Segment()
+	at.Equal(drift, time.Duration(0))
+}
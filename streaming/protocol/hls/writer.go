@@ -21,9 +21,21 @@ import (
 const (
 	videoHZ      = 90000
 	aacSampleLen = 1024
-	maxQueueNum  = 512
+	maxQueueNum  = 1024
+	// syncStepDiv limits the audio correction per frame to a fraction of the frame duration.
+	syncStepDiv = 100
 )
 
+// SyncStats describes the audio and video sync of a source.
+type SyncStats struct {
+	// Offset is how far audio timestamps were ahead of video in the last segment.
+	Offset time.Duration
+	// Drift is the change of the offset since the first segment.
+	Drift time.Duration
+	// Correction is currently added to audio timestamps.
+	Correction time.Duration
+}
+
 type Source struct {
 	av.RWBaser
 
@@ -39,14 +51,28 @@ type Source struct {
 
 	pts, dts uint64
 
+	// discontinuity is set once the timeline was rebased until the next segment starts,
+	// discontinuities counts them for the discontinuity sequence of the segments.
+	discontinuity   bool
+	discontinuities int
+
 	stat  *status.Status
 	align *align.Align
+	sync  *status.Sync
+
+	// audioShift is added to audio timestamps in 90kHz ticks, it moves towards audioTarget.
+	audioShift  int64
+	audioTarget int64
 
 	audioCache   *cache.AudioCache
 	segmentCache *cache.Cache
 
 	tsParser *parser.CodecParser
 
+	infoMtx    sync.RWMutex
+	streamInfo parser.StreamInfo
+	syncStats  SyncStats
+
 	once   sync.Once
 	closed chan struct{}
 
@@ -67,6 +93,7 @@ func New(info av.Info, config Config) av.WriteCloser {
 
 		align: &align.Align{},
 		stat:  &status.Status{},
+		sync:  &status.Sync{},
 
 		audioCache: cache.NewAudioCache(),
 		demuxer:    flv.NewDemuxer(),
@@ -81,6 +108,9 @@ func New(info av.Info, config Config) av.WriteCloser {
 
 		config: config,
 	}
+	if config.Metrics != nil {
+		config.Metrics.addSource(s)
+	}
 	go func() {
 		defer s.Close()
 		err := s.SendPacket()
@@ -144,6 +174,10 @@ func (s *Source) SendPacket() error {
 			continue
 		}
 
+		if p.Discontinuity && s.btsWriter != nil {
+			s.discontinuity = true
+		}
+
 		err := s.demuxer.Demux(p)
 		if err == flv.ErrAvcEndSEQ {
 			s.config.Logger.Warn(err)
@@ -159,12 +193,17 @@ func (s *Source) SendPacket() error {
 			s.config.Logger.Warning(err)
 		}
 
+		if isSeq && err == nil {
+			s.updateStreamInfo()
+		}
+
 		if err != nil || isSeq {
 			continue
 		}
 
 		if s.btsWriter != nil {
 			s.stat.Update(p.IsVideo, p.TimeStamp)
+			s.sync.Update(p.IsVideo, p.TimeStamp)
 			s.calcPtsDts(p.IsVideo, p.TimeStamp, uint32(compositionTime))
 			_ = s.tsMux(p)
 		}
@@ -177,6 +216,79 @@ func (s *Source) Info() av.Info {
 	return s.info
 }
 
+// StreamInfo returns the codecs known from the sequence headers, used to build the CODECS attribute of a master playlist.
+func (s *Source) StreamInfo() parser.StreamInfo {
+	s.infoMtx.RLock()
+	defer s.infoMtx.RUnlock()
+	return s.streamInfo
+}
+
+// SyncStats returns the audio and video sync measured at the last segment.
+func (s *Source) SyncStats() SyncStats {
+	s.infoMtx.RLock()
+	defer s.infoMtx.RUnlock()
+	return s.syncStats
+}
+
+// measureSync updates the sync stats at the end of a segment and retargets the audio correction
+// once it is off by more than MaxAVDrift.
+func (s *Source) measureSync() {
+	offset, drift, ok := s.sync.Segment()
+	if !ok {
+		return
+	}
+
+	if s.config.MaxAVDrift > 0 {
+		limit := s.config.MaxAVDrift.Milliseconds() * align.H264DefaultHZ
+		target := -drift.Milliseconds() * align.H264DefaultHZ
+		if d := target - s.audioTarget; d > limit || -d > limit {
+			s.config.Logger.WithFields(logrus.Fields{
+				"offset": offset,
+				"drift":  drift,
+				"info":   s.Info(),
+			}).Info("correcting audio drift")
+			s.audioTarget = target
+		}
+	}
+
+	s.infoMtx.Lock()
+	s.syncStats = SyncStats{
+		Offset:     offset,
+		Drift:      drift,
+		Correction: time.Duration(s.audioShift/align.H264DefaultHZ) * time.Millisecond,
+	}
+	s.infoMtx.Unlock()
+}
+
+// correctAudio moves the audio timestamp by the current correction, which approaches its target by a
+// small step per frame so the audio timeline is stretched rather than cut.
+func (s *Source) correctAudio(dts uint64, inc uint32) uint64 {
+	step := int64(inc) / syncStepDiv
+	if step < 1 {
+		step = 1
+	}
+	switch d := s.audioTarget - s.audioShift; {
+	case d > step:
+		s.audioShift += step
+	case d < -step:
+		s.audioShift -= step
+	default:
+		s.audioShift = s.audioTarget
+	}
+
+	if s.audioShift < 0 && uint64(-s.audioShift) > dts {
+		return 0
+	}
+	return uint64(int64(dts) + s.audioShift)
+}
+
+func (s *Source) updateStreamInfo() {
+	info := s.tsParser.StreamInfo()
+	s.infoMtx.Lock()
+	s.streamInfo = info
+	s.infoMtx.Unlock()
+}
+
 func (s *Source) Close() error {
 	s.once.Do(func() {
 		s.config.Logger.Info("closed")
@@ -184,6 +296,9 @@ func (s *Source) Close() error {
 		close(s.packetQueue)
 		s.cut(true)
 		s.segmentCache.Stop()
+		if s.config.Metrics != nil {
+			s.config.Metrics.removeSource(s)
+		}
 	})
 
 	return nil
@@ -204,6 +319,13 @@ func (s *Source) cut(end bool) {
 
 		s.currentItem.SetDuration(s.stat.Duration())
 		_ = s.currentItem.Close()
+		s.measureSync()
+		if s.currentItem.Duration() > 0 {
+			if s.config.Metrics != nil {
+				s.config.Metrics.observeSegment(s.currentItem.Duration(), s.currentItem.Size(), s.currentItem.Discontinuity())
+			}
+			s.config.OnSegment(s.info, s.currentItem)
+		}
 
 		select {
 		case <-s.closed:
@@ -213,6 +335,7 @@ func (s *Source) cut(end bool) {
 
 		s.stat.ResetAndNew()
 		s.currentItem = s.segmentCache.NewItem()
+		s.currentItem.SetDiscontinuity(false, s.discontinuities)
 		s.btsWriter.Write(s.muxer.PAT())
 		s.btsWriter.Write(s.muxer.PMT(av.SOUND_AAC, true))
 	}
@@ -256,18 +379,36 @@ func (s *Source) parse(p *av.Packet) (int32, bool, error) {
 
 	p.Data = s.bWriter.Bytes()
 
-	s.cut(p.IsVideo && vh.IsKeyFrame() && s.stat.Duration() >= s.config.MinSegmentDuration)
+	if s.discontinuity {
+		s.startDiscontinuity()
+	} else {
+		s.cut(p.IsVideo && vh.IsKeyFrame() && s.stat.Duration() >= s.config.MinSegmentDuration)
+	}
 
 	return compositionTime, false, nil
 }
 
+// startDiscontinuity cuts the segment where the timeline was rebased, a segment never spans a discontinuity.
+// The audio alignment restarts with the new timeline.
+func (s *Source) startDiscontinuity() {
+	s.discontinuity = false
+	s.discontinuities++
+	s.cut(true)
+	s.currentItem.SetDiscontinuity(true, s.discontinuities)
+	s.align = &align.Align{}
+	s.sync.Reset()
+	s.audioShift, s.audioTarget = 0, 0
+}
+
 func (s *Source) calcPtsDts(isVideo bool, ts, compositionTs uint32) {
 	s.dts = uint64(ts) * align.H264DefaultHZ
 	if isVideo {
 		s.pts = s.dts + uint64(compositionTs)*align.H264DefaultHZ
 	} else {
 		sampleRate, _ := s.tsParser.SampleRate()
-		s.align.Align(&s.dts, uint32(videoHZ*aacSampleLen/sampleRate))
+		inc := uint32(videoHZ * aacSampleLen / sampleRate)
+		s.align.Align(&s.dts, inc)
+		s.dts = s.correctAudio(s.dts, inc)
 		s.pts = s.dts
 	}
 }
@@ -0,0 +1,73 @@
+package hls
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/viderstv/common/streaming/av"
+	"github.com/viderstv/common/streaming/metrics"
+	"github.com/viderstv/common/streaming/protocol/hls/status"
+)
+
+func TestSourceSyncCorrection(t *testing.T) {
+	at := assert.New(t)
+
+	s := &Source{sync: &status.Sync{}, config: Config{MaxAVDrift: 100 * time.Millisecond}.fill()}
+	segment := func(start, audioLead uint32) {
+		for ts := start; ts < start+1000; ts += 40 {
+			s.sync.Update(true, ts)
+			s.sync.Update(false, ts+audioLead)
+		}
+		s.measureSync()
+	}
+
+	segment(0, 0)
+	segment(1000, 50)
+	at.Equal(s.SyncStats().Drift, 50*time.Millisecond)
+	// within the limit nothing is corrected
+	at.Equal(s.correctAudio(90000, 1920), uint64(90000))
+
+	segment(2000, 200)
+	at.Equal(s.SyncStats().Drift, 200*time.Millisecond)
+	// the correction approaches -200ms by a hundredth of a frame per frame
+	at.Equal(s.correctAudio(90000, 1920), uint64(90000-19))
+	for i := 0; i < 1000; i++ {
+		s.correctAudio(90000, 1920)
+	}
+	at.Equal(s.correctAudio(90000, 1920), uint64(90000-200*90))
+
+	segment(3000, 200)
+	at.Equal(s.SyncStats().Correction, -200*time.Millisecond)
+}
+
+func TestMetricsDrift(t *testing.T) {
+	at := assert.New(t)
+
+	m := NewMetrics()
+	s := &Source{info: av.Info{Key: "key", App: "live", Name: "user"}, sync: &status.Sync{}, config: Config{Metrics: m}.fill()}
+	m.addSource(s)
+	for i, lead := range []uint32{0, 50} {
+		for ts := uint32(i * 1000); ts < uint32(i*1000+1000); ts += 40 {
+			s.sync.Update(true, ts)
+			s.sync.Update(false, ts+lead)
+		}
+		s.measureSync()
+	}
+
+	drift := func() []metrics.Sample {
+		for _, f := range m.Collect() {
+			if f.Name == "hls_av_drift_seconds" {
+				at.Equal(f.Type, metrics.TypeGauge)
+				return f.Samples
+			}
+		}
+		t.Fatal("no drift family")
+		return nil
+	}
+	at.Equal(drift(), []metrics.Sample{{Labels: metrics.Labels("key", "key", "app", "live", "name", "user"), Value: 0.05}})
+
+	// closed sources are not reported
+	m.removeSource(s)
+	at.Empty(drift())
+}
@@ -0,0 +1,81 @@
+package auth
+
+import (
+	"context"
+	"crypto/subtle"
+	"fmt"
+	"net"
+	"strings"
+
+	"github.com/viderstv/common/streaming/av"
+	"github.com/viderstv/common/streaming/protocol/rtmp/core"
+	"github.com/viderstv/common/structures"
+)
+
+var (
+	ErrChannelNotFound = fmt.Errorf("channel not found")
+)
+
+// ChannelLookup finds the user owning a stream key.
+type ChannelLookup interface {
+	// FindByStreamKey returns ErrChannelNotFound when no channel uses the key.
+	FindByStreamKey(ctx context.Context, streamKey string) (structures.User, error)
+}
+
+// Authenticator validates publishers against structures.Channel.StreamKey, it plugs into rtmp.Config.Authenticate.
+type Authenticator struct {
+	config Config
+}
+
+func New(config Config) *Authenticator {
+	return &Authenticator{config: config.fill()}
+}
+
+// StreamKey returns the stream key of a publish, query parameters win over the stream name.
+func (a *Authenticator) StreamKey(info av.Info) string {
+	for _, k := range a.config.KeyParams {
+		if v := info.Params.Get(k); v != "" {
+			return v
+		}
+	}
+	return info.Name
+}
+
+// Authenticate accepts every viewer and validates the stream key of publishers.
+// On success the stream name and key are replaced by the user id so the stream key never shows up in urls,
+// viewers play the stream by the user id.
+func (a *Authenticator) Authenticate(info *av.Info, addr net.Addr) error {
+	if !info.Publisher {
+		return nil
+	}
+
+	key := a.StreamKey(*info)
+	if key == "" || strings.ContainsAny(key, "/ ") {
+		return core.NewStatusError(core.StatusPublishBadName, "Missing or malformed stream key.")
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), a.config.Timeout)
+	defer cancel()
+
+	user, err := a.config.Lookup.FindByStreamKey(ctx, key)
+	if err != nil {
+		if err != ErrChannelNotFound {
+			a.config.Logger.Error("failed to lookup stream key: ", err)
+		}
+		return core.NewStatusError(core.StatusPublishUnauthorized, "Invalid stream key.")
+	}
+
+	if user.Channel.StreamKey == "" || subtle.ConstantTimeCompare([]byte(user.Channel.StreamKey), []byte(key)) != 1 {
+		return core.NewStatusError(core.StatusPublishUnauthorized, "Invalid stream key.")
+	}
+
+	name := user.ID.Hex()
+	info.URL = strings.TrimSuffix(info.URL, info.Name) + name
+	info.Name = name
+	info.Key = name
+	for _, k := range a.config.KeyParams {
+		info.Params.Del(k)
+	}
+
+	return nil
+}
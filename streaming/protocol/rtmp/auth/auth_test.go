@@ -0,0 +1,60 @@
+package auth
+
+import (
+	"context"
+	"net/url"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/viderstv/common/streaming/av"
+	"github.com/viderstv/common/streaming/protocol/rtmp/core"
+	"github.com/viderstv/common/structures"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+type mapLookup map[string]structures.User
+
+func (m mapLookup) FindByStreamKey(ctx context.Context, streamKey string) (structures.User, error) {
+	user, ok := m[streamKey]
+	if !ok {
+		return user, ErrChannelNotFound
+	}
+	return user, nil
+}
+
+func statusCode(err error) string {
+	if status, ok := err.(*core.StatusError); ok {
+		return status.Code
+	}
+	return ""
+}
+
+func TestAuthenticate(t *testing.T) {
+	at := assert.New(t)
+
+	user := structures.User{ID: primitive.NewObjectID(), Channel: structures.Channel{StreamKey: "live_secret"}}
+	a := New(Config{Lookup: mapLookup{"live_secret": user}})
+
+	info := &av.Info{Publisher: true, App: "live", Name: "live_secret", URL: "rtmp://localhost/live/live_secret", Params: url.Values{}}
+	at.Equal(a.Authenticate(info, nil), nil)
+	at.Equal(info.Name, user.ID.Hex())
+	at.Equal(info.Key, user.ID.Hex())
+	at.Equal(info.URL, "rtmp://localhost/live/"+user.ID.Hex())
+
+	// the key can be passed as a query parameter
+	info = &av.Info{Publisher: true, Name: "anything", Params: url.Values{"key": {"live_secret"}}}
+	at.Equal(a.Authenticate(info, nil), nil)
+	at.Equal(info.Name, user.ID.Hex())
+	at.Equal(info.Params.Get("key"), "")
+
+	info = &av.Info{Publisher: true, Name: "live_wrong"}
+	at.Equal(statusCode(a.Authenticate(info, nil)), core.StatusPublishUnauthorized)
+
+	info = &av.Info{Publisher: true}
+	at.Equal(statusCode(a.Authenticate(info, nil)), core.StatusPublishBadName)
+
+	// viewers are not checked
+	info = &av.Info{Name: "stream"}
+	at.Equal(a.Authenticate(info, nil), nil)
+	at.Equal(info.Name, "stream")
+}
@@ -0,0 +1,37 @@
+package auth
+
+import (
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+type Config struct {
+	Logger logrus.FieldLogger
+	// Lookup resolves stream keys to their channel.
+	Lookup ChannelLookup
+	// Timeout bounds a single lookup.
+	Timeout time.Duration
+	// KeyParams are the query parameters checked for the stream key before the stream name, in order.
+	KeyParams []string
+}
+
+func (c Config) fill() Config {
+	if c.Logger == nil {
+		c.Logger = DefaultConfig.Logger
+	}
+	if c.Timeout <= 0 {
+		c.Timeout = DefaultConfig.Timeout
+	}
+	if c.KeyParams == nil {
+		c.KeyParams = DefaultConfig.KeyParams
+	}
+
+	return c
+}
+
+var DefaultConfig = Config{
+	Logger:    logrus.StandardLogger(),
+	Timeout:   time.Second * 5,
+	KeyParams: []string{"key", "token"},
+}
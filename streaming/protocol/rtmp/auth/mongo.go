@@ -0,0 +1,28 @@
+package auth
+
+import (
+	"context"
+
+	"github.com/viderstv/common/instance"
+	"github.com/viderstv/common/structures"
+	"github.com/viderstv/common/svc/mongo"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+type mongoLookup struct {
+	inst instance.Mongo
+}
+
+// NewMongoLookup looks up stream keys in the users collection.
+func NewMongoLookup(inst instance.Mongo) ChannelLookup {
+	return &mongoLookup{inst: inst}
+}
+
+func (m *mongoLookup) FindByStreamKey(ctx context.Context, streamKey string) (structures.User, error) {
+	user := structures.User{}
+	err := m.inst.Collection(mongo.CollectionNameUsers).FindOne(ctx, bson.M{"channel.stream_key": streamKey}).Decode(&user)
+	if err == mongo.ErrNoDocuments {
+		return user, ErrChannelNotFound
+	}
+	return user, err
+}
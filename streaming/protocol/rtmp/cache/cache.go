@@ -11,9 +11,9 @@ type Cache struct {
 	metadata *SpecialCache
 }
 
-func NewCache() *Cache {
+func NewCache(config Config) *Cache {
 	return &Cache{
-		gop:      NewGopCache(1),
+		gop:      NewGopCache(config),
 		videoSeq: NewSpecialCache(),
 		audioSeq: NewSpecialCache(),
 		metadata: NewSpecialCache(),
@@ -32,8 +32,6 @@ func (c *Cache) Write(p av.Packet) error {
 					ah.AACPacketType() == av.AAC_SEQHDR {
 					c.audioSeq.Write(&p)
 					return nil
-				} else {
-					return nil
 				}
 			}
 
@@ -72,3 +70,16 @@ func (c *Cache) Send(w av.WriteCloser) error {
 
 	return nil
 }
+
+// Reset empties the cache, used when a new publisher takes over the stream.
+func (c *Cache) Reset() {
+	c.gop.Reset()
+	c.videoSeq = NewSpecialCache()
+	c.audioSeq = NewSpecialCache()
+	c.metadata = NewSpecialCache()
+}
+
+// Dropped returns the number of packets the GOP cache dropped to stay within its budget.
+func (c *Cache) Dropped() uint64 {
+	return c.gop.Dropped()
+}
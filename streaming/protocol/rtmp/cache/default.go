@@ -0,0 +1,50 @@
+package cache
+
+import "time"
+
+type Mode int
+
+const (
+	// ModeFullGOP replays every cached GOP to new viewers.
+	ModeFullGOP Mode = iota
+	// ModeLowLatency starts new viewers at the latest keyframe.
+	ModeLowLatency
+)
+
+type Config struct {
+	Mode Mode
+	// GOPs is the number of GOPs kept, the one being received included.
+	GOPs int
+	// MaxDuration, MaxBytes and MaxPackets bound the cached packets, the oldest GOPs are dropped first.
+	// A single GOP over budget is not cached. New viewers get the whole cache at once, so MaxPackets has
+	// to stay below the queue of the writers, 1024 packets for rtmp viewers and hls. The default fits a
+	// GOP of 10 seconds at 30 fps or 6 seconds at 60 fps with 48 kHz aac, about 770 and 640 packets.
+	MaxDuration time.Duration
+	MaxBytes    int
+	MaxPackets  int
+}
+
+func (c Config) fill() Config {
+	if c.GOPs <= 0 {
+		c.GOPs = DefaultConfig.GOPs
+	}
+	if c.MaxDuration <= 0 {
+		c.MaxDuration = DefaultConfig.MaxDuration
+	}
+	if c.MaxBytes <= 0 {
+		c.MaxBytes = DefaultConfig.MaxBytes
+	}
+	if c.MaxPackets <= 0 {
+		c.MaxPackets = DefaultConfig.MaxPackets
+	}
+
+	return c
+}
+
+var DefaultConfig = Config{
+	Mode:        ModeFullGOP,
+	GOPs:        1,
+	MaxDuration: time.Second * 30,
+	MaxBytes:    64 << 20,
+	MaxPackets:  1000,
+}
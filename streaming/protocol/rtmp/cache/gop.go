@@ -2,46 +2,29 @@ package cache
 
 import (
 	"fmt"
+	"time"
 
 	"github.com/viderstv/common/streaming/av"
 )
 
 var (
-	maxGOPCap    int = 1024
-	ErrGopTooBig     = fmt.Errorf("gop to big")
+	// Deprecated: GOPs over budget are dropped without an error.
+	ErrGopTooBig = fmt.Errorf("gop to big")
 )
 
-type array struct {
-	index   int
+type gop struct {
 	packets []*av.Packet
+	bytes   int
 }
 
-func newArray() *array {
-	ret := &array{
-		index:   0,
-		packets: make([]*av.Packet, 0, maxGOPCap),
-	}
-	return ret
-}
-
-func (a *array) reset() {
-	a.index = 0
-	a.packets = a.packets[:0]
+func (g *gop) write(p *av.Packet) {
+	g.packets = append(g.packets, p)
+	g.bytes += len(p.Data)
 }
 
-func (a *array) write(packet *av.Packet) error {
-	if a.index >= maxGOPCap {
-		return ErrGopTooBig
-	}
-	a.packets = append(a.packets, packet)
-	a.index++
-	return nil
-}
-
-func (a *array) send(w av.WriteCloser) error {
-	for i := 0; i < a.index; i++ {
-		packet := a.packets[i]
-		if err := w.Write(packet); err != nil {
+func (g *gop) send(w av.WriteCloser) error {
+	for _, p := range g.packets {
+		if err := w.Write(p); err != nil {
 			return err
 		}
 	}
@@ -49,75 +32,93 @@ func (a *array) send(w av.WriteCloser) error {
 	return nil
 }
 
+// GopCache keeps the latest GOPs within the budget of its config, oldest first.
 type GopCache struct {
-	start     bool
-	num       int
-	count     int
-	nextindex int
-	gops      []*array
+	config  Config
+	gops    []*gop
+	packets int
+	bytes   int
+	dropped uint64
 }
 
-func NewGopCache(num int) *GopCache {
-	if num == 0 {
-		num = 1
-	}
+func NewGopCache(config Config) *GopCache {
 	return &GopCache{
-		count: num,
-		gops:  make([]*array, num),
-	}
-}
-
-func (c *GopCache) writeToArray(chunk *av.Packet, startNew bool) error {
-	var ginc *array
-	if startNew {
-		ginc = c.gops[c.nextindex]
-		if ginc == nil {
-			ginc = newArray()
-			c.num++
-			c.gops[c.nextindex] = ginc
-		} else {
-			ginc.reset()
-		}
-		c.nextindex = (c.nextindex + 1) % c.count
-	} else {
-		ginc = c.gops[(c.nextindex+1)%c.count]
+		config: config.fill(),
 	}
-
-	return ginc.write(chunk)
 }
 
+// Write caches a packet, packets before the first keyframe are ignored. A single GOP over budget is dropped,
+// its inter frames are useless without the packets they reference, nothing is cached until the next keyframe.
 func (c *GopCache) Write(p *av.Packet) error {
-	var ok bool
 	if p.IsVideo {
-		vh := p.Header.(av.VideoPacketHeader)
-		if vh.IsKeyFrame() && !vh.IsSeq() {
-			ok = true
+		if vh, ok := p.Header.(av.VideoPacketHeader); ok && vh.IsKeyFrame() && !vh.IsSeq() {
+			c.gops = append(c.gops, &gop{})
+			for len(c.gops) > c.config.GOPs {
+				c.dropGOP()
+			}
 		}
 	}
-	if ok || c.start {
-		c.start = true
-		return c.writeToArray(p, ok)
+	if len(c.gops) == 0 {
+		return nil
 	}
+
+	c.gops[len(c.gops)-1].write(p)
+	c.packets++
+	c.bytes += len(p.Data)
+
+	for c.overBudget() && len(c.gops) > 0 {
+		c.dropGOP()
+	}
+
 	return nil
 }
 
-func (c *GopCache) sendTo(w av.WriteCloser) error {
-	var err error
-	pos := (c.nextindex + 1) % c.count
-	for i := 0; i < c.num; i++ {
-		index := (pos - c.num + 1) + i
-		if index < 0 {
-			index += c.count
-		}
-		g := c.gops[index]
-		err = g.send(w)
-		if err != nil {
-			return err
-		}
+func (c *GopCache) dropGOP() {
+	g := c.gops[0]
+	c.gops[0] = nil
+	c.gops = c.gops[1:]
+	c.packets -= len(g.packets)
+	c.bytes -= g.bytes
+	c.dropped += uint64(len(g.packets))
+}
+
+func (c *GopCache) overBudget() bool {
+	return c.packets > c.config.MaxPackets || c.bytes > c.config.MaxBytes || c.Duration() > c.config.MaxDuration
+}
+
+// Duration returns the time span of the cached packets.
+func (c *GopCache) Duration() time.Duration {
+	if len(c.gops) == 0 {
+		return 0
 	}
-	return nil
+	first := c.gops[0].packets
+	last := c.gops[len(c.gops)-1].packets
+	// timestamps are 32 bit milliseconds which wrap around.
+	return time.Duration(last[len(last)-1].TimeStamp-first[0].TimeStamp) * time.Millisecond
+}
+
+// Reset drops the cached GOPs, the dropped counter is kept.
+func (c *GopCache) Reset() {
+	c.gops = nil
+	c.packets = 0
+	c.bytes = 0
+}
+
+// Dropped returns the number of packets dropped to stay within the budget.
+func (c *GopCache) Dropped() uint64 {
+	return c.dropped
 }
 
 func (c *GopCache) Send(w av.WriteCloser) error {
-	return c.sendTo(w)
+	gops := c.gops
+	if c.config.Mode == ModeLowLatency && len(gops) > 1 {
+		gops = gops[len(gops)-1:]
+	}
+	for _, g := range gops {
+		if err := g.send(w); err != nil {
+			return err
+		}
+	}
+
+	return nil
 }
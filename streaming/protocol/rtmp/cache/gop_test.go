@@ -0,0 +1,119 @@
+package cache
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/viderstv/common/streaming/av"
+	"github.com/viderstv/common/streaming/container/flv"
+)
+
+type recorder struct {
+	av.RWBaser
+	packets []*av.Packet
+}
+
+func (r *recorder) Write(p *av.Packet) error {
+	r.packets = append(r.packets, p)
+	return nil
+}
+
+func (r *recorder) Info() av.Info               { return av.Info{} }
+func (r *recorder) Close() error                { return nil }
+func (r *recorder) Running() <-chan struct{}    { return nil }
+func (r *recorder) ToAvHandler() av.WriteCloser { return r }
+
+func video(t *testing.T, ts uint32, header ...byte) *av.Packet {
+	tag := &flv.Tag{}
+	if _, err := tag.ParseMediaTagHeader(header, true); err != nil {
+		t.Fatal(err)
+	}
+	return &av.Packet{IsVideo: true, Header: tag, TimeStamp: ts, Data: header}
+}
+
+func key(t *testing.T, ts uint32) *av.Packet {
+	return video(t, ts, 0x17, 0x01, 0x00, 0x00, 0x00)
+}
+
+func inter(t *testing.T, ts uint32) *av.Packet {
+	return video(t, ts, 0x27, 0x01, 0x00, 0x00, 0x00)
+}
+
+func timestamps(c *GopCache) []uint32 {
+	r := &recorder{}
+	_ = c.Send(r)
+	ts := []uint32{}
+	for _, p := range r.packets {
+		ts = append(ts, p.TimeStamp)
+	}
+	return ts
+}
+
+func TestGopCacheModes(t *testing.T) {
+	at := assert.New(t)
+
+	full := NewGopCache(Config{GOPs: 2})
+	low := NewGopCache(Config{GOPs: 2, Mode: ModeLowLatency})
+	for _, c := range []*GopCache{full, low} {
+		// packets before the first keyframe are not cached
+		_ = c.Write(inter(t, 0))
+		for _, ts := range []uint32{100, 200, 300} {
+			_ = c.Write(key(t, ts))
+			_ = c.Write(inter(t, ts+50))
+		}
+	}
+
+	at.Equal(timestamps(full), []uint32{200, 250, 300, 350})
+	at.Equal(timestamps(low), []uint32{300, 350})
+	at.Equal(full.Dropped(), uint64(2))
+	at.Equal(full.Duration(), 150*time.Millisecond)
+}
+
+func TestGopCacheBudget(t *testing.T) {
+	at := assert.New(t)
+
+	c := NewGopCache(Config{GOPs: 3, MaxDuration: time.Second})
+	_ = c.Write(key(t, 0))
+	_ = c.Write(inter(t, 500))
+	_ = c.Write(key(t, 1000))
+	_ = c.Write(inter(t, 1500))
+	// over a second, the oldest gop goes first
+	at.Equal(timestamps(c), []uint32{1000, 1500})
+
+	// a single gop over budget is dropped until the next keyframe
+	for ts := uint32(2000); ts <= 3000; ts += 500 {
+		_ = c.Write(inter(t, ts))
+	}
+	at.Empty(timestamps(c))
+	at.Equal(c.Dropped(), uint64(6))
+	_ = c.Write(inter(t, 3500))
+	at.Empty(timestamps(c))
+	_ = c.Write(key(t, 4000))
+	_ = c.Write(inter(t, 4500))
+	at.Equal(timestamps(c), []uint32{4000, 4500})
+
+	c = NewGopCache(Config{MaxPackets: 3})
+	_ = c.Write(key(t, 0))
+	for ts := uint32(1); ts <= 5; ts++ {
+		at.Equal(c.Write(inter(t, ts)), nil)
+	}
+	at.Empty(timestamps(c))
+}
+
+func TestGopCacheDefault(t *testing.T) {
+	at := assert.New(t)
+
+	// 10 seconds of 30 fps video with a single keyframe and 48 kHz aac, 47 frames per second
+	c := NewGopCache(Config{})
+	_ = c.Write(key(t, 0))
+	for i, audio := 1, 0; i < 300; i++ {
+		ts := uint32(i * 1000 / 30)
+		for ; uint32(audio*1024*1000/48000) <= ts; audio++ {
+			_ = c.Write(&av.Packet{IsAudio: true, TimeStamp: uint32(audio * 1024 * 1000 / 48000)})
+		}
+		_ = c.Write(inter(t, ts))
+	}
+	at.Len(timestamps(c), 300+468)
+	at.Equal(c.Dropped(), uint64(0))
+}
@@ -0,0 +1,154 @@
+package core
+
+import (
+	"bytes"
+	"io"
+
+	"github.com/sirupsen/logrus"
+	"github.com/viderstv/common/streaming/protocol/amf"
+)
+
+const (
+	CmdCloseStream     = "closeStream"
+	CmdPause           = "pause"
+	CmdSeek            = "seek"
+	CmdReceiveAudio    = "receiveAudio"
+	CmdReceiveVideo    = "receiveVideo"
+	CmdGetStreamLength = "getStreamLength"
+	CmdCheckBandwidth  = "checkBandwidth"
+	CmdCheckBw         = "_checkbw"
+)
+
+// Command is a decoded command message.
+type Command struct {
+	Name          string
+	TransactionID int
+	StreamID      uint32
+	// Values are all decoded values including the name and transaction id.
+	Values []interface{}
+}
+
+// Arg returns the i-th argument after the command object.
+func (c Command) Arg(i int) interface{} {
+	i += 3
+	if i < len(c.Values) {
+		return c.Values[i]
+	}
+	return nil
+}
+
+// Flag returns the i-th argument as a bool, pause and receiveAudio/receiveVideo carry their flag first.
+func (c Command) Flag(i int) bool {
+	b, _ := c.Arg(i).(bool)
+	return b
+}
+
+// EndsStream reports if the command ends a publish or play.
+func (c Command) EndsStream() bool {
+	switch c.Name {
+	case cmdFCUnpublish, cmdDeleteStream, CmdCloseStream:
+		return true
+	}
+	return false
+}
+
+// decodeCmd decodes a command message without modifying the chunk. Commands are decoded on the reading
+// goroutine and the stream goroutines, each call uses its own decoder.
+func (c *ConnServer) decodeCmd(chunk *ChunkStream) (Command, error) {
+	data := chunk.Data
+	if chunk.TypeID == 17 && len(data) > 0 {
+		data = data[1:]
+	}
+
+	decoder := &amf.Decoder{}
+	vs, err := decoder.DecodeBatch(bytes.NewReader(data), amf.AMF0)
+	if err != nil && err != io.EOF {
+		return Command{}, err
+	}
+
+	cmd := Command{StreamID: chunk.StreamID, Values: vs}
+	if len(vs) > 0 {
+		cmd.Name, _ = vs[0].(string)
+	}
+	if len(vs) > 1 {
+		if id, ok := vs[1].(float64); ok {
+			cmd.TransactionID = int(id)
+		}
+	}
+	return cmd, nil
+}
+
+// HandleStreamCmd answers a command sent after publish or play and returns it decoded
+// so the stream can apply it.
+func (c *ConnServer) HandleStreamCmd(chunk *ChunkStream) (Command, error) {
+	cmd, err := c.decodeCmd(chunk)
+	if err != nil {
+		return cmd, err
+	}
+	if cmd.Name == "" {
+		return cmd, nil
+	}
+	return cmd, c.streamCmd(chunk, cmd, c.current)
+}
+
+func (c *ConnServer) resultResp(cur *ChunkStream, transactionID int, args ...interface{}) error {
+	return c.writeMsg(cur.CSID, cur.StreamID, append([]interface{}{"_result", transactionID, nil}, args...)...)
+}
+
+func (c *ConnServer) onStatus(cur *ChunkStream, level, code, description string) error {
+	event := make(amf.Object)
+	event["level"] = level
+	event["code"] = code
+	event["description"] = description
+	return c.writeMsg(cur.CSID, cur.StreamID, "onStatus", 0, nil, event)
+}
+
+// streamCmd handles the commands which are valid at any point of a connection, ns is the stream
+// the command belongs to and nil for commands before publish or play.
+func (c *ConnServer) streamCmd(chunk *ChunkStream, cmd Command, ns *NetStream) error {
+	if ns != nil && chunk.StreamID != ns.ID {
+		// deleteStream and FCUnpublish are sent on the connection, the response belongs to the stream.
+		cur := *chunk
+		cur.StreamID = ns.ID
+		chunk = &cur
+	}
+
+	switch cmd.Name {
+	case cmdFCUnpublish, cmdDeleteStream, CmdCloseStream:
+		if ns != nil && ns.publisher && !ns.unpublished {
+			ns.unpublished = true
+			return c.onStatus(chunk, "status", "NetStream.Unpublish.Success", "Stop publishing.")
+		}
+	case CmdPause:
+		if ns == nil {
+			return nil
+		}
+		if cmd.Flag(0) {
+			return c.onStatus(chunk, "status", "NetStream.Pause.Notify", "Paused live stream.")
+		}
+		return c.onStatus(chunk, "status", "NetStream.Unpause.Notify", "Unpaused live stream.")
+	case CmdSeek:
+		return c.onStatus(chunk, "error", "NetStream.Seek.Failed", "Seeking is not supported on live streams.")
+	case CmdReceiveAudio, CmdReceiveVideo:
+		// the stream toggles delivery, no response is expected.
+	case CmdGetStreamLength:
+		// live streams have no length.
+		return c.resultResp(chunk, cmd.TransactionID, 0)
+	case CmdCheckBandwidth, CmdCheckBw:
+		return c.resultResp(chunk, cmd.TransactionID)
+	case cmdFcpublish, cmdReleaseStream:
+		return nil
+	default:
+		logrus.Debug("no support command=", cmd.Name)
+		// a transaction id of 0 marks a notification without a response.
+		if cmd.TransactionID != 0 {
+			return c.errorResp(chunk, cmd.TransactionID, NewStatusError(StatusCallFailed, "Method not found ("+cmd.Name+")."))
+		}
+	}
+	return nil
+}
+
+// Unpublished reports if the publisher of the current stream ended it with FCUnpublish, deleteStream or closeStream.
+func (c *ConnServer) Unpublished() bool {
+	return c.current != nil && c.current.unpublished
+}
@@ -3,6 +3,7 @@ package core
 import (
 	"encoding/binary"
 	"net"
+	"sync"
 	"time"
 
 	"github.com/viderstv/common/utils/pio"
@@ -30,6 +31,9 @@ type Conn struct {
 	rw                  *ReadWriter
 	pool                *pool.Pool
 	chunks              map[uint32]ChunkStream
+	// wmtx serializes acknowledgements of the reading side with writes.
+	wmtx sync.Mutex
+	flow flowControl
 }
 
 func NewConn(chunk net.Conn, bufferSize int) *Conn {
@@ -74,6 +78,8 @@ func (c *Conn) Read(chunk *ChunkStream) error {
 }
 
 func (c *Conn) Write(chunk *ChunkStream) error {
+	c.wmtx.Lock()
+	defer c.wmtx.Unlock()
 	if chunk.TypeID == idSetChunkSize {
 		c.chunkSize = binary.BigEndian.Uint32(chunk.Data)
 	}
@@ -81,7 +87,24 @@ func (c *Conn) Write(chunk *ChunkStream) error {
 }
 
 func (c *Conn) Flush() error {
-	return c.rw.Flush()
+	c.wmtx.Lock()
+	defer c.wmtx.Unlock()
+	if err := c.rw.Flush(); err != nil {
+		return err
+	}
+	c.flow.sent(c.rw.Written())
+	return nil
+}
+
+// WaitWindow blocks while the peer did not acknowledge enough of the sent bytes,
+// it must not be called with a lock the reading side needs.
+func (c *Conn) WaitWindow() {
+	c.flow.waitWindow(c.rw.Written, c.windowAckSize)
+}
+
+// FlowStats returns the outbound flow control state.
+func (c *Conn) FlowStats() FlowStats {
+	return c.flow.stats(c.rw.Written(), c.windowAckSize)
 }
 
 func (c *Conn) Close() error {
@@ -124,6 +147,10 @@ func (c *Conn) handleControlMsg(chunk *ChunkStream) {
 		c.remoteChunkSize = binary.BigEndian.Uint32(chunk.Data)
 	} else if chunk.TypeID == idWindowAckSize {
 		c.remoteWindowAckSize = binary.BigEndian.Uint32(chunk.Data)
+	} else if chunk.TypeID == idAck && len(chunk.Data) >= 4 {
+		c.flow.onAck(binary.BigEndian.Uint32(chunk.Data), c.rw.Written())
+	} else if chunk.TypeID == idSetPeerBandwidth && len(chunk.Data) >= 4 {
+		c.flow.setPeerBandwidth(binary.BigEndian.Uint32(chunk.Data))
 	}
 }
 
@@ -135,8 +162,12 @@ func (c *Conn) ack(size uint32) error {
 	}
 	if c.ackReceived >= c.remoteWindowAckSize {
 		cs := c.NewAck(c.ackReceived)
-		err := cs.writeChunk(c.rw, int(c.chunkSize))
-		if err != nil {
+		c.wmtx.Lock()
+		defer c.wmtx.Unlock()
+		if err := cs.writeChunk(c.rw, int(c.chunkSize)); err != nil {
+			return err
+		}
+		if err := c.rw.Flush(); err != nil {
 			return err
 		}
 		c.ackReceived = 0
@@ -2,12 +2,14 @@ package core
 
 import (
 	"bytes"
+	"context"
 	"crypto/tls"
 	"fmt"
 	"io"
 	"net"
 	neturl "net/url"
 	"strings"
+	"time"
 
 	"github.com/sirupsen/logrus"
 	"github.com/viderstv/common/streaming/av"
@@ -26,6 +28,8 @@ var (
 	ErrFail = fmt.Errorf("respone err")
 )
 
+const dialTimeout = 10 * time.Second
+
 type ConnClient struct {
 	transID int
 	tcurl   string
@@ -205,7 +209,7 @@ func (c *ConnClient) writeCreateStreamMsg() error {
 func (c *ConnClient) writePublishMsg() error {
 	c.transID++
 	c.curcmdName = cmdPublish
-	if err := c.writeMsg(cmdPublish, c.transID, nil, c.name, publishLive); err != nil {
+	if err := c.writeMsg(cmdPublish, c.transID, nil, c.streamName(), publishLive); err != nil {
 		return err
 	}
 	return c.readRespMsg()
@@ -215,13 +219,27 @@ func (c *ConnClient) writePlayMsg() error {
 	c.transID++
 	c.curcmdName = cmdPlay
 
-	if err := c.writeMsg(cmdPlay, 0, nil, c.name); err != nil {
+	if err := c.writeMsg(cmdPlay, 0, nil, c.streamName()); err != nil {
 		return err
 	}
 	return c.readRespMsg()
 }
 
+// streamName is the stream name with the query of the url, servers read parameters like tokens from it.
+func (c *ConnClient) streamName() string {
+	if c.query == "" {
+		return c.name
+	}
+	return c.name + "?" + c.query
+}
+
 func (c *ConnClient) Start(url string, method string) error {
+	return c.StartContext(context.Background(), url, method)
+}
+
+// StartContext is Start giving up once ctx is done, the handshake and the connect, play or publish
+// commands included.
+func (c *ConnClient) StartContext(ctx context.Context, url string, method string) error {
 	u, err := neturl.Parse(url)
 	if err != nil {
 		return err
@@ -243,13 +261,14 @@ func (c *ConnClient) Start(url string, method string) error {
 	c.tcurl = "rtmp://" + u.Host + "/" + c.app
 
 	var conn net.Conn
+	dialer := &net.Dialer{Timeout: dialTimeout}
 	if u.Scheme == "rtmp" {
-		conn, err = net.Dial("tcp", u.Host)
+		conn, err = dialer.DialContext(ctx, "tcp", u.Host)
 		if err != nil {
 			return err
 		}
 	} else if u.Scheme == "rtmps" {
-		conn, err = tls.Dial("tcp", u.Host, c.tls)
+		conn, err = (&tls.Dialer{NetDialer: dialer, Config: c.tls}).DialContext(ctx, "tcp", u.Host)
 		if err != nil {
 			return err
 		}
@@ -259,6 +278,32 @@ func (c *ConnClient) Start(url string, method string) error {
 
 	c.conn = NewConn(conn, 4*1024)
 
+	// a done ctx expires the deadline, which fails the pending read or write.
+	if deadline, ok := ctx.Deadline(); ok {
+		_ = conn.SetDeadline(deadline)
+	}
+	stop := make(chan struct{})
+	stopped := make(chan struct{})
+	go func() {
+		defer close(stopped)
+		select {
+		case <-ctx.Done():
+			_ = conn.SetDeadline(time.Unix(1, 0))
+		case <-stop:
+		}
+	}()
+
+	err = c.start(method)
+	close(stop)
+	<-stopped
+	if ctx.Err() != nil {
+		return ctx.Err()
+	}
+	_ = conn.SetDeadline(time.Time{})
+	return err
+}
+
+func (c *ConnClient) start(method string) error {
 	if err := c.conn.HandshakeClient(); err != nil {
 		return err
 	}
@@ -317,5 +362,8 @@ func (c *ConnClient) GetStreamId() uint32 {
 }
 
 func (c *ConnClient) Close() error {
+	if c.conn == nil {
+		return nil
+	}
 	return c.conn.Close()
 }
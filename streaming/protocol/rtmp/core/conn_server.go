@@ -3,9 +3,10 @@ package core
 import (
 	"bytes"
 	"fmt"
-	"io"
+	"net/url"
+	"strings"
+	"sync"
 
-	"github.com/sirupsen/logrus"
 	"github.com/viderstv/common/streaming/av"
 	"github.com/viderstv/common/streaming/protocol/amf"
 )
@@ -53,20 +54,38 @@ type ConnectEvent struct {
 type PublishInfo struct {
 	Name string
 	Type string
+	// Params are the query parameters passed after the stream name, for example key?token=abc.
+	Params url.Values
 }
 
 type ConnServer struct {
-	done          bool
-	streamID      int
-	isPublisher   bool
-	conn          *Conn
-	transactionID int
-	ConnInfo      ConnectInfo
-	PublishInfo   PublishInfo
-	decoder       *amf.Decoder
-	encoder       *amf.Encoder
-	bytesw        *bytes.Buffer
-	cb            func() error
+	done        bool
+	streamID    int
+	isPublisher bool
+	conn        *Conn
+	ConnInfo    ConnectInfo
+	PublishInfo PublishInfo
+	// ConnParams are the query parameters of the tcUrl and app.
+	ConnParams url.Values
+	encoder    *amf.Encoder
+	bytesw     *bytes.Buffer
+	cb         func() error
+	streamCb   func(ns *NetStream) error
+	connectCb  func() error
+	// writeMtx serializes command responses with media writes once the stream is running.
+	writeMtx sync.Mutex
+
+	// lastStreamID is the last message stream id handed out by createStream.
+	lastStreamID int
+	// current is the stream of the last publish or play, pending is set until AcceptStream returns it.
+	current *NetStream
+	pending *NetStream
+
+	streamsMtx sync.Mutex
+	streams    map[uint32]*NetStream
+	accept     chan *NetStream
+	demuxOnce  sync.Once
+	readErr    error
 }
 
 func NewConnServer(conn *Conn) *ConnServer {
@@ -74,12 +93,16 @@ func NewConnServer(conn *Conn) *ConnServer {
 		conn:     conn,
 		streamID: 1,
 		bytesw:   bytes.NewBuffer(nil),
-		decoder:  &amf.Decoder{},
 		encoder:  &amf.Encoder{},
+		streams:  map[uint32]*NetStream{},
+		accept:   make(chan *NetStream),
 	}
 }
 
 func (c *ConnServer) writeMsg(csid, streamID uint32, args ...interface{}) error {
+	c.writeMtx.Lock()
+	defer c.writeMtx.Unlock()
+
 	c.bytesw.Reset()
 	for _, v := range args {
 		if _, err := c.encoder.Encode(c.bytesw, v, amf.AMF0); err != nil {
@@ -108,21 +131,20 @@ func (c *ConnServer) connect(vs []interface{}) error {
 		switch m := v.(type) {
 		case string:
 		case float64:
-			id := int(m)
-			if id != 1 {
+			if int(m) != 1 {
 				return ErrReq
 			}
-			c.transactionID = id
 		case amf.Object:
 			obimap := v.(amf.Object)
-			if app, ok := obimap["app"]; ok {
-				c.ConnInfo.App = app.(string)
+			c.ConnParams = url.Values{}
+			if app, ok := obimap["app"].(string); ok {
+				c.ConnInfo.App = splitQuery(app, c.ConnParams)
 			}
 			if flashVer, ok := obimap["flashVer"]; ok {
 				c.ConnInfo.Flashver = flashVer.(string)
 			}
-			if tcurl, ok := obimap["tcUrl"]; ok {
-				c.ConnInfo.TcUrl = tcurl.(string)
+			if tcurl, ok := obimap["tcUrl"].(string); ok {
+				c.ConnInfo.TcUrl = splitQuery(tcurl, c.ConnParams)
 			}
 			if encoding, ok := obimap["objectEncoding"]; ok {
 				c.ConnInfo.ObjectEncoding = int(encoding.(float64))
@@ -140,12 +162,34 @@ func (c *ConnServer) fcPublish(vs []interface{}) error {
 	return nil
 }
 
+// SetCallbackAuth is called on publish and play, a *StatusError is sent to the client as onStatus.
 func (c *ConnServer) SetCallbackAuth(callback func() error) {
 	c.cb = callback
 }
 
-func (c *ConnServer) connectResp(cur *ChunkStream) error {
-	chunk := c.conn.NewWindowAckSize(2500000)
+// SetCallbackStreamAuth is called instead of the SetCallbackAuth callback with the stream being started,
+// the callback may update the stream info.
+func (c *ConnServer) SetCallbackStreamAuth(callback func(ns *NetStream) error) {
+	c.streamCb = callback
+}
+
+func (c *ConnServer) authStream(ns *NetStream) error {
+	if c.streamCb != nil {
+		return c.streamCb(ns)
+	}
+	if c.cb != nil {
+		return c.cb()
+	}
+	return nil
+}
+
+// SetCallbackConnect is called once the connect command is parsed, an error rejects the connection with _error.
+func (c *ConnServer) SetCallbackConnect(callback func() error) {
+	c.connectCb = callback
+}
+
+func (c *ConnServer) connectResp(cur *ChunkStream, transactionID int) error {
+	chunk := c.conn.NewWindowAckSize(c.conn.windowAckSize)
 	err := c.conn.Write(&chunk)
 	if err != nil {
 		return err
@@ -170,23 +214,18 @@ func (c *ConnServer) connectResp(cur *ChunkStream) error {
 	event["code"] = "NetConnection.Connect.Success"
 	event["description"] = "Connection succeeded."
 	event["objectEncoding"] = c.ConnInfo.ObjectEncoding
-	return c.writeMsg(cur.CSID, cur.StreamID, "_result", c.transactionID, resp, event)
+	return c.writeMsg(cur.CSID, cur.StreamID, "_result", transactionID, resp, event)
 }
 
 func (c *ConnServer) createStream(vs []interface{}) error {
-	for _, v := range vs {
-		switch m := v.(type) {
-		case string:
-		case float64:
-			c.transactionID = int(m)
-		case amf.Object:
-		}
-	}
+	// every createStream gets its own message stream.
+	c.lastStreamID++
+	c.streamID = c.lastStreamID
 	return nil
 }
 
-func (c *ConnServer) createStreamResp(cur *ChunkStream) error {
-	return c.writeMsg(cur.CSID, cur.StreamID, "_result", c.transactionID, nil, c.streamID)
+func (c *ConnServer) createStreamResp(cur *ChunkStream, transactionID int) error {
+	return c.writeMsg(cur.CSID, cur.StreamID, "_result", transactionID, nil, c.streamID)
 }
 
 func (c *ConnServer) publishOrPlay(vs []interface{}) error {
@@ -194,20 +233,49 @@ func (c *ConnServer) publishOrPlay(vs []interface{}) error {
 		switch m := v.(type) {
 		case string:
 			if k == 2 {
-				c.PublishInfo.Name = m
+				c.PublishInfo.Params = url.Values{}
+				c.PublishInfo.Name = splitQuery(m, c.PublishInfo.Params)
 			} else if k == 3 {
 				c.PublishInfo.Type = m
 			}
-		case float64:
-			id := int(m)
-			c.transactionID = id
-		case amf.Object:
 		}
 	}
 
 	return nil
 }
 
+// splitQuery strips the query from s and adds its parameters to params.
+func splitQuery(s string, params url.Values) string {
+	i := strings.IndexByte(s, '?')
+	if i < 0 {
+		return s
+	}
+	if q, err := url.ParseQuery(s[i+1:]); err == nil {
+		for k, v := range q {
+			params[k] = append(params[k], v...)
+		}
+	}
+	return s[:i]
+}
+
+// statusResp rejects a publish or play with an error onStatus.
+func (c *ConnServer) statusResp(cur *ChunkStream, status *StatusError) error {
+	event := make(amf.Object)
+	event["level"] = "error"
+	event["code"] = status.Code
+	event["description"] = status.Description
+	return c.writeMsg(cur.CSID, cur.StreamID, "onStatus", 0, nil, event)
+}
+
+// errorResp answers a transaction with _error.
+func (c *ConnServer) errorResp(cur *ChunkStream, transactionID int, status *StatusError) error {
+	event := make(amf.Object)
+	event["level"] = "error"
+	event["code"] = status.Code
+	event["description"] = status.Description
+	return c.writeMsg(cur.CSID, cur.StreamID, "_error", transactionID, nil, event)
+}
+
 func (c *ConnServer) publishResp(cur *ChunkStream) error {
 	event := make(amf.Object)
 	event["level"] = "status"
@@ -258,69 +326,67 @@ func (c *ConnServer) playResp(cur *ChunkStream) error {
 }
 
 func (c *ConnServer) HandleCmdMsg(chunk *ChunkStream) error {
-	amfType := amf.AMF0
-	if chunk.TypeID == 17 {
-		chunk.Data = chunk.Data[1:]
-	}
-	r := bytes.NewReader(chunk.Data)
-	vs, err := c.decoder.DecodeBatch(r, amf.Version(amfType))
-	if err != nil && err != io.EOF {
+	decoded, err := c.decodeCmd(chunk)
+	if err != nil {
 		return err
 	}
-	switch cmd := vs[0].(type) {
-	case string:
-		switch cmd {
-		case cmdConnect:
-			if err = c.connect(vs[1:]); err != nil {
-				return err
-			}
-			if err = c.connectResp(chunk); err != nil {
-				return err
-			}
-		case cmdCreateStream:
-			if err = c.createStream(vs[1:]); err != nil {
-				return err
-			}
-			if err = c.createStreamResp(chunk); err != nil {
-				return err
-			}
-		case cmdPublish:
-			c.isPublisher = true
-			if err = c.publishOrPlay(vs[1:]); err != nil {
-				return err
-			}
-			if c.cb != nil {
-				if err := c.cb(); err != nil {
-					return err
-				}
-			}
-			if err = c.publishResp(chunk); err != nil {
-				return err
-			}
-			c.done = true
-		case cmdPlay:
-			if err = c.publishOrPlay(vs[1:]); err != nil {
+	vs := decoded.Values
+	switch decoded.Name {
+	case cmdConnect:
+		if err = c.connect(vs[1:]); err != nil {
+			_ = c.errorResp(chunk, decoded.TransactionID, asStatusError(err, StatusConnectRejected))
+			return err
+		}
+		if c.connectCb != nil {
+			if err = c.connectCb(); err != nil {
+				_ = c.errorResp(chunk, decoded.TransactionID, asStatusError(err, StatusConnectRejected))
 				return err
 			}
-			if c.cb != nil {
-				if err := c.cb(); err != nil {
-					return err
-				}
-			}
-			if err = c.playResp(chunk); err != nil {
-				return err
+		}
+		if err = c.connectResp(chunk, decoded.TransactionID); err != nil {
+			return err
+		}
+	case cmdCreateStream:
+		if err = c.createStream(vs[1:]); err != nil {
+			_ = c.errorResp(chunk, decoded.TransactionID, asStatusError(err, StatusCallFailed))
+			return err
+		}
+		if err = c.createStreamResp(chunk, decoded.TransactionID); err != nil {
+			return err
+		}
+	case cmdPublish, cmdPlay:
+		publisher := decoded.Name == cmdPublish
+		c.isPublisher = publisher
+		if err = c.publishOrPlay(vs[1:]); err != nil {
+			return err
+		}
+		ns := c.newStream(chunk.StreamID, publisher)
+		if err := c.authStream(ns); err != nil {
+			code := StatusPlayStreamNotFound
+			if publisher {
+				code = StatusPublishUnauthorized
 			}
-			c.done = true
-			c.isPublisher = false
-		case cmdFcpublish:
-			return c.fcPublish(vs)
-		case cmdReleaseStream:
-			return c.releaseStream(vs)
-		case cmdFCUnpublish:
-		case cmdDeleteStream:
-		default:
-			logrus.Error("no support command=", vs[0].(string))
+			_ = c.statusResp(chunk, asStatusError(err, code))
+			return err
 		}
+		if publisher {
+			err = c.publishResp(chunk)
+		} else {
+			err = c.playResp(chunk)
+		}
+		if err != nil {
+			return err
+		}
+		c.current = ns
+		c.pending = ns
+		c.done = true
+	case cmdFcpublish:
+		return c.fcPublish(vs)
+	case cmdReleaseStream:
+		return c.releaseStream(vs)
+	case "":
+	default:
+		return c.streamCmd(chunk, decoded, nil)
 	}
 
 	return nil
@@ -358,14 +424,28 @@ func (c *ConnServer) Write(chunk ChunkStream) error {
 		}
 		chunk.Length = uint32(len(chunk.Data))
 	}
+	if chunk.TypeID == av.TAG_AUDIO || chunk.TypeID == av.TAG_VIDEO {
+		// waiting holds no lock, the acknowledgements come in on the reading side.
+		c.conn.WaitWindow()
+	}
+
+	c.writeMtx.Lock()
+	defer c.writeMtx.Unlock()
 	return c.conn.Write(&chunk)
 }
 
+// FlowStats returns the outbound flow control state of the connection, all streams share it.
+func (c *ConnServer) FlowStats() FlowStats {
+	return c.conn.FlowStats()
+}
+
 func (c *ConnServer) Close() error {
 	return c.conn.Close()
 }
 
 func (c *ConnServer) Flush() error {
+	c.writeMtx.Lock()
+	defer c.writeMtx.Unlock()
 	return c.conn.Flush()
 }
 
@@ -374,9 +454,19 @@ func (c *ConnServer) Read(chunk *ChunkStream) (err error) {
 }
 
 func (c *ConnServer) GetInfo() av.Info {
+	// parameters of the stream name win over the ones of the connect url.
+	params := url.Values{}
+	for k, v := range c.ConnParams {
+		params[k] = v
+	}
+	for k, v := range c.PublishInfo.Params {
+		params[k] = v
+	}
+
 	return av.Info{
-		Name: c.PublishInfo.Name,
-		App:  c.ConnInfo.App,
-		URL:  c.ConnInfo.TcUrl + "/" + c.PublishInfo.Name,
+		Name:   c.PublishInfo.Name,
+		App:    c.ConnInfo.App,
+		URL:    c.ConnInfo.TcUrl + "/" + c.PublishInfo.Name,
+		Params: params,
 	}
 }
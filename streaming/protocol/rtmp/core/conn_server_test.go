@@ -0,0 +1,462 @@
+package core
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/viderstv/common/streaming/protocol/amf"
+)
+
+// testClient plays the encoder side of a ConnServer over a pipe.
+type testClient struct {
+	t    *testing.T
+	conn *Conn
+	enc  amf.Encoder
+	dec  amf.Decoder
+}
+
+func newTestPair(t *testing.T) (*ConnServer, *testClient) {
+	c1, c2 := net.Pipe()
+	t.Cleanup(func() {
+		_ = c1.Close()
+		_ = c2.Close()
+	})
+	_ = c2.SetDeadline(time.Now().Add(time.Second * 5))
+
+	return NewConnServer(NewConn(c1, 4*1024)), &testClient{t: t, conn: NewConn(c2, 4*1024)}
+}
+
+func (c *testClient) command(streamID uint32, args ...interface{}) {
+	buf := bytes.NewBuffer(nil)
+	for _, v := range args {
+		if _, err := c.enc.Encode(buf, v, amf.AMF0); err != nil {
+			c.t.Fatal(err)
+		}
+	}
+	chunk := ChunkStream{
+		Format:   0,
+		CSID:     3,
+		TypeID:   20,
+		StreamID: streamID,
+		Length:   uint32(buf.Len()),
+		Data:     buf.Bytes(),
+	}
+	if err := c.conn.Write(&chunk); err != nil {
+		c.t.Fatal(err)
+	}
+	if err := c.conn.Flush(); err != nil {
+		c.t.Fatal(err)
+	}
+}
+
+// read returns the next command message, control messages are skipped.
+func (c *testClient) read() []interface{} {
+	var chunk ChunkStream
+	for {
+		if err := c.conn.Read(&chunk); err != nil {
+			c.t.Fatal(err)
+		}
+		if chunk.TypeID == 20 {
+			break
+		}
+	}
+	vs, err := c.dec.DecodeBatch(bytes.NewReader(chunk.Data), amf.AMF0)
+	if err != nil && len(vs) == 0 {
+		c.t.Fatal(err)
+	}
+	return vs
+}
+
+func (c *testClient) connect(tcUrl string) {
+	c.command(0, "connect", 1, amf.Object{"app": "live", "tcUrl": tcUrl, "flashVer": "FMLE/3.0"})
+	if vs := c.read(); vs[0] != "_result" {
+		c.t.Fatalf("unexpected connect response %v", vs)
+	}
+}
+
+func (c *testClient) createStream() {
+	c.command(0, "createStream", 2, nil)
+	if vs := c.read(); vs[0] != "_result" {
+		c.t.Fatalf("unexpected createStream response %v", vs)
+	}
+}
+
+func TestConnServerParams(t *testing.T) {
+	at := assert.New(t)
+
+	server, client := newTestPair(t)
+	done := make(chan error, 1)
+	go func() {
+		done <- server.ReadMsg()
+	}()
+
+	client.connect("rtmp://localhost/live?token=abc&region=eu")
+	client.createStream()
+	client.command(1, "publish", 3, nil, "stream?region=us", "live")
+	vs := client.read()
+	at.Equal(vs[0], "onStatus")
+	at.Equal(vs[3].(amf.Object)["code"], "NetStream.Publish.Start")
+	at.Equal(<-done, nil)
+
+	info := server.GetInfo()
+	at.Equal(info.App, "live")
+	at.Equal(info.Name, "stream")
+	at.Equal(info.URL, "rtmp://localhost/live/stream")
+	at.Equal(info.Params.Get("token"), "abc")
+	at.Equal(info.Params.Get("region"), "us")
+}
+
+func TestConnServerRejectPublish(t *testing.T) {
+	at := assert.New(t)
+
+	server, client := newTestPair(t)
+	server.SetCallbackAuth(func() error {
+		return NewStatusError(StatusPublishBadName, "Missing stream key.")
+	})
+	done := make(chan error, 1)
+	go func() {
+		done <- server.ReadMsg()
+	}()
+
+	client.connect("rtmp://localhost/live")
+	client.createStream()
+	client.command(1, "publish", 3, nil, "", "live")
+	vs := client.read()
+	at.Equal(vs[0], "onStatus")
+	event := vs[3].(amf.Object)
+	at.Equal(event["level"], "error")
+	at.Equal(event["code"], StatusPublishBadName)
+	at.Equal(event["description"], "Missing stream key.")
+
+	err := <-done
+	at.Equal(err.Error(), StatusPublishBadName+": Missing stream key.")
+}
+
+func TestConnServerRejectConnect(t *testing.T) {
+	at := assert.New(t)
+
+	server, client := newTestPair(t)
+	server.SetCallbackConnect(func() error {
+		if server.GetInfo().App != "live" {
+			return fmt.Errorf("unknown app")
+		}
+		return NewStatusError(StatusConnectRejected, "Maintenance.")
+	})
+	done := make(chan error, 1)
+	go func() {
+		done <- server.ReadMsg()
+	}()
+
+	client.command(0, "connect", 1, amf.Object{"app": "live", "tcUrl": "rtmp://localhost/live"})
+	vs := client.read()
+	at.Equal(vs[0], "_error")
+	at.Equal(vs[1], float64(1))
+	event := vs[3].(amf.Object)
+	at.Equal(event["level"], "error")
+	at.Equal(event["code"], StatusConnectRejected)
+	at.Equal(event["description"], "Maintenance.")
+	at.NotEqual(<-done, nil)
+
+	server, client = newTestPair(t)
+	go func() {
+		done <- server.ReadMsg()
+	}()
+
+	// connect must be the first transaction
+	client.command(0, "connect", 5, amf.Object{"app": "live"})
+	vs = client.read()
+	at.Equal(vs[0], "_error")
+	at.Equal(vs[1], float64(5))
+	at.Equal(vs[3].(amf.Object)["description"], ErrReq.Error())
+	at.Equal(<-done, ErrReq)
+}
+
+func TestConnServerRejectPlay(t *testing.T) {
+	at := assert.New(t)
+
+	server, client := newTestPair(t)
+	server.SetCallbackAuth(func() error {
+		return fmt.Errorf("stream is offline")
+	})
+	done := make(chan error, 1)
+	go func() {
+		done <- server.ReadMsg()
+	}()
+
+	client.connect("rtmp://localhost/live")
+	client.createStream()
+	client.command(1, "play", 3, nil, "stream")
+	vs := client.read()
+	at.Equal(vs[0], "onStatus")
+	event := vs[3].(amf.Object)
+	at.Equal(event["code"], StatusPlayStreamNotFound)
+	at.Equal(event["description"], "stream is offline")
+	at.NotEqual(<-done, nil)
+}
+
+// serveStream runs the handshake and answers stream commands like VirReader and VirWriter do.
+func serveStream(server *ConnServer) <-chan Command {
+	cmds := make(chan Command, 16)
+	go func() {
+		defer close(cmds)
+		if err := server.ReadMsg(); err != nil {
+			return
+		}
+		var chunk ChunkStream
+		for {
+			if err := server.Read(&chunk); err != nil {
+				return
+			}
+			if chunk.TypeID != 20 && chunk.TypeID != 17 {
+				continue
+			}
+			cmd, err := server.HandleStreamCmd(&chunk)
+			if err != nil {
+				return
+			}
+			cmds <- cmd
+		}
+	}()
+	return cmds
+}
+
+func TestConnServerPublishSequence(t *testing.T) {
+	at := assert.New(t)
+
+	// recorded from obs
+	server, client := newTestPair(t)
+	cmds := serveStream(server)
+
+	client.connect("rtmp://localhost/live")
+	client.command(0, "releaseStream", 2, nil, "key")
+	client.command(0, "FCPublish", 3, nil, "key")
+	client.createStream()
+	client.command(1, "publish", 5, nil, "key", "live")
+	vs := client.read()
+	at.Equal(vs[3].(amf.Object)["code"], "NetStream.Publish.Start")
+	at.True(server.IsPublisher())
+
+	client.command(1, "FCUnpublish", 6, nil, "key")
+	vs = client.read()
+	at.Equal(vs[0], "onStatus")
+	at.Equal(vs[3].(amf.Object)["code"], "NetStream.Unpublish.Success")
+	cmd := <-cmds
+	at.Equal(cmd.Name, "FCUnpublish")
+	at.True(cmd.EndsStream())
+	at.True(server.Unpublished())
+
+	// only the first end of stream is answered
+	client.command(1, "deleteStream", 7, nil, 1)
+	cmd = <-cmds
+	at.Equal(cmd.Name, "deleteStream")
+	at.True(cmd.EndsStream())
+}
+
+func TestConnServerPlaySequence(t *testing.T) {
+	at := assert.New(t)
+
+	// recorded from ffplay
+	server, client := newTestPair(t)
+	cmds := serveStream(server)
+
+	client.connect("rtmp://localhost/live")
+	client.createStream()
+	client.command(0, "_checkbw", 3, nil)
+	vs := client.read()
+	at.Equal(vs[0], "_result")
+	at.Equal(vs[1], float64(3))
+	client.command(1, "getStreamLength", 4, nil, "stream")
+	vs = client.read()
+	at.Equal(vs[0], "_result")
+	at.Equal(vs[1], float64(4))
+	at.Equal(vs[3], float64(0))
+	client.command(1, "play", 5, nil, "stream", -2000)
+	for _, code := range []string{"NetStream.Play.Reset", "NetStream.Play.Start", "NetStream.Data.Start", "NetStream.Play.PublishNotify"} {
+		vs = client.read()
+		at.Equal(vs[3].(amf.Object)["code"], code)
+	}
+
+	client.command(1, "receiveVideo", 0, nil, false)
+	cmd := <-cmds
+	at.False(server.IsPublisher())
+	at.Equal(cmd.Name, CmdReceiveVideo)
+	at.False(cmd.Flag(0))
+
+	client.command(1, "pause", 6, nil, true, 1500)
+	vs = client.read()
+	at.Equal(vs[3].(amf.Object)["code"], "NetStream.Pause.Notify")
+	cmd = <-cmds
+	at.Equal(cmd.Name, CmdPause)
+	at.True(cmd.Flag(0))
+	at.Equal(cmd.Arg(1), float64(1500))
+
+	client.command(1, "pause", 7, nil, false, 1500)
+	vs = client.read()
+	at.Equal(vs[3].(amf.Object)["code"], "NetStream.Unpause.Notify")
+	<-cmds
+
+	client.command(1, "seek", 8, nil, 0)
+	vs = client.read()
+	at.Equal(vs[3].(amf.Object)["code"], "NetStream.Seek.Failed")
+	<-cmds
+
+	client.command(0, "fooBar", 9, nil)
+	vs = client.read()
+	at.Equal(vs[0], "_error")
+	at.Equal(vs[1], float64(9))
+	at.Equal(vs[3].(amf.Object)["code"], StatusCallFailed)
+	<-cmds
+
+	// notifications are never answered
+	client.command(0, "fooBar", 0, nil)
+	<-cmds
+	client.command(1, "closeStream", 0, nil)
+	cmd = <-cmds
+	at.True(cmd.EndsStream())
+	at.False(server.Unpublished())
+}
+
+func (c *testClient) media(streamID uint32, typeID uint32, data []byte) {
+	chunk := ChunkStream{
+		Format:   0,
+		CSID:     6,
+		TypeID:   typeID,
+		StreamID: streamID,
+		Length:   uint32(len(data)),
+		Data:     data,
+	}
+	if err := c.conn.Write(&chunk); err != nil {
+		c.t.Fatal(err)
+	}
+	if err := c.conn.Flush(); err != nil {
+		c.t.Fatal(err)
+	}
+}
+
+func TestConnServerMultipleStreams(t *testing.T) {
+	at := assert.New(t)
+
+	server, client := newTestPair(t)
+	server.SetCallbackStreamAuth(func(ns *NetStream) error {
+		if ns.Info.Name == "denied" {
+			return NewStatusError(StatusPublishUnauthorized, "Invalid stream key.")
+		}
+		ns.Info.Key = fmt.Sprintf("key-%d", ns.ID)
+		return nil
+	})
+	accepted := make(chan *NetStream, 2)
+	go func() {
+		defer close(accepted)
+		for {
+			ns, err := server.AcceptStream()
+			if err != nil {
+				return
+			}
+			accepted <- ns
+		}
+	}()
+
+	client.connect("rtmp://localhost/live")
+	for i, name := range []string{"first", "second"} {
+		client.command(0, "createStream", 2+i, nil)
+		vs := client.read()
+		at.Equal(vs[3], float64(i+1))
+		client.command(uint32(i+1), "publish", 0, nil, name, "live")
+		vs = client.read()
+		at.Equal(vs[3].(amf.Object)["code"], "NetStream.Publish.Start")
+	}
+	first, second := <-accepted, <-accepted
+	at.Equal(first.ID, uint32(1))
+	at.Equal(first.Info.Name, "first")
+	at.Equal(first.Info.Key, "key-1")
+	at.True(first.IsPublisher())
+	at.Equal(second.ID, uint32(2))
+	at.Equal(second.Info.Name, "second")
+
+	// a rejected stream leaves the running ones alone
+	client.command(0, "createStream", 4, nil)
+	client.read()
+	client.command(3, "publish", 0, nil, "denied", "live")
+	vs := client.read()
+	at.Equal(vs[3].(amf.Object)["code"], StatusPublishUnauthorized)
+
+	client.media(2, 9, []byte{0x17, 0x01})
+	client.media(1, 8, []byte{0xaf, 0x01})
+
+	var chunk ChunkStream
+	at.Equal(second.Read(&chunk), nil)
+	at.Equal(chunk.TypeID, uint32(9))
+	at.Equal(chunk.Data, []byte{0x17, 0x01})
+	at.Equal(first.Read(&chunk), nil)
+	at.Equal(chunk.TypeID, uint32(8))
+
+	// deleteStream is sent on stream 0 and names the stream
+	client.command(0, "deleteStream", 5, nil, 2)
+	at.Equal(second.Read(&chunk), nil)
+	cmds := make(chan Command, 1)
+	go func() {
+		cmd, _ := second.HandleStreamCmd(&chunk)
+		cmds <- cmd
+	}()
+	vs = client.read()
+	at.Equal((<-cmds).Name, "deleteStream")
+	at.Equal(vs[3].(amf.Object)["code"], "NetStream.Unpublish.Success")
+	at.True(second.Unpublished())
+	at.False(first.Unpublished())
+	at.Equal(second.Close(), nil)
+
+	client.media(1, 8, []byte{0xaf, 0x01, 0x02})
+	at.Equal(first.Read(&chunk), nil)
+	at.Equal(chunk.Data, []byte{0xaf, 0x01, 0x02})
+
+	// the connection ends with its last stream
+	at.Equal(first.Close(), nil)
+	_, ok := <-accepted
+	at.False(ok)
+}
+
+func TestConnServerSlowStream(t *testing.T) {
+	at := assert.New(t)
+
+	server, client := newTestPair(t)
+	accepted := make(chan *NetStream, 2)
+	go func() {
+		for {
+			ns, err := server.AcceptStream()
+			if err != nil {
+				return
+			}
+			accepted <- ns
+		}
+	}()
+
+	client.connect("rtmp://localhost/live")
+	for i, name := range []string{"slow", "fast"} {
+		client.command(0, "createStream", 2+i, nil)
+		client.read()
+		client.command(uint32(i+1), "publish", 0, nil, name, "live")
+		client.read()
+	}
+	slow, fast := <-accepted, <-accepted
+
+	// the slow stream is never read, it is closed once its queue stays full
+	for i := 0; i <= netStreamQueueNum; i++ {
+		client.media(1, 8, []byte{0xaf, 0x01})
+	}
+	client.media(2, 9, []byte{0x17, 0x01})
+
+	var chunk ChunkStream
+	at.Equal(fast.Read(&chunk), nil)
+	at.Equal(chunk.TypeID, uint32(9))
+
+	var err error
+	for err == nil {
+		err = slow.Read(&chunk)
+	}
+	at.Equal(err, io.EOF)
+}
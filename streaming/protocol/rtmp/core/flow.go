@@ -0,0 +1,215 @@
+package core
+
+import (
+	"sync"
+	"time"
+)
+
+const (
+	flowSampleNum = 32
+	// ackWaitTimeout bounds how long a media write waits for the peer to acknowledge the window,
+	// a peer which stops acknowledging is treated as congested instead of stalling the stream. Writes do
+	// not wait again until the next acknowledgement.
+	ackWaitTimeout = 5 * time.Second
+	// congestedFill is the window fill from which the connection counts as congested,
+	// the peer acknowledges every half window so more than one acknowledgement is overdue.
+	congestedFill = 0.5
+)
+
+// FlowStats describes the outbound side of a connection measured from the acknowledgements of the peer.
+type FlowStats struct {
+	// BytesSent is the number of bytes written to the connection, the handshake included.
+	BytesSent uint64
+	// BytesAcked is the number of bytes the peer acknowledged.
+	BytesAcked uint64
+	// Window is the number of unacknowledged bytes allowed in flight.
+	Window uint32
+	// Acking reports if the peer acknowledged at all, flow control only applies once it did.
+	Acking bool
+	// RTT is the smoothed time from writing bytes to their acknowledgement, buffering on the way included.
+	RTT time.Duration
+	// Throughput is the smoothed acknowledged rate in bytes per second.
+	Throughput float64
+	// Stalls counts the writes which gave up waiting for an acknowledgement.
+	Stalls uint64
+}
+
+// InFlight returns the number of bytes sent but not acknowledged yet.
+func (s FlowStats) InFlight() uint64 {
+	if s.BytesAcked >= s.BytesSent {
+		return 0
+	}
+	return s.BytesSent - s.BytesAcked
+}
+
+// Congestion returns the fill of the window, 1 and above means writes wait for the peer.
+// Peers which never acknowledged report 0.
+func (s FlowStats) Congestion() float64 {
+	if !s.Acking || s.Window == 0 {
+		return 0
+	}
+	return float64(s.InFlight()) / float64(s.Window)
+}
+
+// Congested reports if the peer falls behind reading the connection.
+func (s FlowStats) Congested() bool {
+	return s.Congestion() >= congestedFill
+}
+
+type flowSample struct {
+	sent uint64
+	at   time.Time
+}
+
+// flowControl tracks the acknowledgements of the peer, the zero value is ready to use.
+type flowControl struct {
+	mtx sync.Mutex
+
+	acked         uint64
+	lastSeq       uint32
+	acking        bool
+	peerBandwidth uint32
+
+	samples [flowSampleNum]flowSample
+	next    int
+
+	rtt        time.Duration
+	throughput float64
+	lastAckAt  time.Time
+	lastAcked  uint64
+	stalls     uint64
+	// stalled is set once a write gave up waiting, writes do not wait until the peer acknowledges again.
+	stalled bool
+
+	wait chan struct{}
+}
+
+// window returns the bytes allowed in flight, twice the acknowledgement window unless the peer limited it.
+// A limit below one and a half windows would stall, the peer only acknowledges once per window.
+func (f *flowControl) window(ackWindow uint32) uint32 {
+	window := 2 * ackWindow
+	if f.peerBandwidth != 0 && f.peerBandwidth < window {
+		window = f.peerBandwidth
+		if floor := ackWindow + ackWindow/2; window < floor {
+			window = floor
+		}
+	}
+	return window
+}
+
+// sent records a sample to measure the round trip time of bytes flushed at this point.
+func (f *flowControl) sent(sent uint64) {
+	f.mtx.Lock()
+	defer f.mtx.Unlock()
+
+	last := f.samples[(f.next+flowSampleNum-1)%flowSampleNum]
+	if sent <= last.sent {
+		return
+	}
+	f.samples[f.next] = flowSample{sent: sent, at: time.Now()}
+	f.next = (f.next + 1) % flowSampleNum
+}
+
+// onAck applies an acknowledgement, seq is the 32 bit byte count of the peer which wraps around.
+func (f *flowControl) onAck(seq uint32, sent uint64) {
+	f.mtx.Lock()
+	defer f.mtx.Unlock()
+
+	now := time.Now()
+	f.acked += uint64(seq - f.lastSeq)
+	f.lastSeq = seq
+	if f.acked > sent {
+		f.acked = sent
+	}
+
+	var sample *flowSample
+	for i := range f.samples {
+		s := &f.samples[i]
+		if !s.at.IsZero() && s.sent <= f.acked && (sample == nil || s.sent > sample.sent) {
+			sample = s
+		}
+	}
+	if sample != nil {
+		rtt := now.Sub(sample.at)
+		if f.rtt == 0 {
+			f.rtt = rtt
+		} else {
+			f.rtt = (7*f.rtt + rtt) / 8
+		}
+		// the sample is used up, later acknowledgements measure newer bytes.
+		*sample = flowSample{}
+	}
+
+	if f.acking {
+		if elapsed := now.Sub(f.lastAckAt).Seconds(); elapsed > 0 {
+			rate := float64(f.acked-f.lastAcked) / elapsed
+			if f.throughput == 0 {
+				f.throughput = rate
+			} else {
+				f.throughput = (3*f.throughput + rate) / 4
+			}
+		}
+	}
+	f.acking = true
+	f.stalled = false
+	f.lastAckAt = now
+	f.lastAcked = f.acked
+
+	if f.wait != nil {
+		close(f.wait)
+		f.wait = nil
+	}
+}
+
+func (f *flowControl) setPeerBandwidth(size uint32) {
+	f.mtx.Lock()
+	defer f.mtx.Unlock()
+	f.peerBandwidth = size
+}
+
+// waitWindow blocks while the window is full, it gives up after ackWaitTimeout and does not block again
+// before the next acknowledgement.
+func (f *flowControl) waitWindow(written func() uint64, ackWindow uint32) {
+	var timeout <-chan time.Time
+	for {
+		f.mtx.Lock()
+		if !f.acking || f.stalled || written()-f.acked < uint64(f.window(ackWindow)) {
+			f.mtx.Unlock()
+			return
+		}
+		if f.wait == nil {
+			f.wait = make(chan struct{})
+		}
+		wait := f.wait
+		f.mtx.Unlock()
+
+		if timeout == nil {
+			timer := time.NewTimer(ackWaitTimeout)
+			defer timer.Stop()
+			timeout = timer.C
+		}
+		select {
+		case <-wait:
+		case <-timeout:
+			f.mtx.Lock()
+			f.stalls++
+			f.stalled = true
+			f.mtx.Unlock()
+			return
+		}
+	}
+}
+
+func (f *flowControl) stats(sent uint64, ackWindow uint32) FlowStats {
+	f.mtx.Lock()
+	defer f.mtx.Unlock()
+	return FlowStats{
+		BytesSent:  sent,
+		BytesAcked: f.acked,
+		Window:     f.window(ackWindow),
+		Acking:     f.acking,
+		RTT:        f.rtt,
+		Throughput: f.throughput,
+		Stalls:     f.stalls,
+	}
+}
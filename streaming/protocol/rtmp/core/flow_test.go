@@ -0,0 +1,132 @@
+package core
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/viderstv/common/utils/pool"
+)
+
+func TestFlowWindow(t *testing.T) {
+	at := assert.New(t)
+
+	f := flowControl{}
+	at.Equal(f.window(1000), uint32(2000))
+	f.setPeerBandwidth(1800)
+	at.Equal(f.window(1000), uint32(1800))
+	// the peer acknowledges once per window, less would stall
+	f.setPeerBandwidth(500)
+	at.Equal(f.window(1000), uint32(1500))
+}
+
+func TestFlowAck(t *testing.T) {
+	at := assert.New(t)
+
+	buf := bytes.NewBuffer(nil)
+	conn := &Conn{
+		pool:          pool.NewPool(),
+		rw:            NewReadWriter(buf, 1024),
+		chunkSize:     128,
+		windowAckSize: 1000,
+		chunks:        make(map[uint32]ChunkStream),
+	}
+
+	video := ChunkStream{
+		CSID:     6,
+		TypeID:   9,
+		StreamID: 1,
+		Length:   1500,
+		Data:     make([]byte, 1500),
+	}
+	at.Equal(conn.Write(&video), nil)
+	at.Equal(conn.Flush(), nil)
+
+	stats := conn.FlowStats()
+	at.Equal(stats.BytesSent, uint64(buf.Len()))
+	at.False(stats.Acking)
+	at.False(stats.Congested())
+
+	time.Sleep(10 * time.Millisecond)
+	ack := conn.NewAck(uint32(buf.Len()))
+	conn.handleControlMsg(&ack)
+	stats = conn.FlowStats()
+	at.True(stats.Acking)
+	at.Equal(stats.BytesAcked, uint64(buf.Len()))
+	at.Equal(stats.InFlight(), uint64(0))
+	at.Equal(stats.Window, uint32(2000))
+	at.True(stats.RTT >= 10*time.Millisecond)
+
+	at.Equal(conn.Write(&video), nil)
+	at.Equal(conn.Flush(), nil)
+	at.True(conn.FlowStats().Congested())
+	at.Equal(conn.Write(&video), nil)
+	at.Equal(conn.Flush(), nil)
+	at.True(conn.FlowStats().Congestion() > 1)
+
+	// writes wait for the window until the peer acknowledges
+	done := make(chan struct{})
+	go func() {
+		conn.WaitWindow()
+		close(done)
+	}()
+	select {
+	case <-done:
+		t.Fatal("window is full")
+	case <-time.After(20 * time.Millisecond):
+	}
+	ack = conn.NewAck(uint32(buf.Len()))
+	conn.handleControlMsg(&ack)
+	<-done
+
+	stats = conn.FlowStats()
+	at.Equal(stats.InFlight(), uint64(0))
+	at.True(stats.Throughput > 0)
+	at.Equal(stats.Stalls, uint64(0))
+}
+
+func TestFlowAckWraps(t *testing.T) {
+	at := assert.New(t)
+
+	f := flowControl{}
+	f.onAck(0xfffffff0, 1<<33)
+	f.onAck(0x10, 1<<33)
+	at.Equal(f.acked, uint64(1<<32+0x10))
+}
+
+func TestFlowStalled(t *testing.T) {
+	at := assert.New(t)
+
+	f := flowControl{}
+	f.onAck(0, 0)
+	written := func() uint64 { return 4000 }
+
+	// after a write gave up waiting the window is not awaited until the next acknowledgement
+	f.stalled = true
+	done := make(chan struct{})
+	go func() {
+		f.waitWindow(written, 1000)
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("stalled write waited for the window")
+	}
+
+	f.onAck(1000, 4000)
+	at.False(f.stalled)
+	done = make(chan struct{})
+	go func() {
+		f.waitWindow(written, 1000)
+		close(done)
+	}()
+	select {
+	case <-done:
+		t.Fatal("window is full")
+	case <-time.After(20 * time.Millisecond):
+	}
+	f.onAck(4000, 4000)
+	<-done
+}
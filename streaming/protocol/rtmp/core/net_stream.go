@@ -0,0 +1,266 @@
+package core
+
+import (
+	"io"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/viderstv/common/streaming/av"
+)
+
+const (
+	netStreamQueueNum = 128
+	// netStreamPushTimeout bounds how long the reading goroutine waits for a stream with a full queue, the
+	// stream is closed after it so it does not hold up the other streams of the connection.
+	netStreamPushTimeout = time.Second
+)
+
+// NetStream is a single message stream of a connection, every publish or play on a connection gets its own.
+// It implements the connection interfaces of VirReader and VirWriter.
+type NetStream struct {
+	ID uint32
+	// Info describes the stream, the auth callback may update it.
+	Info av.Info
+
+	server    *ConnServer
+	publisher bool
+	// name is the stream name as sent with publish, FCUnpublish refers to it.
+	name        string
+	unpublished bool
+
+	chunks chan ChunkStream
+	once   sync.Once
+	closed chan struct{}
+}
+
+func (c *ConnServer) newStream(streamID uint32, publisher bool) *NetStream {
+	if streamID == 0 {
+		streamID = uint32(c.streamID)
+	}
+	return &NetStream{
+		ID:        streamID,
+		Info:      c.GetInfo(),
+		server:    c,
+		publisher: publisher,
+		name:      c.PublishInfo.Name,
+		chunks:    make(chan ChunkStream, netStreamQueueNum),
+		closed:    make(chan struct{}),
+	}
+}
+
+func (ns *NetStream) IsPublisher() bool {
+	return ns.publisher
+}
+
+// Unpublished reports if the publisher ended the stream with FCUnpublish, deleteStream or closeStream.
+func (ns *NetStream) Unpublished() bool {
+	return ns.unpublished
+}
+
+// Read returns the next media or command message of this stream.
+func (ns *NetStream) Read(chunk *ChunkStream) error {
+	select {
+	case cs, ok := <-ns.chunks:
+		if !ok {
+			return ns.server.err()
+		}
+		*chunk = cs
+		return nil
+	case <-ns.closed:
+		return io.EOF
+	}
+}
+
+func (ns *NetStream) push(chunk ChunkStream) {
+	select {
+	case ns.chunks <- chunk:
+		return
+	case <-ns.closed:
+		return
+	default:
+	}
+
+	timer := time.NewTimer(netStreamPushTimeout)
+	defer timer.Stop()
+	select {
+	case ns.chunks <- chunk:
+	case <-ns.closed:
+	case <-timer.C:
+		logrus.Debug("rtmp stream falls behind reading the connection, closing it")
+		ns.once.Do(func() {
+			close(ns.closed)
+		})
+	}
+}
+
+func (ns *NetStream) Write(chunk ChunkStream) error {
+	chunk.StreamID = ns.ID
+	return ns.server.Write(chunk)
+}
+
+func (ns *NetStream) Flush() error {
+	return ns.server.Flush()
+}
+
+func (ns *NetStream) FlowStats() FlowStats {
+	return ns.server.FlowStats()
+}
+
+// Close ends this stream, the connection is closed with its last stream.
+func (ns *NetStream) Close() error {
+	ns.once.Do(func() {
+		close(ns.closed)
+	})
+	return ns.server.closeStream(ns)
+}
+
+// HandleStreamCmd answers a command of this stream and returns it decoded.
+func (ns *NetStream) HandleStreamCmd(chunk *ChunkStream) (Command, error) {
+	cmd, err := ns.server.decodeCmd(chunk)
+	if err != nil || cmd.Name == "" {
+		return cmd, err
+	}
+	return cmd, ns.server.streamCmd(chunk, cmd, ns)
+}
+
+func (c *ConnServer) err() error {
+	c.streamsMtx.Lock()
+	defer c.streamsMtx.Unlock()
+	if c.readErr == nil {
+		return io.EOF
+	}
+	return c.readErr
+}
+
+func (c *ConnServer) closeStream(ns *NetStream) error {
+	c.streamsMtx.Lock()
+	if c.streams[ns.ID] == ns {
+		delete(c.streams, ns.ID)
+	}
+	remaining := len(c.streams)
+	c.streamsMtx.Unlock()
+
+	if remaining == 0 {
+		return c.Close()
+	}
+	return nil
+}
+
+func (c *ConnServer) stream(id uint32) *NetStream {
+	c.streamsMtx.Lock()
+	defer c.streamsMtx.Unlock()
+	return c.streams[id]
+}
+
+// route returns the running stream a command belongs to, nil for connection commands.
+func (c *ConnServer) route(chunk *ChunkStream) *NetStream {
+	if chunk.StreamID != 0 {
+		if ns := c.stream(chunk.StreamID); ns != nil {
+			return ns
+		}
+	}
+
+	cmd, err := c.decodeCmd(chunk)
+	if err != nil {
+		return nil
+	}
+	switch cmd.Name {
+	case cmdDeleteStream:
+		if id, ok := cmd.Arg(0).(float64); ok {
+			return c.stream(uint32(id))
+		}
+	case cmdFCUnpublish:
+		name, _ := cmd.Arg(0).(string)
+		if i := strings.IndexByte(name, '?'); i >= 0 {
+			name = name[:i]
+		}
+		c.streamsMtx.Lock()
+		defer c.streamsMtx.Unlock()
+		for _, ns := range c.streams {
+			if ns.publisher && ns.name == name {
+				return ns
+			}
+		}
+	}
+	return nil
+}
+
+// AcceptStream returns the next stream started with publish or play on the connection.
+// The first call starts reading the connection, from then on messages are only delivered through the streams.
+func (c *ConnServer) AcceptStream() (*NetStream, error) {
+	c.demuxOnce.Do(func() {
+		go c.demux()
+	})
+
+	ns, ok := <-c.accept
+	if !ok {
+		return nil, c.err()
+	}
+	return ns, nil
+}
+
+func (c *ConnServer) demux() {
+	var err error
+	defer func() {
+		c.streamsMtx.Lock()
+		c.readErr = err
+		for _, ns := range c.streams {
+			close(ns.chunks)
+		}
+		c.streams = map[uint32]*NetStream{}
+		c.streamsMtx.Unlock()
+		close(c.accept)
+	}()
+
+	var chunk ChunkStream
+	for {
+		if err = c.conn.Read(&chunk); err != nil {
+			return
+		}
+
+		switch chunk.TypeID {
+		case 20, 17:
+			if ns := c.route(&chunk); ns != nil {
+				ns.push(chunk)
+				continue
+			}
+			if err = c.HandleCmdMsg(&chunk); err != nil {
+				if c.streamCount() == 0 {
+					return
+				}
+				// a rejected stream does not end the streams already running.
+				logrus.Debug("rtmp stream rejected: ", err)
+				err = nil
+				continue
+			}
+			if ns := c.pending; ns != nil {
+				c.pending = nil
+				c.done = false
+
+				c.streamsMtx.Lock()
+				old := c.streams[ns.ID]
+				c.streams[ns.ID] = ns
+				c.streamsMtx.Unlock()
+				if old != nil {
+					old.once.Do(func() {
+						close(old.closed)
+					})
+				}
+
+				c.accept <- ns
+			}
+		case av.TAG_AUDIO, av.TAG_VIDEO, av.TAG_SCRIPTDATAAMF0, av.TAG_SCRIPTDATAAMF3:
+			if ns := c.stream(chunk.StreamID); ns != nil {
+				ns.push(chunk)
+			}
+		}
+	}
+}
+
+func (c *ConnServer) streamCount() int {
+	c.streamsMtx.Lock()
+	defer c.streamsMtx.Unlock()
+	return len(c.streams)
+}
@@ -3,20 +3,41 @@ package core
 import (
 	"bufio"
 	"io"
+	"sync/atomic"
 )
 
 type ReadWriter struct {
 	*bufio.ReadWriter
 	readError  error
 	writeError error
+	written    *countWriter
+}
+
+// countWriter counts the bytes handed to the underlying writer, accessed atomically.
+type countWriter struct {
+	w io.Writer
+	n uint64
+}
+
+func (c *countWriter) Write(p []byte) (int, error) {
+	n, err := c.w.Write(p)
+	atomic.AddUint64(&c.n, uint64(n))
+	return n, err
 }
 
 func NewReadWriter(rw io.ReadWriter, bufSize int) *ReadWriter {
+	written := &countWriter{w: rw}
 	return &ReadWriter{
-		ReadWriter: bufio.NewReadWriter(bufio.NewReaderSize(rw, bufSize), bufio.NewWriterSize(rw, bufSize)),
+		ReadWriter: bufio.NewReadWriter(bufio.NewReaderSize(rw, bufSize), bufio.NewWriterSize(written, bufSize)),
+		written:    written,
 	}
 }
 
+// Written returns the number of bytes flushed to the underlying writer.
+func (rw *ReadWriter) Written() uint64 {
+	return atomic.LoadUint64(&rw.written.n)
+}
+
 func (rw *ReadWriter) Read(p []byte) (int, error) {
 	if rw.readError != nil {
 		return 0, rw.readError
@@ -0,0 +1,34 @@
+package core
+
+import "errors"
+
+const (
+	StatusConnectRejected     = "NetConnection.Connect.Rejected"
+	StatusCallFailed          = "NetConnection.Call.Failed"
+	StatusPublishBadName      = "NetStream.Publish.BadName"
+	StatusPublishUnauthorized = "NetStream.Publish.Unauthorized"
+	StatusPlayStreamNotFound  = "NetStream.Play.StreamNotFound"
+)
+
+// StatusError rejects a command with an onStatus message instead of silently closing the connection.
+type StatusError struct {
+	Code        string
+	Description string
+}
+
+func NewStatusError(code, description string) *StatusError {
+	return &StatusError{Code: code, Description: description}
+}
+
+func (e *StatusError) Error() string {
+	return e.Code + ": " + e.Description
+}
+
+// asStatusError returns err as a StatusError, other errors are reported with code and their message.
+func asStatusError(err error, code string) *StatusError {
+	var status *StatusError
+	if errors.As(err, &status) {
+		return status
+	}
+	return NewStatusError(code, err.Error())
+}
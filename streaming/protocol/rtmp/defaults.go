@@ -10,15 +10,23 @@ import (
 )
 
 type Config struct {
-	Logger          logrus.FieldLogger
-	AuthTimeout     time.Duration
-	OnError         func(error)
-	OnNewStream     func(addr net.Addr) bool
-	OnStreamClose   func(info av.Info, addr net.Addr)
-	AuthStream      func(info *av.Info, addr net.Addr) bool
+	Logger      logrus.FieldLogger
+	AuthTimeout time.Duration
+	OnError     func(error)
+	OnNewStream func(addr net.Addr) bool
+	// OnConnect checks the app and connect parameters, an error rejects the connection with
+	// NetConnection.Connect.Rejected and the error message, or the code of a *core.StatusError.
+	OnConnect     func(info av.Info, addr net.Addr) error
+	OnStreamClose func(info av.Info, addr net.Addr)
+	AuthStream    func(info *av.Info, addr net.Addr) bool
+	// Authenticate is used instead of AuthStream when set, a returned *core.StatusError is sent to the client
+	// as onStatus before the connection is closed.
+	Authenticate    func(info *av.Info, addr net.Addr) error
 	HandlePublisher func(info av.Info, reader av.ReadCloser)
 	HandleViewer    func(info av.Info, writer av.WriteCloser)
 	HandleCmdChunk  func(info av.Info, vs []interface{}, chunk *core.ChunkStream) error
+	// TLS is only used by ServeTLS.
+	TLS TLSConfig
 }
 
 func (c Config) fill() Config {
@@ -31,12 +39,27 @@ func (c Config) fill() Config {
 	if c.OnNewStream == nil {
 		c.OnNewStream = DefaultConfig.OnNewStream
 	}
+	if c.OnConnect == nil {
+		c.OnConnect = DefaultConfig.OnConnect
+	}
 	if c.OnStreamClose == nil {
 		c.OnStreamClose = DefaultConfig.OnStreamClose
 	}
 	if c.AuthStream == nil {
 		c.AuthStream = DefaultConfig.AuthStream
 	}
+	if c.Authenticate == nil {
+		authStream := c.AuthStream
+		c.Authenticate = func(info *av.Info, addr net.Addr) error {
+			if authStream(info, addr) {
+				return nil
+			}
+			if info.Publisher {
+				return core.NewStatusError(core.StatusPublishUnauthorized, "Invalid stream key.")
+			}
+			return core.NewStatusError(core.StatusPlayStreamNotFound, "Stream not found.")
+		}
+	}
 	if c.HandlePublisher == nil {
 		c.HandlePublisher = DefaultConfig.HandlePublisher
 	}
@@ -49,6 +72,7 @@ func (c Config) fill() Config {
 	if c.AuthTimeout <= 0 {
 		c.AuthTimeout = DefaultConfig.AuthTimeout
 	}
+	c.TLS = c.TLS.fill(c.AuthTimeout)
 
 	return c
 }
@@ -58,6 +82,7 @@ var DefaultConfig = Config{
 	Logger:          logrus.StandardLogger(),
 	OnError:         func(e error) {},
 	OnNewStream:     func(addr net.Addr) bool { return true },
+	OnConnect:       func(info av.Info, addr net.Addr) error { return nil },
 	OnStreamClose:   func(info av.Info, addr net.Addr) {},
 	AuthStream:      func(info *av.Info, addr net.Addr) bool { return true },
 	HandlePublisher: func(info av.Info, reader av.ReadCloser) {},
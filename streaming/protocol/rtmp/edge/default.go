@@ -0,0 +1,57 @@
+package edge
+
+import (
+	"crypto/tls"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+type Config struct {
+	// Resolver finds the origin of the streams which are not published on the edge.
+	Resolver Resolver
+	// IdleTimeout keeps pulling after the last viewer left, a viewer coming back within it does not wait
+	// for the origin again.
+	IdleTimeout time.Duration
+	// Retries is how often a pull is retried when the origin could not be reached or dropped, while there
+	// are viewers. The viewers are closed after the last one.
+	Retries       int
+	RetryInterval time.Duration
+	// ConnectTimeout limits resolving the origin and starting to play from it.
+	ConnectTimeout time.Duration
+	// TLS is used for rtmps origins.
+	TLS    *tls.Config
+	Logger logrus.FieldLogger
+}
+
+func (c Config) fill() Config {
+	if c.IdleTimeout <= 0 {
+		c.IdleTimeout = DefaultConfig.IdleTimeout
+	}
+	if c.Retries < 0 {
+		c.Retries = DefaultConfig.Retries
+	}
+	if c.RetryInterval <= 0 {
+		c.RetryInterval = DefaultConfig.RetryInterval
+	}
+	if c.ConnectTimeout <= 0 {
+		c.ConnectTimeout = DefaultConfig.ConnectTimeout
+	}
+	if c.TLS == nil {
+		c.TLS = DefaultConfig.TLS
+	}
+	if c.Logger == nil {
+		c.Logger = DefaultConfig.Logger
+	}
+
+	return c
+}
+
+var DefaultConfig = Config{
+	IdleTimeout:    time.Second * 30,
+	Retries:        3,
+	RetryInterval:  time.Second,
+	ConnectTimeout: time.Second * 10,
+	TLS:            &tls.Config{},
+	Logger:         logrus.StandardLogger(),
+}
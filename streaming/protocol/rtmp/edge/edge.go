@@ -0,0 +1,247 @@
+package edge
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/viderstv/common/streaming/av"
+	"github.com/viderstv/common/streaming/protocol/rtmp"
+	"github.com/viderstv/common/streaming/protocol/rtmp/core"
+	"github.com/viderstv/common/streaming/protocol/rtmp/handler"
+	"github.com/viderstv/common/utils/uid"
+)
+
+const idleCheckInterval = time.Second
+
+var (
+	ErrNoOrigin   = fmt.Errorf("no origin for stream")
+	ErrNoResolver = fmt.Errorf("edge config has no resolver")
+)
+
+// Resolver returns the rtmp url to play a stream from on its origin, ErrNoOrigin if it has none.
+type Resolver interface {
+	Resolve(ctx context.Context, info av.Info) (string, error)
+}
+
+type ResolverFunc func(ctx context.Context, info av.Info) (string, error)
+
+func (f ResolverFunc) Resolve(ctx context.Context, info av.Info) (string, error) {
+	return f(ctx, info)
+}
+
+// Edge serves viewers from a handler and pulls the streams which are not published locally from their
+// origin while they have viewers. The handler needs a PublisherWait for the viewers to wait for the pull.
+type Edge struct {
+	handler *handler.RtmpHandler
+	config  Config
+
+	mtx   sync.Mutex
+	pulls map[string]*pull
+}
+
+func New(h *handler.RtmpHandler, config Config) (*Edge, error) {
+	if config.Resolver == nil {
+		return nil, ErrNoResolver
+	}
+
+	return &Edge{
+		handler: h,
+		config:  config.fill(),
+		pulls:   map[string]*pull{},
+	}, nil
+}
+
+// HandleReader attaches a local publisher, it takes over from a pull of the same stream.
+func (e *Edge) HandleReader(r av.ReadCloser) {
+	e.handler.HandleReader(r)
+}
+
+// HandleWriter attaches a viewer and starts pulling its stream from the origin if it is not published.
+func (e *Edge) HandleWriter(w av.WriteCloser) {
+	info := w.Info()
+	key := e.handler.Key(info)
+
+	e.mtx.Lock()
+	if _, ok := e.pulls[key]; !ok {
+		if stream, ok := e.handler.Stream(key); !ok || !stream.Publishing {
+			p := &pull{edge: e, key: key, info: info, stop: make(chan struct{})}
+			e.pulls[key] = p
+			go p.run()
+		}
+	}
+	e.mtx.Unlock()
+
+	e.handler.HandleWriter(w)
+}
+
+// Pulling reports if the stream with the key is pulled from its origin.
+func (e *Edge) Pulling(key string) bool {
+	e.mtx.Lock()
+	defer e.mtx.Unlock()
+	_, ok := e.pulls[key]
+	return ok
+}
+
+// Close stops all pulls.
+func (e *Edge) Close() {
+	e.mtx.Lock()
+	defer e.mtx.Unlock()
+	for _, p := range e.pulls {
+		p.close()
+	}
+}
+
+func (e *Edge) removePull(p *pull) {
+	e.mtx.Lock()
+	if e.pulls[p.key] == p {
+		delete(e.pulls, p.key)
+	}
+	e.mtx.Unlock()
+}
+
+type pull struct {
+	edge *Edge
+	key  string
+	// info is the info of the first viewer, the pulled reader uses it to attach to the same stream.
+	info av.Info
+
+	once sync.Once
+	stop chan struct{}
+}
+
+func (p *pull) close() {
+	p.once.Do(func() {
+		close(p.stop)
+	})
+}
+
+func (p *pull) run() {
+	e := p.edge
+	defer e.removePull(p)
+
+	failures := 0
+	for {
+		reader, err := p.start()
+		if err != nil {
+			failures++
+			e.config.Logger.Warnf("edge pull of %s failed: %v", p.key, err)
+		} else {
+			failures = 0
+			e.handler.HandleReader(reader)
+			switch p.wait(reader) {
+			case pullStopped:
+				_ = reader.Close()
+				e.handler.StopStream(p.key)
+				return
+			case pullReplaced:
+				_ = reader.Close()
+				return
+			}
+			if p.viewers() == 0 {
+				e.handler.StopStream(p.key)
+				return
+			}
+		}
+
+		if err == ErrNoOrigin || failures > e.config.Retries {
+			// the viewers waiting for the stream are closed.
+			e.handler.StopStream(p.key)
+			return
+		}
+
+		select {
+		case <-time.After(e.config.RetryInterval):
+		case <-p.stop:
+			e.handler.StopStream(p.key)
+			return
+		}
+	}
+}
+
+// start plays the stream from its origin, it gives up after ConnectTimeout or once the pull is stopped.
+func (p *pull) start() (av.ReadCloser, error) {
+	e := p.edge
+
+	ctx, cancel := context.WithTimeout(context.Background(), e.config.ConnectTimeout)
+	defer cancel()
+	go func() {
+		select {
+		case <-p.stop:
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+	url, err := e.config.Resolver.Resolve(ctx, p.info)
+	if err != nil {
+		return nil, err
+	}
+
+	client := core.NewConnClientWithTls(e.config.TLS)
+	if err := client.StartContext(ctx, url, av.PLAY); err != nil {
+		_ = client.Close()
+		return nil, err
+	}
+
+	info := p.info
+	info.ID = uid.NewId()
+	info.Publisher = true
+	info.URL = url
+	return rtmp.NewVirReader(client, e.config.Logger, info, nil), nil
+}
+
+type pullState int
+
+const (
+	// pullDropped by the origin is retried while there are viewers.
+	pullDropped pullState = iota
+	// pullStopped after idling or closing ends the stream.
+	pullStopped
+	// pullReplaced by a local publisher leaves the stream to it.
+	pullReplaced
+)
+
+// wait returns once the pulled reader ended or should end.
+func (p *pull) wait(reader av.ReadCloser) pullState {
+	e := p.edge
+	ticker := time.NewTicker(idleCheckInterval)
+	defer ticker.Stop()
+
+	var idleSince time.Time
+	for {
+		select {
+		case <-p.stop:
+			return pullStopped
+		case <-reader.Running():
+			if p.replaced(reader) {
+				return pullReplaced
+			}
+			return pullDropped
+		case <-ticker.C:
+		}
+
+		if p.replaced(reader) {
+			return pullReplaced
+		}
+		if p.viewers() != 0 {
+			idleSince = time.Time{}
+			continue
+		}
+		if idleSince.IsZero() {
+			idleSince = time.Now()
+		} else if time.Since(idleSince) >= e.config.IdleTimeout {
+			return pullStopped
+		}
+	}
+}
+
+func (p *pull) replaced(reader av.ReadCloser) bool {
+	stream, ok := p.edge.handler.Stream(p.key)
+	return ok && stream.Publishing && stream.Publisher.ID != reader.Info().ID
+}
+
+func (p *pull) viewers() int {
+	stream, _ := p.edge.handler.Stream(p.key)
+	return stream.Viewers
+}
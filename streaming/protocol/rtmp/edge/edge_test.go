@@ -0,0 +1,202 @@
+package edge
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/viderstv/common/streaming/av"
+	"github.com/viderstv/common/streaming/protocol/rtmp"
+	"github.com/viderstv/common/streaming/protocol/rtmp/core"
+	"github.com/viderstv/common/streaming/protocol/rtmp/handler"
+)
+
+func serve(t *testing.T, h av.Handler) string {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := rtmp.New(rtmp.Config{
+		// the streams end when the callbacks return.
+		HandlePublisher: func(info av.Info, reader av.ReadCloser) {
+			h.HandleReader(reader)
+			<-reader.Running()
+		},
+		HandleViewer: func(info av.Info, writer av.WriteCloser) {
+			h.HandleWriter(writer)
+			<-writer.Running()
+		},
+	})
+	go func() {
+		_ = s.Serve(ln)
+	}()
+	t.Cleanup(func() {
+		_ = s.Shutdown()
+	})
+	return ln.Addr().String()
+}
+
+func publish(t *testing.T, url string) func() {
+	client := core.NewConnClient()
+	if err := client.Start(url, av.PUBLISH); err != nil {
+		t.Fatal(err)
+	}
+
+	done := make(chan struct{})
+	go func() {
+		defer client.Close()
+		for ts := uint32(0); ; ts += 40 {
+			data := []byte{0x17, 0x01, 0x00, 0x00, 0x00}
+			err := client.Write(core.ChunkStream{
+				Format:    0,
+				CSID:      6,
+				TypeID:    av.TAG_VIDEO,
+				StreamID:  client.GetStreamId(),
+				Timestamp: ts,
+				Length:    uint32(len(data)),
+				Data:      data,
+			})
+			if err != nil || client.Flush() != nil {
+				return
+			}
+			select {
+			case <-done:
+				return
+			case <-time.After(40 * time.Millisecond):
+			}
+		}
+	}()
+	return func() { close(done) }
+}
+
+func TestEdgePull(t *testing.T) {
+	at := assert.New(t)
+
+	origin := handler.New(handler.Config{StreamKey: handler.AppNameKey, PublisherWait: time.Second})
+	originAddr := serve(t, origin)
+	stop := publish(t, "rtmp://"+originAddr+"/live/one")
+	defer stop()
+
+	h := handler.New(handler.Config{StreamKey: handler.AppNameKey, PublisherWait: 5 * time.Second})
+	resolved := make(chan av.Info, 1)
+	e, err := New(h, Config{
+		IdleTimeout: 100 * time.Millisecond,
+		Resolver: ResolverFunc(func(ctx context.Context, info av.Info) (string, error) {
+			resolved <- info
+			return "rtmp://" + originAddr + "/" + info.App + "/" + info.Name, nil
+		}),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer e.Close()
+	edgeAddr := serve(t, e)
+
+	viewer := core.NewConnClient()
+	at.NoError(viewer.Start("rtmp://"+edgeAddr+"/live/one", av.PLAY))
+	at.Equal((<-resolved).Name, "one")
+
+	var cs core.ChunkStream
+	for cs.TypeID != av.TAG_VIDEO {
+		if err := viewer.Read(&cs); err != nil {
+			t.Fatal(err)
+		}
+	}
+	at.True(e.Pulling("live/one"))
+	info, ok := origin.Stream("live/one")
+	at.True(ok)
+	at.Equal(info.Viewers, 1)
+
+	// the pull ends after the last viewer left and the idle timeout
+	_ = viewer.Close()
+	deadline := time.Now().Add(5 * time.Second)
+	for e.Pulling("live/one") && time.Now().Before(deadline) {
+		time.Sleep(50 * time.Millisecond)
+	}
+	at.False(e.Pulling("live/one"))
+}
+
+func TestEdgeNoOrigin(t *testing.T) {
+	h := handler.New(handler.Config{PublisherWait: 5 * time.Second})
+	e, err := New(h, Config{
+		Resolver: ResolverFunc(func(ctx context.Context, info av.Info) (string, error) {
+			return "", ErrNoOrigin
+		}),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	w := &testWriter{info: av.Info{ID: "viewer", Key: "stream"}, closed: make(chan struct{})}
+	e.HandleWriter(w)
+	select {
+	case <-w.closed:
+	case <-time.After(time.Second):
+		t.Fatal("viewer not closed without an origin")
+	}
+}
+
+func TestEdgeNoResolver(t *testing.T) {
+	_, err := New(handler.New(handler.Config{}), Config{})
+	assert.Equal(t, err, ErrNoResolver)
+}
+
+func TestEdgeUnresponsiveOrigin(t *testing.T) {
+	at := assert.New(t)
+
+	// the origin accepts connections and never answers the handshake
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			defer conn.Close()
+		}
+	}()
+
+	h := handler.New(handler.Config{PublisherWait: 5 * time.Second})
+	e, err := New(h, Config{
+		Retries:        1,
+		ConnectTimeout: 50 * time.Millisecond,
+		RetryInterval:  10 * time.Millisecond,
+		Resolver: ResolverFunc(func(ctx context.Context, info av.Info) (string, error) {
+			return "rtmp://" + ln.Addr().String() + "/live/one", nil
+		}),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	w := &testWriter{info: av.Info{ID: "viewer", Key: "stream"}, closed: make(chan struct{})}
+	e.HandleWriter(w)
+	select {
+	case <-w.closed:
+	case <-time.After(2 * time.Second):
+		t.Fatal("viewer not closed after the origin did not answer")
+	}
+	deadline := time.Now().Add(time.Second)
+	for e.Pulling("stream") && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	at.False(e.Pulling("stream"))
+}
+
+type testWriter struct {
+	info   av.Info
+	closed chan struct{}
+}
+
+func (w *testWriter) Info() av.Info            { return w.info }
+func (w *testWriter) Alive() bool              { return true }
+func (w *testWriter) Running() <-chan struct{} { return w.closed }
+func (w *testWriter) CalcBaseTimestamp()       {}
+func (w *testWriter) Write(p *av.Packet) error { return nil }
+func (w *testWriter) Close() error             { close(w.closed); return nil }
@@ -0,0 +1,89 @@
+package handler
+
+import (
+	"bytes"
+
+	"github.com/viderstv/common/streaming/av"
+	"github.com/viderstv/common/streaming/protocol/amf"
+)
+
+// OnControl is the name of the script data message control commands are sent to the viewers with,
+// its argument is an object with the command and its values.
+const OnControl = "onControl"
+
+const (
+	ControlMuteAudio       = "muteAudio"
+	ControlRequestKeyframe = "requestKeyframe"
+	ControlUpdateTitle     = "updateTitle"
+)
+
+func controlPacket(values amf.Object) (*av.Packet, error) {
+	b := bytes.NewBuffer(nil)
+	encoder := &amf.Encoder{}
+	if _, err := encoder.EncodeBatch(b, amf.AMF0, OnControl, values); err != nil {
+		return nil, err
+	}
+	return &av.Packet{IsMetadata: true, Data: b.Bytes()}, nil
+}
+
+// MuteAudio stops or resumes forwarding the audio of the stream, false if there is no stream with the key.
+func (h *RtmpHandler) MuteAudio(key string, mute bool) bool {
+	return h.control(key, func(s *Stream) amf.Object {
+		s.muted = mute
+		return amf.Object{"command": ControlMuteAudio, "muted": mute}
+	})
+}
+
+// RequestKeyframe asks the readers of the stream, a transcoder for example, to start a new GOP. RTMP has
+// no way to ask the publisher itself.
+func (h *RtmpHandler) RequestKeyframe(key string) bool {
+	return h.control(key, func(s *Stream) amf.Object {
+		return amf.Object{"command": ControlRequestKeyframe}
+	})
+}
+
+// UpdateTitle sets the title of the stream and announces it to the viewers.
+func (h *RtmpHandler) UpdateTitle(key string, title string) bool {
+	return h.control(key, func(s *Stream) amf.Object {
+		s.title = title
+		return amf.Object{"command": ControlUpdateTitle, "title": title}
+	})
+}
+
+// control applies a command to a stream under its lock and sends the returned values to its viewers in band.
+func (h *RtmpHandler) control(key string, apply func(s *Stream) amf.Object) bool {
+	h.mtx.Lock()
+	stream, ok := h.streams[key]
+	h.mtx.Unlock()
+	if !ok {
+		return false
+	}
+
+	stream.writersMtx.Lock()
+	p, err := controlPacket(apply(stream))
+	var left []av.Info
+	if err == nil {
+		p.TimeStamp = stream.lastTimestamp
+		left = stream.inject(p)
+	}
+	info := stream.info
+	stream.writersMtx.Unlock()
+
+	stream.viewersLeft(info, left)
+	return true
+}
+
+// inject sends a packet which is not cached to the viewers which started, s.writersMtx must be held.
+func (s *Stream) inject(p *av.Packet) []av.Info {
+	var left []av.Info
+	for k, v := range s.writers {
+		if !v.init {
+			continue
+		}
+		newPacket := *p
+		if err := v.Write(&newPacket); err != nil {
+			left = append(left, s.removeWriter(k, v))
+		}
+	}
+	return left
+}
@@ -0,0 +1,69 @@
+package handler
+
+import (
+	"time"
+
+	"github.com/viderstv/common/streaming/av"
+	"github.com/viderstv/common/streaming/protocol/rtmp/cache"
+)
+
+type DuplicatePublish int
+
+const (
+	// ReplaceOld disconnects the publisher already streaming, its viewers continue with the new one.
+	ReplaceOld DuplicatePublish = iota
+	// RejectNew keeps the publisher already streaming and closes the new one.
+	RejectNew
+)
+
+type Config struct {
+	// Cache configures the GOP cache new viewers start from.
+	Cache cache.Config
+	// MaxTimestampGap is the forward jump from which publisher timestamps are rebased as a discontinuity.
+	MaxTimestampGap time.Duration
+	// ReconnectGrace keeps viewers attached after the publisher dropped, a publisher reconnecting within
+	// it resumes them. A negative value ends the viewers with the publisher.
+	ReconnectGrace time.Duration
+	// DuplicatePublish decides between two publishers with the same key.
+	DuplicatePublish DuplicatePublish
+	// PublisherWait keeps viewers arriving before the publisher attached until it starts, they are closed
+	// when it did not within it. A negative value closes them right away.
+	PublisherWait time.Duration
+	// StreamKey maps publishers and viewers to a stream, nil uses av.Info.Key.
+	StreamKey func(info av.Info) string
+
+	// OnPublish and OnUnpublish are called when a publisher attaches to or detaches from a stream,
+	// OnViewerJoin and OnViewerLeave when a viewer does. They are called without locks held, so they
+	// may use the registry, but they block the stream and should return quickly.
+	OnPublish     func(publisher av.Info)
+	OnUnpublish   func(publisher av.Info)
+	OnViewerJoin  func(stream av.Info, viewer av.Info)
+	OnViewerLeave func(stream av.Info, viewer av.Info)
+}
+
+func (c Config) fill() Config {
+	if c.MaxTimestampGap <= 0 {
+		c.MaxTimestampGap = DefaultConfig.MaxTimestampGap
+	}
+	if c.ReconnectGrace == 0 {
+		c.ReconnectGrace = DefaultConfig.ReconnectGrace
+	}
+	if c.PublisherWait == 0 {
+		c.PublisherWait = DefaultConfig.PublisherWait
+	}
+
+	return c
+}
+
+var DefaultConfig = Config{
+	Cache:            cache.DefaultConfig,
+	MaxTimestampGap:  av.DefaultMaxTimestampGap,
+	ReconnectGrace:   time.Second * 10,
+	DuplicatePublish: ReplaceOld,
+	PublisherWait:    time.Second * 30,
+}
+
+// AppNameKey is a StreamKey which matches viewers to publishers by app and stream name.
+func AppNameKey(info av.Info) string {
+	return info.App + "/" + info.Name
+}
@@ -1,65 +1,120 @@
 package handler
 
 import (
+	"io"
 	"sync"
 	"time"
 
 	"github.com/viderstv/common/streaming/av"
+	"github.com/viderstv/common/streaming/metrics"
 	"github.com/viderstv/common/streaming/protocol/rtmp/cache"
 )
 
 type RtmpHandler struct {
+	config  Config
 	streams map[string]*Stream
 	mtx     sync.Mutex
+	// published is closed and replaced whenever a publisher attaches, waking WaitPublisher.
+	published chan struct{}
 }
 
-func New() *RtmpHandler {
+func New(config Config) *RtmpHandler {
 	ret := &RtmpHandler{
-		streams: map[string]*Stream{},
+		config:    config.fill(),
+		streams:   map[string]*Stream{},
+		published: make(chan struct{}),
 	}
 	go ret.checkAlive()
 	return ret
 }
 
+// Key returns the key of the stream a publisher or viewer is attached to.
+func (h *RtmpHandler) Key(info av.Info) string {
+	if h.config.StreamKey != nil {
+		return h.config.StreamKey(info)
+	}
+	return info.Key
+}
+
+// HandleReader attaches a publisher. A publisher already streaming with the same key is replaced or the
+// new one is rejected by closing it, depending on Config.DuplicatePublish. Viewers of a replaced or
+// dropped publisher stay attached and continue with the new one.
 func (h *RtmpHandler) HandleReader(r av.ReadCloser) {
 	info := r.Info()
+	key := h.Key(info)
 
 	h.mtx.Lock()
-	stream := h.streams[info.Key]
-	if stream != nil {
-		stream.Stop()
-		stream = newStream()
-		h.streams[info.Key] = stream
-	} else {
-		stream = newStream()
-		h.streams[info.Key] = stream
+	stream := h.streams[key]
+	if stream != nil && stream.Publishing() && h.config.DuplicatePublish == RejectNew {
+		h.mtx.Unlock()
+		_ = r.Close()
+		return
+	}
+	if stream == nil {
+		stream = h.newStream(key)
 	}
-
-	stream.info = info
-
 	stream.AddReader(r)
+	close(h.published)
+	h.published = make(chan struct{})
 	h.mtx.Unlock()
+
+	if h.config.OnPublish != nil {
+		h.config.OnPublish(info)
+	}
 }
 
+// HandleWriter attaches a viewer. Viewers arriving before the publisher wait for it up to
+// Config.PublisherWait.
 func (h *RtmpHandler) HandleWriter(w av.WriteCloser) {
 	info := w.Info()
+	key := h.Key(info)
 
 	h.mtx.Lock()
-	stream := h.streams[info.Key]
+	stream := h.streams[key]
 	if stream == nil {
-		stream = newStream()
-		h.streams[info.Key] = stream
-	} else {
-		stream.AddWriter(w)
+		if h.config.PublisherWait <= 0 {
+			h.mtx.Unlock()
+			_ = w.Close()
+			return
+		}
+		stream = h.newStream(key)
+		stream.waitReader(info, h.config.PublisherWait)
 	}
+	stream.AddWriter(w)
 	h.mtx.Unlock()
+
+	if h.config.OnViewerJoin != nil {
+		h.config.OnViewerJoin(stream.Info(), info)
+	}
 }
 
-func (h *RtmpHandler) StopStream(key string) {
+// newStream registers a stream which removes itself once it ended, h.mtx must be held.
+func (h *RtmpHandler) newStream(key string) *Stream {
+	stream := newStream(h.config)
+	stream.onEnd = func() {
+		h.removeStream(key, stream)
+	}
+	h.streams[key] = stream
+	return stream
+}
+
+// StopStream closes the publisher and the viewers of a stream, false if there is no stream with the key.
+func (h *RtmpHandler) StopStream(key string) bool {
 	h.mtx.Lock()
-	if stream, ok := h.streams[key]; ok {
+	stream, ok := h.streams[key]
+	h.mtx.Unlock()
+
+	if ok {
 		stream.Stop()
-		stream.StopWriters()
+	}
+	return ok
+}
+
+// removeStream drops a stream which ended, unless it was already replaced.
+func (h *RtmpHandler) removeStream(key string, stream *Stream) {
+	h.mtx.Lock()
+	if h.streams[key] == stream {
+		delete(h.streams, key)
 	}
 	h.mtx.Unlock()
 }
@@ -69,22 +124,48 @@ func (h *RtmpHandler) checkAlive() {
 		time.Sleep(time.Second * 5)
 
 		h.mtx.Lock()
+		streams := make(map[string]*Stream, len(h.streams))
 		for k, v := range h.streams {
+			streams[k] = v
+		}
+		h.mtx.Unlock()
+
+		// checked without h.mtx, dropping viewers calls the event callbacks.
+		for k, v := range streams {
 			if v.CheckAlive() == 0 {
-				delete(h.streams, k)
+				h.removeStream(k, v)
 			}
 		}
-		h.mtx.Unlock()
 	}
 }
 
 type Stream struct {
-	info  av.Info
-	cache *cache.Cache
+	cache      *cache.Cache
+	normalizer *av.TimestampNormalizer
+	meter      *metrics.Meter
+	grace      time.Duration
+	config     Config
+	created    time.Time
 
+	// writersMtx also guards the info, the reader, the cache and the grace timer, a replaced reader
+	// may still be delivering its last packet.
+	info       av.Info
 	reader     av.ReadCloser
 	writers    map[string]*WriteCloser
 	writersMtx sync.Mutex
+	graceTimer *time.Timer
+	stopped    bool
+	published  bool
+	// dropped counts the packets dropped for viewers which left.
+	dropped uint64
+	// muted drops the audio, title is set by the control commands.
+	muted         bool
+	title         string
+	lastTimestamp uint32
+
+	// onEnd is called once the stream ended, after the reader ended in order with io.EOF
+	// or the grace period passed without a new reader.
+	onEnd func()
 }
 
 type WriteCloser struct {
@@ -92,20 +173,68 @@ type WriteCloser struct {
 	init bool
 }
 
-func newStream() *Stream {
+func newStream(config Config) *Stream {
 	return &Stream{
-		cache:   cache.NewCache(),
-		writers: map[string]*WriteCloser{},
+		cache:      cache.NewCache(config.Cache),
+		normalizer: av.NewTimestampNormalizer(config.MaxTimestampGap),
+		meter:      metrics.NewMeter(0),
+		grace:      config.ReconnectGrace,
+		config:     config,
+		created:    time.Now(),
+		writers:    map[string]*WriteCloser{},
 	}
 }
 
+// Info returns the info of the current or last publisher, or of the first viewer while none attached yet.
+func (s *Stream) Info() av.Info {
+	s.writersMtx.Lock()
+	defer s.writersMtx.Unlock()
+	return s.info
+}
+
 func (s *Stream) GetReader() av.ReadCloser {
+	s.writersMtx.Lock()
+	defer s.writersMtx.Unlock()
 	return s.reader
 }
 
+// Publishing reports if a reader is attached, it is not while waiting for the publisher to reconnect.
+func (s *Stream) Publishing() bool {
+	return s.GetReader() != nil
+}
+
+// Viewers returns the number of attached writers.
+func (s *Stream) Viewers() int {
+	s.writersMtx.Lock()
+	defer s.writersMtx.Unlock()
+	return len(s.writers)
+}
+
+// AddReader starts reading from r. A reader already attached is closed, the viewers stay and continue
+// with the new reader after a discontinuity.
 func (s *Stream) AddReader(r av.ReadCloser) {
+	s.writersMtx.Lock()
+	old := s.reader
+	resumed := s.published
+	if s.graceTimer != nil {
+		s.graceTimer.Stop()
+		s.graceTimer = nil
+	}
 	s.reader = r
-	go s.Start()
+	s.info = r.Info()
+	s.stopped = false
+	s.published = true
+	if resumed {
+		// the new publisher sends its own sequence headers, new viewers must not start from the old gop.
+		s.cache.Reset()
+		s.normalizer.Discontinue()
+	}
+	s.writersMtx.Unlock()
+
+	if old != nil {
+		_ = old.Close()
+	}
+	go s.Start(r)
 }
 
 func (s *Stream) AddWriter(w av.WriteCloser) {
@@ -114,59 +243,144 @@ func (s *Stream) AddWriter(w av.WriteCloser) {
 	s.writersMtx.Unlock()
 }
 
-func (s *Stream) Start() {
+// waitReader ends the stream unless a reader attached within d, info stands in for the publisher until then.
+func (s *Stream) waitReader(info av.Info, d time.Duration) {
+	s.writersMtx.Lock()
+	s.info = info
+	s.expire(d)
+	s.writersMtx.Unlock()
+}
+
+// expire ends the stream unless a reader attached within d, s.writersMtx must be held.
+func (s *Stream) expire(d time.Duration) {
+	s.graceTimer = time.AfterFunc(d, func() {
+		s.writersMtx.Lock()
+		ended := s.reader == nil
+		s.graceTimer = nil
+		s.writersMtx.Unlock()
+		if ended {
+			s.end()
+		}
+	})
+}
+
+func (s *Stream) Start(r av.ReadCloser) {
 	var p av.Packet
 
 	for {
-		err := s.reader.Read(&p)
+		err := r.Read(&p)
 		if err != nil {
-			s.Stop()
+			s.readerEnded(r, err)
 			return
 		}
 
-		err = s.cache.Write(p)
-		if err != nil {
+		s.writersMtx.Lock()
+		if s.reader != r {
+			s.writersMtx.Unlock()
+			s.readerEnded(r, nil)
+			return
+		}
+
+		s.normalizer.Normalize(&p)
+		s.meter.Observe(&p)
+		s.lastTimestamp = p.TimeStamp
+		if s.muted && p.IsAudio && !audioSeq(&p) {
+			s.writersMtx.Unlock()
+			continue
+		}
+		if err = s.cache.Write(p); err != nil {
+			s.writersMtx.Unlock()
 			s.Stop()
+			s.readerEnded(r, err)
 			return
 		}
 
-		s.writersMtx.Lock()
+		var left []av.Info
 		for k, v := range s.writers {
 			if v.init {
 				newPacket := p
 				if err = v.Write(&newPacket); err != nil {
-					delete(s.writers, k)
+					left = append(left, s.removeWriter(k, v))
 				}
 			} else if err = s.cache.Send(v); err != nil {
-				delete(s.writers, k)
+				left = append(left, s.removeWriter(k, v))
 			} else {
 				v.init = true
 			}
 		}
+		info := s.info
 		s.writersMtx.Unlock()
+
+		s.viewersLeft(info, left)
+	}
+}
+
+// readerEnded detaches a reader which stopped, the viewers wait for the grace period for a new one.
+func (s *Stream) readerEnded(r av.ReadCloser, err error) {
+	_ = r.Close()
+	if s.config.OnUnpublish != nil {
+		s.config.OnUnpublish(r.Info())
+	}
+
+	s.writersMtx.Lock()
+	if s.reader != r {
+		// replaced by a new reader
+		s.writersMtx.Unlock()
+		return
+	}
+	s.reader = nil
+	if s.grace > 0 && !s.stopped {
+		s.expire(s.grace)
+		s.writersMtx.Unlock()
+		return
+	}
+	s.writersMtx.Unlock()
+
+	s.StopWriters()
+	if err == io.EOF {
+		s.end()
+	}
+}
+
+func (s *Stream) end() {
+	s.Stop()
+	if s.onEnd != nil {
+		s.onEnd()
 	}
 }
 
 func (s *Stream) Stop() {
-	if s.reader != nil {
-		_ = s.reader.Close()
+	s.writersMtx.Lock()
+	r := s.reader
+	s.stopped = true
+	if s.graceTimer != nil {
+		s.graceTimer.Stop()
+		s.graceTimer = nil
+	}
+	s.writersMtx.Unlock()
+
+	if r != nil {
+		_ = r.Close()
 	}
 	s.StopWriters()
 }
 
 func (s *Stream) StopWriters() {
 	s.writersMtx.Lock()
-	defer s.writersMtx.Unlock()
+	var left []av.Info
 	for k, v := range s.writers {
-		_ = v.Close()
-		delete(s.writers, k)
+		left = append(left, s.removeWriter(k, v))
 	}
+	info := s.info
+	s.writersMtx.Unlock()
+
+	s.viewersLeft(info, left)
 }
 
 func (s *Stream) CheckAlive() int {
 	n := 0
-	if s.reader != nil {
-		if s.reader.Alive() {
+	if r := s.GetReader(); r != nil {
+		if r.Alive() {
 			n++
 		} else {
 			s.Stop()
@@ -175,17 +389,53 @@ func (s *Stream) CheckAlive() int {
 	}
 
 	s.writersMtx.Lock()
-	defer s.writersMtx.Unlock()
+	// viewers get no packets while waiting for the publisher, so they only time out once it sends. The
+	// pending timer keeps the stream until it decides.
+	if s.reader == nil && s.graceTimer != nil {
+		n := len(s.writers) + 1
+		s.writersMtx.Unlock()
+		return n
+	}
 
+	var left []av.Info
 	for k, v := range s.writers {
 		if v.WriteCloser != nil {
 			if v.WriteCloser.Alive() {
 				n++
 				continue
 			}
+			left = append(left, s.removeWriter(k, v))
+			continue
 		}
 		delete(s.writers, k)
 	}
+	info := s.info
+	s.writersMtx.Unlock()
 
+	s.viewersLeft(info, left)
 	return n
 }
+
+func audioSeq(p *av.Packet) bool {
+	ah, ok := p.Header.(av.AudioPacketHeader)
+	return ok && ah.SoundFormat() == av.SOUND_AAC && ah.AACPacketType() == av.AAC_SEQHDR
+}
+
+// removeWriter closes and detaches a writer and keeps its drop count, s.writersMtx must be held.
+func (s *Stream) removeWriter(key string, w *WriteCloser) av.Info {
+	_ = w.Close()
+	delete(s.writers, key)
+	if stats, ok := w.WriteCloser.(ViewerStats); ok {
+		s.dropped += stats.DroppedPackets()
+	}
+	return w.Info()
+}
+
+func (s *Stream) viewersLeft(stream av.Info, viewers []av.Info) {
+	if s.config.OnViewerLeave == nil {
+		return
+	}
+	for _, v := range viewers {
+		s.config.OnViewerLeave(stream, v)
+	}
+}
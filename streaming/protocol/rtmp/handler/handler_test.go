@@ -0,0 +1,346 @@
+package handler
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/viderstv/common/streaming/av"
+	"github.com/viderstv/common/streaming/container/flv"
+	"github.com/viderstv/common/streaming/internal/avtest"
+	"github.com/viderstv/common/streaming/metrics"
+	"github.com/viderstv/common/streaming/protocol/amf"
+)
+
+func newTestReader(id string) *avtest.Reader {
+	return avtest.NewReader(av.Info{ID: id, Key: "stream", Publisher: true})
+}
+
+func newTestWriter(id string) *avtest.Writer {
+	return avtest.NewWriter(av.Info{ID: id, Key: "stream"})
+}
+
+// idleWriter times out like rtmp.VirWriter, it is only alive while it is written to.
+type idleWriter struct {
+	*avtest.Writer
+	base av.RWBaser
+}
+
+func newIdleWriter(id string, timeout time.Duration) *idleWriter {
+	return &idleWriter{Writer: newTestWriter(id), base: av.NewRWBaser(timeout)}
+}
+
+func (w *idleWriter) Write(p *av.Packet) error {
+	w.base.SetPreTime()
+	return w.Writer.Write(p)
+}
+
+func (w *idleWriter) Alive() bool { return w.base.Alive() }
+
+func keyframe(t *testing.T, ts uint32) *av.Packet {
+	tag := &flv.Tag{}
+	data := []byte{0x17, 0x01, 0x00, 0x00, 0x00}
+	if _, err := tag.ParseMediaTagHeader(data, true); err != nil {
+		t.Fatal(err)
+	}
+	return &av.Packet{IsVideo: true, Header: tag, TimeStamp: ts, Data: data}
+}
+
+func TestHandlerReconnect(t *testing.T) {
+	at := assert.New(t)
+
+	h := New(Config{ReconnectGrace: time.Second})
+	first := newTestReader("first")
+	h.HandleReader(first)
+	first.Send(t, keyframe(t, 5000))
+
+	viewer := newTestWriter("viewer")
+	h.HandleWriter(viewer)
+	// the viewer starts from the cached gop, the timeline starts at zero
+	first.Send(t, keyframe(t, 5040))
+	at.Equal(viewer.Next(t).TimeStamp, uint32(40))
+
+	// the publisher drops, the viewer waits for it
+	_ = first.Close()
+	time.Sleep(20 * time.Millisecond)
+	at.False(viewer.Closed())
+
+	second := newTestReader("second")
+	h.HandleReader(second)
+	second.Send(t, keyframe(t, 0))
+	p := viewer.Next(t)
+	at.True(p.Discontinuity)
+	at.True(p.TimeStamp > 40)
+	second.Send(t, keyframe(t, 40))
+	at.False(viewer.Next(t).Discontinuity)
+
+	// a duplicate publish replaces the publisher by default
+	third := newTestReader("third")
+	h.HandleReader(third)
+	<-second.Running()
+	third.Send(t, keyframe(t, 0))
+	at.True(viewer.Next(t).Discontinuity)
+	at.False(viewer.Closed())
+}
+
+func TestHandlerGraceExpires(t *testing.T) {
+	at := assert.New(t)
+
+	h := New(Config{ReconnectGrace: 50 * time.Millisecond})
+	r := newTestReader("publisher")
+	h.HandleReader(r)
+	viewer := newTestWriter("viewer")
+	h.HandleWriter(viewer)
+	r.Send(t, keyframe(t, 0))
+	viewer.Next(t)
+
+	_ = r.Close()
+	select {
+	case <-viewer.Running():
+	case <-time.After(time.Second):
+		t.Fatal("viewer not closed after the grace period")
+	}
+
+	h.mtx.Lock()
+	_, ok := h.streams["stream"]
+	h.mtx.Unlock()
+	at.False(ok)
+}
+
+func TestHandlerRejectNew(t *testing.T) {
+	at := assert.New(t)
+
+	h := New(Config{DuplicatePublish: RejectNew})
+	first := newTestReader("first")
+	h.HandleReader(first)
+	viewer := newTestWriter("viewer")
+	h.HandleWriter(viewer)
+
+	second := newTestReader("second")
+	h.HandleReader(second)
+	<-second.Running()
+
+	first.Send(t, keyframe(t, 0))
+	at.Equal(viewer.Next(t).TimeStamp, uint32(0))
+}
+
+func TestHandlerEarlyViewer(t *testing.T) {
+	at := assert.New(t)
+
+	var (
+		mtx    sync.Mutex
+		events []string
+	)
+	event := func(e string) {
+		mtx.Lock()
+		events = append(events, e)
+		mtx.Unlock()
+	}
+	h := New(Config{
+		PublisherWait: time.Second,
+		OnPublish:     func(p av.Info) { event("publish " + p.ID) },
+		OnUnpublish:   func(p av.Info) { event("unpublish " + p.ID) },
+		OnViewerJoin:  func(_, v av.Info) { event("join " + v.ID) },
+		OnViewerLeave: func(_, v av.Info) { event("leave " + v.ID) },
+	})
+
+	viewer := newTestWriter("viewer")
+	h.HandleWriter(viewer)
+	info, ok := h.Stream("stream")
+	at.True(ok)
+	at.False(info.Publishing)
+	at.Equal(info.Viewers, 1)
+
+	waited := make(chan StreamInfo)
+	go func() {
+		info, err := h.WaitPublisher(context.Background(), "stream")
+		at.NoError(err)
+		waited <- info
+	}()
+
+	r := newTestReader("publisher")
+	h.HandleReader(r)
+	select {
+	case info = <-waited:
+	case <-time.After(time.Second):
+		t.Fatal("publisher not awaited")
+	}
+	at.True(info.Publishing)
+	at.Equal(info.Publisher.ID, "publisher")
+
+	r.Send(t, keyframe(t, 0))
+	at.Equal(viewer.Next(t).TimeStamp, uint32(0))
+
+	at.True(h.StopStream("stream"))
+	<-viewer.Running()
+	time.Sleep(20 * time.Millisecond)
+
+	mtx.Lock()
+	defer mtx.Unlock()
+	at.Equal(events, []string{"join viewer", "publish publisher", "leave viewer", "unpublish publisher"})
+}
+
+func TestHandlerPublisherWaitExpires(t *testing.T) {
+	at := assert.New(t)
+
+	h := New(Config{PublisherWait: 50 * time.Millisecond})
+	viewer := newTestWriter("viewer")
+	h.HandleWriter(viewer)
+	select {
+	case <-viewer.Running():
+	case <-time.After(time.Second):
+		t.Fatal("viewer not closed without a publisher")
+	}
+	_, ok := h.Stream("stream")
+	at.False(ok)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	_, err := h.WaitPublisher(ctx, "stream")
+	at.Equal(err, context.DeadlineExceeded)
+
+	// without waiting early viewers are closed right away
+	h = New(Config{PublisherWait: -1})
+	viewer = newTestWriter("viewer")
+	h.HandleWriter(viewer)
+	at.True(viewer.Closed())
+	at.Empty(h.Streams())
+}
+
+func TestHandlerLookup(t *testing.T) {
+	at := assert.New(t)
+
+	h := New(Config{StreamKey: AppNameKey, PublisherWait: time.Second})
+	r := avtest.NewReader(av.Info{ID: "publisher", Key: "stream", App: "live", Name: "one", Publisher: true})
+	h.HandleReader(r)
+
+	viewer := avtest.NewWriter(av.Info{ID: "viewer", Key: "other", App: "live", Name: "one"})
+	h.HandleWriter(viewer)
+
+	info, ok := h.Lookup("live", "one")
+	at.True(ok)
+	at.Equal(info.Key, "live/one")
+	at.True(info.Publishing)
+	at.Equal(info.Viewers, 1)
+
+	_, ok = h.Lookup("live", "two")
+	at.False(ok)
+	at.Len(h.Streams(), 1)
+}
+
+func TestHandlerCollect(t *testing.T) {
+	at := assert.New(t)
+
+	h := New(Config{})
+	r := avtest.NewReader(av.Info{ID: "publisher", Key: "stream", App: "live", Name: "one", Publisher: true})
+	h.HandleReader(r)
+	h.HandleWriter(newTestWriter("viewer"))
+	for i := 0; i <= 10; i++ {
+		r.Send(t, keyframe(t, uint32(i*40)))
+	}
+	time.Sleep(20 * time.Millisecond)
+
+	values := map[string]float64{}
+	for _, f := range h.Collect() {
+		for _, s := range f.Samples {
+			at.Equal(s.Labels[:3], metrics.Labels("key", "stream", "app", "live", "name", "one"))
+			if len(s.Labels) == 3 {
+				values[f.Name] = s.Value
+			}
+		}
+	}
+	at.Equal(values["rtmp_stream_publishing"], 1.0)
+	at.Equal(values["rtmp_stream_viewers"], 1.0)
+	at.Equal(values["rtmp_stream_ingest_fps"], 25.0)
+	at.Equal(values["rtmp_stream_keyframe_interval_seconds"], 0.04)
+}
+
+func TestHandlerControl(t *testing.T) {
+	at := assert.New(t)
+
+	h := New(Config{})
+	r := newTestReader("publisher")
+	h.HandleReader(r)
+	viewer := newTestWriter("viewer")
+	h.HandleWriter(viewer)
+	r.Send(t, keyframe(t, 0))
+	viewer.Next(t)
+
+	at.True(h.UpdateTitle("stream", "title"))
+	p := viewer.Next(t)
+	at.True(p.IsMetadata)
+	values, err := amf.NewDecoder().DecodeBatch(bytes.NewReader(p.Data), amf.AMF0)
+	at.Equal(err, io.EOF)
+	at.Equal(values, []interface{}{OnControl, amf.Object{"command": ControlUpdateTitle, "title": "title"}})
+
+	at.True(h.MuteAudio("stream", true))
+	viewer.Next(t)
+	audio := &av.Packet{IsAudio: true, TimeStamp: 20, Data: []byte{0xaf, 0x01}}
+	r.Send(t, audio)
+	r.Send(t, keyframe(t, 40))
+	at.Equal(viewer.Next(t).TimeStamp, uint32(40))
+
+	info, ok := h.Stream("stream")
+	at.True(ok)
+	at.Equal(info.Title, "title")
+	at.True(info.AudioMuted)
+	at.False(h.RequestKeyframe("other"))
+}
+
+func TestHandlerCheckAliveWaiting(t *testing.T) {
+	at := assert.New(t)
+
+	h := New(Config{PublisherWait: time.Second})
+	viewer := newIdleWriter("viewer", 10*time.Millisecond)
+	h.HandleWriter(viewer)
+	time.Sleep(20 * time.Millisecond)
+
+	// a viewer waiting for the publisher gets no packets, it is kept
+	h.mtx.Lock()
+	stream := h.streams["stream"]
+	h.mtx.Unlock()
+	at.NotEqual(stream.CheckAlive(), 0)
+	at.False(viewer.Closed())
+	at.Equal(stream.Viewers(), 1)
+
+	r := newTestReader("publisher")
+	h.HandleReader(r)
+	r.Send(t, keyframe(t, 0))
+	viewer.Next(t)
+
+	// once the publisher sends a viewer which stopped reading is closed
+	time.Sleep(20 * time.Millisecond)
+	at.Equal(stream.CheckAlive(), 1)
+	at.True(viewer.Closed())
+	at.Equal(stream.Viewers(), 0)
+}
+
+func TestHandlerCheckAliveGrace(t *testing.T) {
+	at := assert.New(t)
+
+	h := New(Config{})
+	at.Equal(h.config.ReconnectGrace, DefaultConfig.ReconnectGrace)
+	at.Equal(h.config.PublisherWait, DefaultConfig.PublisherWait)
+
+	r := newTestReader("publisher")
+	h.HandleReader(r)
+	viewer := newIdleWriter("viewer", 10*time.Millisecond)
+	h.HandleWriter(viewer)
+	r.Send(t, keyframe(t, 0))
+	viewer.Next(t)
+
+	// the viewers kept for the reconnect get no packets, they outlive their write timeout
+	_ = r.Close()
+	time.Sleep(20 * time.Millisecond)
+	h.mtx.Lock()
+	stream := h.streams["stream"]
+	h.mtx.Unlock()
+	at.NotEqual(stream.CheckAlive(), 0)
+	at.False(viewer.Closed())
+	_, ok := h.Stream("stream")
+	at.True(ok)
+}
@@ -0,0 +1,49 @@
+package handler
+
+import (
+	"github.com/viderstv/common/streaming/metrics"
+)
+
+// Collect returns the metrics of the registered streams labeled with their key, app and name, the handler
+// is a metrics.Collector.
+func (h *RtmpHandler) Collect() []metrics.Family {
+	families := []metrics.Family{
+		{Name: "rtmp_stream_publishing", Help: "Whether a publisher is attached to the stream.", Type: metrics.TypeGauge},
+		{Name: "rtmp_stream_ingest_bitrate_bits", Help: "Ingest bitrate in bits per second.", Type: metrics.TypeGauge},
+		{Name: "rtmp_stream_ingest_fps", Help: "Ingest video frames per second.", Type: metrics.TypeGauge},
+		{Name: "rtmp_stream_keyframe_interval_seconds", Help: "Time between the last two keyframes.", Type: metrics.TypeGauge},
+		{Name: "rtmp_stream_ingest_bytes_total", Help: "Media bytes received from the publishers.", Type: metrics.TypeCounter},
+		{Name: "rtmp_stream_viewers", Help: "Viewers attached to the stream.", Type: metrics.TypeGauge},
+		{Name: "rtmp_stream_queue_depth_packets", Help: "Packets queued for the viewers.", Type: metrics.TypeGauge},
+		{Name: "rtmp_stream_dropped_packets_total", Help: "Packets dropped for slow viewers or from the GOP cache.", Type: metrics.TypeCounter},
+	}
+
+	for _, s := range h.Streams() {
+		labels := metrics.Labels("key", s.Key, "app", s.Publisher.App, "name", s.Publisher.Name)
+		publishing := 0.0
+		if s.Publishing {
+			publishing = 1
+		}
+
+		values := []float64{
+			publishing,
+			s.Ingest.Bitrate,
+			s.Ingest.FPS,
+			s.Ingest.KeyframeInterval.Seconds(),
+			float64(s.Ingest.Bytes),
+			float64(s.Viewers),
+			float64(s.QueueDepth),
+		}
+		for i, v := range values {
+			families[i].Samples = append(families[i].Samples, metrics.Sample{Labels: labels, Value: v})
+		}
+
+		dropped := &families[len(families)-1]
+		dropped.Samples = append(dropped.Samples,
+			metrics.Sample{Labels: metrics.Labels("key", s.Key, "app", s.Publisher.App, "name", s.Publisher.Name, "reason", "viewer"), Value: float64(s.ViewerDrops)},
+			metrics.Sample{Labels: metrics.Labels("key", s.Key, "app", s.Publisher.App, "name", s.Publisher.Name, "reason", "cache"), Value: float64(s.CacheDrops)},
+		)
+	}
+
+	return families
+}
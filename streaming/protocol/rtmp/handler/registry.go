@@ -0,0 +1,135 @@
+package handler
+
+import (
+	"context"
+	"sort"
+	"time"
+
+	"github.com/viderstv/common/streaming/av"
+	"github.com/viderstv/common/streaming/metrics"
+)
+
+// StreamInfo describes a stream of the registry.
+type StreamInfo struct {
+	Key string
+	// Publisher is the info of the current or last publisher, or of the first viewer while none attached yet.
+	Publisher av.Info
+	// Publishing is false while viewers wait for the publisher to attach or reconnect.
+	Publishing bool
+	Viewers    int
+	Created    time.Time
+	// Title and AudioMuted are set by the control commands.
+	Title      string
+	AudioMuted bool
+
+	Ingest metrics.Ingest
+	// QueueDepth is the number of packets queued for the viewers.
+	QueueDepth int
+	// ViewerDrops counts the packets dropped for slow viewers, CacheDrops the packets dropped from the
+	// GOP cache to stay within its budget.
+	ViewerDrops uint64
+	CacheDrops  uint64
+}
+
+// ViewerStats is implemented by writers which queue packets for a viewer, rtmp.VirWriter does.
+type ViewerStats interface {
+	QueueLen() int
+	DroppedPackets() uint64
+}
+
+func (s *Stream) stats(key string) StreamInfo {
+	s.writersMtx.Lock()
+	defer s.writersMtx.Unlock()
+
+	ret := StreamInfo{
+		Key:         key,
+		Publisher:   s.info,
+		Publishing:  s.reader != nil,
+		Viewers:     len(s.writers),
+		Created:     s.created,
+		Title:       s.title,
+		AudioMuted:  s.muted,
+		Ingest:      s.meter.Ingest(),
+		ViewerDrops: s.dropped,
+		CacheDrops:  s.cache.Dropped(),
+	}
+	for _, w := range s.writers {
+		if stats, ok := w.WriteCloser.(ViewerStats); ok {
+			ret.QueueDepth += stats.QueueLen()
+			ret.ViewerDrops += stats.DroppedPackets()
+		}
+	}
+	return ret
+}
+
+// Streams lists the registered streams ordered by key.
+func (h *RtmpHandler) Streams() []StreamInfo {
+	h.mtx.Lock()
+	defer h.mtx.Unlock()
+
+	ret := make([]StreamInfo, 0, len(h.streams))
+	for k, v := range h.streams {
+		ret = append(ret, v.stats(k))
+	}
+	sort.Slice(ret, func(i, j int) bool {
+		return ret[i].Key < ret[j].Key
+	})
+	return ret
+}
+
+// Stream returns the stream with the key.
+func (h *RtmpHandler) Stream(key string) (StreamInfo, bool) {
+	h.mtx.Lock()
+	defer h.mtx.Unlock()
+
+	stream, ok := h.streams[key]
+	if !ok {
+		return StreamInfo{}, false
+	}
+	return stream.stats(key), true
+}
+
+// Lookup returns the stream published to the app and stream name, a publishing stream is preferred over one
+// waiting for its publisher.
+func (h *RtmpHandler) Lookup(app, name string) (StreamInfo, bool) {
+	h.mtx.Lock()
+	defer h.mtx.Unlock()
+
+	var (
+		ret StreamInfo
+		ok  bool
+	)
+	for k, v := range h.streams {
+		info := v.stats(k)
+		if info.Publisher.App != app || info.Publisher.Name != name {
+			continue
+		}
+		if info.Publishing {
+			return info, true
+		}
+		ret, ok = info, true
+	}
+	return ret, ok
+}
+
+// WaitPublisher blocks until a publisher is attached to the stream with the key or ctx is done.
+func (h *RtmpHandler) WaitPublisher(ctx context.Context, key string) (StreamInfo, error) {
+	for {
+		h.mtx.Lock()
+		published := h.published
+		stream, ok := h.streams[key]
+		h.mtx.Unlock()
+
+		if ok {
+			if info := stream.stats(key); info.Publishing {
+				return info, nil
+			}
+		}
+
+		select {
+		case <-published:
+		case <-ctx.Done():
+			return StreamInfo{}, ctx.Err()
+		}
+	}
+}
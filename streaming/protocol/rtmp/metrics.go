@@ -0,0 +1,36 @@
+package rtmp
+
+import (
+	"github.com/viderstv/common/streaming/metrics"
+)
+
+type serverMetrics struct {
+	connections       metrics.Counter
+	tlsFailures       metrics.Counter
+	handshakeFailures metrics.Counter
+	connectFailures   metrics.Counter
+	authFailures      metrics.Counter
+	authTimeouts      metrics.Counter
+}
+
+// Collect returns the connection metrics of the server, it is a metrics.Collector.
+func (s *Server) Collect() []metrics.Family {
+	m := &s.metrics
+	return []metrics.Family{{
+		Name:    "rtmp_connections_total",
+		Help:    "Accepted RTMP connections.",
+		Type:    metrics.TypeCounter,
+		Samples: []metrics.Sample{m.connections.Sample()},
+	}, {
+		Name: "rtmp_connection_failures_total",
+		Help: "RTMP connections which failed the tls handshake, rtmp handshake, connect or stream authentication.",
+		Type: metrics.TypeCounter,
+		Samples: []metrics.Sample{
+			m.tlsFailures.Sample(metrics.Labels("stage", "tls_handshake")...),
+			m.handshakeFailures.Sample(metrics.Labels("stage", "handshake")...),
+			m.connectFailures.Sample(metrics.Labels("stage", "connect")...),
+			m.authFailures.Sample(metrics.Labels("stage", "auth")...),
+			m.authTimeouts.Sample(metrics.Labels("stage", "auth_timeout")...),
+		},
+	}}
+}
@@ -0,0 +1,25 @@
+package rtmp
+
+import (
+	"context"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/viderstv/common/streaming/av"
+	"github.com/viderstv/common/streaming/protocol/rtmp/core"
+	"github.com/viderstv/common/utils/ffprobe"
+)
+
+// Probe plays an rtmp or rtmps url and probes its streams for up to duration, connecting is bound by ctx.
+func Probe(ctx context.Context, url string, duration time.Duration) (ffprobe.FFProbeData, error) {
+	client := core.NewConnClient()
+	if err := client.StartContext(ctx, url, av.PLAY); err != nil {
+		_ = client.Close()
+		return ffprobe.FFProbeData{}, err
+	}
+
+	reader := NewVirReader(client, logrus.StandardLogger(), client.GetInfo(), nil)
+	defer reader.Close()
+
+	return ffprobe.Probe(ctx, reader, duration)
+}
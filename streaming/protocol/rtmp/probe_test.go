@@ -0,0 +1,38 @@
+package rtmp
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestProbeContext(t *testing.T) {
+	at := assert.New(t)
+
+	// the server accepts connections and never answers the handshake
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			defer conn.Close()
+		}
+	}()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	start := time.Now()
+	_, err = Probe(ctx, "rtmp://"+ln.Addr().String()+"/live/one", time.Second)
+	at.Equal(err, context.DeadlineExceeded)
+	at.Less(int64(time.Since(start)), int64(time.Second))
+}
@@ -0,0 +1,168 @@
+package rtmp
+
+import (
+	"encoding/binary"
+	"sync"
+
+	"github.com/viderstv/common/streaming/av"
+)
+
+// DropStats counts the packets a viewer did not get because it fell behind.
+type DropStats struct {
+	// Disposable counts the video frames no other frame references, they are dropped first.
+	Disposable uint64
+	// Video counts the other video frames, they are dropped when skipping to the next keyframe.
+	Video uint64
+	// Audio counts audio packets, only dropped when the queue is full of audio.
+	Audio uint64
+	// GOPSkips counts how often the viewer was skipped to the next keyframe.
+	GOPSkips uint64
+}
+
+// Total returns the number of dropped packets.
+func (d DropStats) Total() uint64 {
+	return d.Disposable + d.Video + d.Audio
+}
+
+// packetQueue is the outbound queue of a viewer, unlike a channel it lets the drop policy
+// remove queued packets.
+type packetQueue struct {
+	mtx     sync.Mutex
+	packets []*av.Packet
+	closed  bool
+	signal  chan struct{}
+}
+
+func newPacketQueue() *packetQueue {
+	return &packetQueue{
+		packets: make([]*av.Packet, 0, maxQueueNum),
+		signal:  make(chan struct{}, 1),
+	}
+}
+
+func (q *packetQueue) len() int {
+	q.mtx.Lock()
+	defer q.mtx.Unlock()
+	return len(q.packets)
+}
+
+func (q *packetQueue) push(p *av.Packet) bool {
+	q.mtx.Lock()
+	defer q.mtx.Unlock()
+	if q.closed {
+		return false
+	}
+	q.packets = append(q.packets, p)
+	q.notify()
+	return true
+}
+
+func (q *packetQueue) notify() {
+	select {
+	case q.signal <- struct{}{}:
+	default:
+	}
+}
+
+// pop blocks for the next packet, it returns false once the queue is closed.
+func (q *packetQueue) pop() (*av.Packet, bool) {
+	for {
+		q.mtx.Lock()
+		if q.closed {
+			q.mtx.Unlock()
+			return nil, false
+		}
+		if len(q.packets) != 0 {
+			p := q.packets[0]
+			q.packets[0] = nil
+			q.packets = q.packets[1:]
+			q.mtx.Unlock()
+			return p, true
+		}
+		q.mtx.Unlock()
+		<-q.signal
+	}
+}
+
+func (q *packetQueue) close() {
+	q.mtx.Lock()
+	defer q.mtx.Unlock()
+	q.closed = true
+	q.packets = nil
+	q.notify()
+}
+
+// filter removes the queued packets drop returns true for, at most limit of them when limit is positive.
+func (q *packetQueue) filter(drop func(p *av.Packet) bool, limit int) int {
+	q.mtx.Lock()
+	defer q.mtx.Unlock()
+
+	dropped := 0
+	kept := q.packets[:0]
+	for _, p := range q.packets {
+		if (limit <= 0 || dropped < limit) && drop(p) {
+			dropped++
+			continue
+		}
+		kept = append(kept, p)
+	}
+	for i := len(kept); i < len(q.packets); i++ {
+		q.packets[i] = nil
+	}
+	q.packets = kept
+	return dropped
+}
+
+// essential reports if a packet is never dropped, sequence headers and metadata are needed to decode
+// anything that follows.
+func essential(p *av.Packet) bool {
+	if p.IsMetadata {
+		return true
+	}
+	if p.IsAudio {
+		ah, ok := p.Header.(av.AudioPacketHeader)
+		return ok && ah.SoundFormat() == av.SOUND_AAC && ah.AACPacketType() == av.AAC_SEQHDR
+	}
+	vh, ok := p.Header.(av.VideoPacketHeader)
+	return ok && vh.IsSeq()
+}
+
+func keyframe(p *av.Packet) bool {
+	vh, ok := p.Header.(av.VideoPacketHeader)
+	return p.IsVideo && ok && vh.IsKeyFrame() && !vh.IsSeq()
+}
+
+// disposable reports if no other frame references a video packet, FLV disposable inter frames and
+// H.264 inter frames without a reference picture (nal_ref_idc 0) are.
+func disposable(p *av.Packet) bool {
+	if !p.IsVideo || len(p.Data) < 5 {
+		return false
+	}
+	frameType := p.Data[0] >> 4
+	if frameType == av.FRAME_DISPOSABLE {
+		return true
+	}
+	if frameType != av.FRAME_INTER || p.Data[0]&0x0f != av.VIDEO_H264 || p.Data[1] != av.AVC_NALU {
+		return false
+	}
+
+	// NAL units with 4 byte lengths, the length size every encoder we see uses.
+	found := false
+	data := p.Data[5:]
+	for len(data) >= 4 {
+		size := binary.BigEndian.Uint32(data)
+		data = data[4:]
+		if size == 0 || uint64(size) > uint64(len(data)) {
+			return false
+		}
+		nalType := data[0] & 0x1f
+		if nalType >= 1 && nalType <= 5 {
+			if data[0]&0x60 != 0 {
+				return false
+			}
+			found = true
+		}
+		data = data[size:]
+	}
+	return found
+}
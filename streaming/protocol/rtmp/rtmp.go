@@ -2,6 +2,7 @@ package rtmp
 
 import (
 	"bytes"
+	"crypto/tls"
 	"fmt"
 	"io"
 	"net"
@@ -9,8 +10,6 @@ import (
 	"time"
 
 	"github.com/sirupsen/logrus"
-	"github.com/viderstv/common/errors"
-	"github.com/viderstv/common/instance"
 	"github.com/viderstv/common/streaming/av"
 	"github.com/viderstv/common/streaming/protocol/amf"
 	"github.com/viderstv/common/streaming/protocol/rtmp/core"
@@ -18,19 +17,26 @@ import (
 )
 
 const (
-	maxQueueNum  = 1024
-	writeTimeout = 10 * time.Second
+	maxQueueNum = 1024
+	// congestedQueueNum is the queue length from which a viewer drops disposable frames.
+	congestedQueueNum = maxQueueNum / 4
+	writeTimeout      = 10 * time.Second
 )
 
 type Server struct {
 	once     sync.Once
-	ln       net.Listener
+	lnMtx    sync.Mutex
+	lns      []net.Listener
+	certMtx  sync.Mutex
+	certs    *certStore
 	wg       sync.WaitGroup
 	shutdown chan struct{}
 	config   Config
+	metrics  serverMetrics
 }
 
-func New(config Config) instance.RtmpServer {
+// New returns a server, it is an instance.RtmpTLSServer and a metrics.Collector.
+func New(config Config) *Server {
 	return &Server{
 		config:   config.fill(),
 		shutdown: make(chan struct{}),
@@ -43,7 +49,48 @@ func (s *Server) Shutdown() error {
 		close(s.shutdown)
 	})
 	s.wg.Wait()
-	return s.ln.Close()
+
+	s.lnMtx.Lock()
+	defer s.lnMtx.Unlock()
+	var err error
+	for _, ln := range s.lns {
+		if e := ln.Close(); e != nil && err == nil {
+			err = e
+		}
+	}
+	return err
+}
+
+// ServeTLS serves rtmps on ln, it can run next to Serve on a different listener.
+// The certificates from Config.TLS are checked for changes every ReloadInterval.
+func (s *Server) ServeTLS(ln net.Listener) error {
+	s.certMtx.Lock()
+	if s.certs == nil {
+		certs, err := newCertStore(s.config.TLS)
+		if err != nil {
+			s.certMtx.Unlock()
+			return err
+		}
+		s.certs = certs
+		go certs.watch(s)
+	}
+	certs := s.certs
+	s.certMtx.Unlock()
+
+	return s.Serve(tls.NewListener(ln, certs.tlsConfig()))
+}
+
+// ReloadCertificates reloads the tls certificates which changed on disk without waiting for the next interval.
+func (s *Server) ReloadCertificates() error {
+	s.certMtx.Lock()
+	certs := s.certs
+	s.certMtx.Unlock()
+	if certs == nil {
+		return ErrNoCertificate
+	}
+
+	_, err := certs.reload()
+	return err
 }
 
 func (s *Server) Serve(ln net.Listener) (err error) {
@@ -54,7 +101,9 @@ func (s *Server) Serve(ln net.Listener) (err error) {
 		}
 	}()
 
-	s.ln = ln
+	s.lnMtx.Lock()
+	s.lns = append(s.lns, ln)
+	s.lnMtx.Unlock()
 
 	for {
 		conn, err := ln.Accept()
@@ -85,95 +134,139 @@ func (s *Server) handleConn(conn net.Conn) {
 		_ = conn.Close()
 	}()
 
-	info := av.Info{}
+	s.metrics.connections.Inc()
 	connId := uid.NewId()
 	addr := conn.RemoteAddr()
 	if !s.config.OnNewStream(addr) {
 		return
 	}
 
-	defer func() {
-		s.config.OnStreamClose(info, addr)
-	}()
+	var tlsState *av.TLSInfo
+	if tlsConn, ok := conn.(*tls.Conn); ok {
+		_ = tlsConn.SetDeadline(time.Now().Add(s.config.TLS.HandshakeTimeout))
+		if err := tlsConn.Handshake(); err != nil {
+			s.config.Logger.Debug("tls handshake failed: ", err)
+			s.metrics.tlsFailures.Inc()
+			return
+		}
+		_ = tlsConn.SetDeadline(time.Time{})
+		tlsState = tlsInfo(tlsConn.ConnectionState())
+	}
 
 	coreConn := core.NewConn(conn, 4*1024)
 	connServer := core.NewConnServer(coreConn)
 
+	// a connection without any stream is reported once with its connect info.
+	accepted := false
+	defer func() {
+		if !accepted {
+			info := connServer.GetInfo()
+			info.ID = connId
+			info.TLS = tlsState
+			s.config.OnStreamClose(info, addr)
+		}
+	}()
+
 	if err := coreConn.HandshakeServer(); err != nil {
+		s.metrics.handshakeFailures.Inc()
 		return
 	}
 
-	mtx := sync.Mutex{}
+	connServer.SetCallbackConnect(func() error {
+		connInfo := connServer.GetInfo()
+		connInfo.ID = connId
+		connInfo.TLS = tlsState
+		err := s.config.OnConnect(connInfo, addr)
+		if err != nil {
+			s.metrics.connectFailures.Inc()
+		}
+		return err
+	})
+
+	var authOnce sync.Once
 	authed := make(chan struct{})
 
-	connServer.SetCallbackAuth(func() error {
-		mtx.Lock()
-		select {
-		case <-authed:
-			return errors.ErrAlreadyAuthed
-		default:
+	connServer.SetCallbackStreamAuth(func(ns *core.NetStream) error {
+		authOnce.Do(func() {
 			close(authed)
-		}
-		mtx.Unlock()
+		})
 
-		info = connServer.GetInfo()
-		info.ID = connId
-		info.Key = connId
-		info.Publisher = connServer.IsPublisher()
+		// every stream of the connection is authenticated on its own and gets its own id. The key is the
+		// stream name, so viewers meet the publisher of the name, Authenticate may change it.
+		ns.Info.ID = uid.NewId()
+		ns.Info.Key = ns.Info.Name
+		ns.Info.Publisher = ns.IsPublisher()
+		ns.Info.TLS = tlsState
 
-		if !s.config.AuthStream(&info, addr) {
-			return errors.ErrInvalidStreamKey
+		err := s.config.Authenticate(&ns.Info, addr)
+		if err != nil {
+			s.metrics.authFailures.Inc()
 		}
-
-		return nil
+		return err
 	})
 
+	// only connections still waiting for their first stream when the timeout fires count as timeouts.
+	closed := make(chan struct{})
+	defer close(closed)
 	go func() {
+		timer := time.NewTimer(s.config.AuthTimeout)
+		defer timer.Stop()
+
 		select {
-		case <-time.After(s.config.AuthTimeout):
-			mtx.Lock()
-			close(authed)
-			mtx.Unlock()
+		case <-timer.C:
+			s.metrics.authTimeouts.Inc()
 			_ = conn.Close()
 		case <-authed:
+		case <-closed:
 		}
 	}()
 
-	if err := connServer.ReadMsg(); err != nil {
-		return
+	wg := sync.WaitGroup{}
+	for {
+		ns, err := connServer.AcceptStream()
+		if err != nil {
+			break
+		}
+		accepted = true
+
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			s.handleStream(ns, addr)
+		}()
 	}
+	wg.Wait()
+}
+
+func (s *Server) handleStream(ns *core.NetStream, addr net.Addr) {
+	defer func() {
+		if err := recover(); err != nil {
+			s.config.Logger.Error("panic in handleStream: ", err)
+		}
+		_ = ns.Close()
+		s.config.OnStreamClose(ns.Info, addr)
+	}()
 
+	info := ns.Info
 	decoder := &amf.Decoder{}
+	handleCmdMsg := func(chunk *core.ChunkStream) error {
+		data := chunk.Data
+		if chunk.TypeID == 17 {
+			data = data[1:]
+		}
+
+		vs, err := decoder.DecodeBatch(bytes.NewReader(data), amf.AMF0)
+		if err != nil && err != io.EOF {
+			return err
+		}
+		return s.config.HandleCmdChunk(info, vs, chunk)
+	}
 
-	if connServer.IsPublisher() {
+	if ns.IsPublisher() {
 		s.wg.Add(1)
 		defer s.wg.Done()
-		publisher := NewVirReader(connServer, s.config.Logger, info, func(chunk *core.ChunkStream) error {
-			amfType := amf.AMF0
-			if chunk.TypeID == 17 {
-				chunk.Data = chunk.Data[1:]
-			}
-
-			vs, err := decoder.DecodeBatch(bytes.NewReader(chunk.Data), amf.Version(amfType))
-			if err != nil && err != io.EOF {
-				return err
-			}
-			return s.config.HandleCmdChunk(info, vs, chunk)
-		})
-		s.config.HandlePublisher(info, publisher)
+		s.config.HandlePublisher(info, NewVirReader(ns, s.config.Logger, info, handleCmdMsg))
 	} else {
-		viewer := NewVirWriter(connServer, s.config.Logger, info, func(chunk *core.ChunkStream) error {
-			amfType := amf.AMF0
-			if chunk.TypeID == 17 {
-				chunk.Data = chunk.Data[1:]
-			}
-
-			vs, err := decoder.DecodeBatch(bytes.NewReader(chunk.Data), amf.Version(amfType))
-			if err != nil && err != io.EOF {
-				return err
-			}
-			return s.config.HandleCmdChunk(info, vs, chunk)
-		})
-		s.config.HandleViewer(info, viewer)
+		s.config.HandleViewer(info, NewVirWriter(ns, s.config.Logger, info, handleCmdMsg))
 	}
 }
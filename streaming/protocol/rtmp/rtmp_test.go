@@ -0,0 +1,102 @@
+package rtmp
+
+import (
+	"net"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/viderstv/common/streaming/av"
+	"github.com/viderstv/common/streaming/protocol/rtmp/core"
+)
+
+func TestServerStreamKey(t *testing.T) {
+	at := assert.New(t)
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	infos := make(chan av.Info, 2)
+	published := make(chan struct{})
+	s := New(Config{
+		Authenticate: func(info *av.Info, addr net.Addr) error {
+			infos <- *info
+			return nil
+		},
+		HandlePublisher: func(info av.Info, reader av.ReadCloser) {
+			close(published)
+			var p av.Packet
+			for reader.Read(&p) == nil {
+			}
+		},
+		HandleViewer: func(info av.Info, writer av.WriteCloser) { <-writer.Running() },
+	})
+	go func() {
+		_ = s.Serve(ln)
+	}()
+	defer s.Shutdown()
+
+	var infoList []av.Info
+	for _, method := range []string{av.PUBLISH, av.PLAY} {
+		client := core.NewConnClient()
+		at.NoError(client.Start("rtmp://"+ln.Addr().String()+"/live/one?token=abc", method))
+		defer client.Close()
+
+		select {
+		case info := <-infos:
+			infoList = append(infoList, info)
+		case <-time.After(time.Second):
+			t.Fatal("stream not authenticated")
+		}
+	}
+
+	<-published
+
+	// publishers and viewers of a name share the key, each stream has its own id
+	at.Equal(infoList[0].Key, "one")
+	at.Equal(infoList[1].Key, "one")
+	at.True(infoList[0].Publisher)
+	at.False(infoList[1].Publisher)
+	at.NotEqual(infoList[0].ID, infoList[1].ID)
+	at.Equal(infoList[1].Params, url.Values{"token": {"abc"}})
+}
+
+func TestServerAuthTimeout(t *testing.T) {
+	at := assert.New(t)
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := New(Config{AuthTimeout: 100 * time.Millisecond})
+	go func() {
+		_ = s.Serve(ln)
+	}()
+	defer s.Shutdown()
+
+	handshake := func() net.Conn {
+		conn, err := net.Dial("tcp", ln.Addr().String())
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := core.NewConn(conn, 4*1024).HandshakeClient(); err != nil {
+			t.Fatal(err)
+		}
+		return conn
+	}
+
+	// a connection which closes on its own is no timeout
+	_ = handshake().Close()
+
+	idle := handshake()
+	defer idle.Close()
+
+	// the server closes the idle connection
+	_ = idle.SetReadDeadline(time.Now().Add(time.Second))
+	_, err = idle.Read(make([]byte, 1))
+	at.Error(err)
+	time.Sleep(20 * time.Millisecond)
+	at.Equal(s.metrics.authTimeouts.Value(), uint64(1))
+}
@@ -0,0 +1,344 @@
+package rtmp
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/viderstv/common/streaming/av"
+)
+
+var (
+	ErrNoCertificate = fmt.Errorf("no tls certificate configured")
+	ErrInvalidCA     = fmt.Errorf("no certificates found in ca file")
+)
+
+// TLSCertificate is a certificate and key pair on disk.
+type TLSCertificate struct {
+	CertFile string
+	KeyFile  string
+}
+
+// TLSHost overrides the certificate and client authentication for a single SNI host name.
+// Host names may start with a wildcard label, for example *.example.com.
+type TLSHost struct {
+	TLSCertificate
+	// ClientAuth is used instead of TLSConfig.ClientAuth for this host, for example to require
+	// certificates on the host name internal relays connect to.
+	ClientAuth *tls.ClientAuthType
+}
+
+type TLSConfig struct {
+	// Default is served when the client sends no SNI or no host matches.
+	Default TLSCertificate
+	Hosts   map[string]TLSHost
+
+	// ClientCAFile verifies client certificates, required for any ClientAuth that verifies.
+	ClientCAFile string
+	ClientAuth   tls.ClientAuthType
+
+	MinVersion uint16
+	// ReloadInterval is how often the certificate and client ca files are checked for changes.
+	ReloadInterval time.Duration
+	// HandshakeTimeout bounds the tls handshake, AuthTimeout is used when it is not set.
+	HandshakeTimeout time.Duration
+}
+
+func (c TLSConfig) fill(authTimeout time.Duration) TLSConfig {
+	if c.MinVersion == 0 {
+		c.MinVersion = tls.VersionTLS12
+	}
+	if c.ReloadInterval <= 0 {
+		c.ReloadInterval = time.Minute
+	}
+	if c.HandshakeTimeout <= 0 {
+		c.HandshakeTimeout = authTimeout
+	}
+	return c
+}
+
+type loadedCert struct {
+	files   TLSCertificate
+	host    *TLSHost
+	modTime time.Time
+	cert    *tls.Certificate
+}
+
+func modTime(files TLSCertificate) (time.Time, error) {
+	t := time.Time{}
+	for _, f := range []string{files.CertFile, files.KeyFile} {
+		st, err := os.Stat(f)
+		if err != nil {
+			return t, err
+		}
+		if st.ModTime().After(t) {
+			t = st.ModTime()
+		}
+	}
+	return t, nil
+}
+
+func (l *loadedCert) load() (bool, error) {
+	t, err := modTime(l.files)
+	if err != nil {
+		return false, err
+	}
+	if l.cert != nil && t.Equal(l.modTime) {
+		return false, nil
+	}
+
+	cert, err := tls.LoadX509KeyPair(l.files.CertFile, l.files.KeyFile)
+	if err != nil {
+		return false, err
+	}
+	l.cert = &cert
+	l.modTime = t
+	return true, nil
+}
+
+// certStore holds the loaded certificates and client cas and swaps them when the files change on disk.
+type certStore struct {
+	mtx       sync.RWMutex
+	config    TLSConfig
+	def       *loadedCert
+	hosts     map[string]*loadedCert
+	clientCA  *x509.CertPool
+	caModTime time.Time
+}
+
+func newCertStore(config TLSConfig) (*certStore, error) {
+	if config.Default.CertFile == "" && len(config.Hosts) == 0 {
+		return nil, ErrNoCertificate
+	}
+
+	s := &certStore{
+		config: config,
+		hosts:  map[string]*loadedCert{},
+	}
+	if config.Default.CertFile != "" {
+		s.def = &loadedCert{files: config.Default}
+	}
+	for host, h := range config.Hosts {
+		h := h
+		s.hosts[strings.ToLower(host)] = &loadedCert{files: h.TLSCertificate, host: &h}
+	}
+
+	if _, err := s.loadClientCA(); err != nil {
+		return nil, err
+	}
+	if _, err := s.reload(); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// loadClientCA reads the client ca file if it changed since the last call, s.mtx must be held after
+// newCertStore. A failing file keeps the old pool.
+func (s *certStore) loadClientCA() (bool, error) {
+	if s.config.ClientCAFile == "" {
+		return false, nil
+	}
+
+	st, err := os.Stat(s.config.ClientCAFile)
+	if err != nil {
+		return false, err
+	}
+	if s.clientCA != nil && st.ModTime().Equal(s.caModTime) {
+		return false, nil
+	}
+
+	pem, err := os.ReadFile(s.config.ClientCAFile)
+	if err != nil {
+		return false, err
+	}
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(pem) {
+		return false, ErrInvalidCA
+	}
+	s.clientCA = pool
+	s.caModTime = st.ModTime()
+	return true, nil
+}
+
+// reload loads every certificate and the client cas which changed since the last call, a failing file keeps
+// the old one.
+func (s *certStore) reload() (bool, error) {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+
+	var (
+		changed  bool
+		firstErr error
+	)
+	load := func(l *loadedCert) {
+		// load into a copy so a broken file never replaces a working certificate
+		next := *l
+		ok, err := next.load()
+		if err != nil {
+			if firstErr == nil {
+				firstErr = fmt.Errorf("%s: %v", l.files.CertFile, err)
+			}
+			return
+		}
+		if ok {
+			*l = next
+			changed = true
+		}
+	}
+
+	if s.def != nil {
+		load(s.def)
+	}
+	for _, l := range s.hosts {
+		load(l)
+	}
+
+	ok, err := s.loadClientCA()
+	if err != nil && firstErr == nil {
+		firstErr = fmt.Errorf("%s: %v", s.config.ClientCAFile, err)
+	}
+	changed = changed || ok
+
+	return changed, firstErr
+}
+
+// lookup returns the certificate and the host config for a server name, exact names win over wildcards.
+func (s *certStore) lookup(serverName string) (*tls.Certificate, *TLSHost) {
+	name := strings.ToLower(strings.TrimSuffix(serverName, "."))
+
+	s.mtx.RLock()
+	defer s.mtx.RUnlock()
+
+	candidates := []string{name}
+	if i := strings.IndexByte(name, '.'); i > 0 {
+		candidates = append(candidates, "*"+name[i:])
+	}
+	for _, c := range candidates {
+		if l, ok := s.hosts[c]; ok && l.cert != nil {
+			return l.cert, l.host
+		}
+	}
+
+	if s.def != nil {
+		return s.def.cert, nil
+	}
+	return nil, nil
+}
+
+// clientCAs returns the current pool to verify client certificates with.
+func (s *certStore) clientCAs() *x509.CertPool {
+	s.mtx.RLock()
+	defer s.mtx.RUnlock()
+	return s.clientCA
+}
+
+func (s *certStore) tlsConfig() *tls.Config {
+	base := &tls.Config{
+		MinVersion: s.config.MinVersion,
+		ClientAuth: s.config.ClientAuth,
+		ClientCAs:  s.clientCAs(),
+	}
+
+	base.GetConfigForClient = func(hello *tls.ClientHelloInfo) (*tls.Config, error) {
+		cert, host := s.lookup(hello.ServerName)
+		if cert == nil {
+			return nil, ErrNoCertificate
+		}
+
+		cfg := &tls.Config{
+			MinVersion:   base.MinVersion,
+			ClientAuth:   base.ClientAuth,
+			ClientCAs:    s.clientCAs(),
+			Certificates: []tls.Certificate{*cert},
+		}
+		if host != nil && host.ClientAuth != nil {
+			cfg.ClientAuth = *host.ClientAuth
+		}
+		return cfg, nil
+	}
+
+	return base
+}
+
+func (s *certStore) watch(srv *Server) {
+	ticker := time.NewTicker(s.config.ReloadInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-srv.shutdown:
+			return
+		case <-ticker.C:
+		}
+
+		changed, err := s.reload()
+		if err != nil {
+			srv.config.Logger.Error("failed to reload tls certificates: ", err)
+			srv.config.OnError(err)
+		}
+		if changed {
+			srv.config.Logger.Info("reloaded tls certificates")
+		}
+	}
+}
+
+func tlsVersionName(v uint16) string {
+	switch v {
+	case tls.VersionTLS10:
+		return "TLS 1.0"
+	case tls.VersionTLS11:
+		return "TLS 1.1"
+	case tls.VersionTLS12:
+		return "TLS 1.2"
+	case tls.VersionTLS13:
+		return "TLS 1.3"
+	}
+	return fmt.Sprintf("0x%04x", v)
+}
+
+func tlsInfo(state tls.ConnectionState) *av.TLSInfo {
+	info := &av.TLSInfo{
+		ServerName:  state.ServerName,
+		Version:     tlsVersionName(state.Version),
+		CipherSuite: tls.CipherSuiteName(state.CipherSuite),
+	}
+	if len(state.VerifiedChains) > 0 && len(state.PeerCertificates) > 0 {
+		info.PeerVerified = true
+		info.PeerCommonName = state.PeerCertificates[0].Subject.CommonName
+	}
+	return info
+}
+
+// NewClientTLSConfig builds the tls config for core.NewConnClientWithTls when relaying to an rtmps server
+// which verifies client certificates. Every argument is optional.
+func NewClientTLSConfig(certFile, keyFile, caFile, serverName string) (*tls.Config, error) {
+	cfg := &tls.Config{
+		MinVersion: tls.VersionTLS12,
+		ServerName: serverName,
+	}
+
+	if certFile != "" {
+		cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+		if err != nil {
+			return nil, err
+		}
+		cfg.Certificates = []tls.Certificate{cert}
+	}
+
+	if caFile != "" {
+		pem, err := os.ReadFile(caFile)
+		if err != nil {
+			return nil, err
+		}
+		cfg.RootCAs = x509.NewCertPool()
+		if !cfg.RootCAs.AppendCertsFromPEM(pem) {
+			return nil, ErrInvalidCA
+		}
+	}
+
+	return cfg, nil
+}
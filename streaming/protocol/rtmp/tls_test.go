@@ -0,0 +1,218 @@
+package rtmp
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/viderstv/common/instance"
+	"github.com/viderstv/common/streaming/metrics"
+)
+
+func writeCert(t *testing.T, dir, name string, hosts ...string) TLSCertificate {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(time.Now().UnixNano()),
+		Subject:      pkix.Name{CommonName: name},
+		DNSNames:     hosts,
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyDer, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	files := TLSCertificate{
+		CertFile: filepath.Join(dir, name+".crt"),
+		KeyFile:  filepath.Join(dir, name+".key"),
+	}
+	if err := os.WriteFile(files.CertFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(files.KeyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDer}), 0600); err != nil {
+		t.Fatal(err)
+	}
+	return files
+}
+
+func commonName(t *testing.T, cert *tls.Certificate) string {
+	if cert == nil {
+		return ""
+	}
+	c, err := x509.ParseCertificate(cert.Certificate[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	return c.Subject.CommonName
+}
+
+func TestCertStoreLookup(t *testing.T) {
+	at := assert.New(t)
+	dir := t.TempDir()
+
+	require := tls.RequireAndVerifyClientCert
+	store, err := newCertStore(TLSConfig{
+		Default: writeCert(t, dir, "default"),
+		Hosts: map[string]TLSHost{
+			"live.example.com": {TLSCertificate: writeCert(t, dir, "live")},
+			"*.relay.internal": {TLSCertificate: writeCert(t, dir, "relay"), ClientAuth: &require},
+		},
+	})
+	at.Equal(err, nil)
+
+	cert, host := store.lookup("LIVE.example.com")
+	at.Equal(commonName(t, cert), "live")
+	at.Nil(host.ClientAuth)
+
+	cert, host = store.lookup("eu.relay.internal")
+	at.Equal(commonName(t, cert), "relay")
+	at.Equal(*host.ClientAuth, tls.RequireAndVerifyClientCert)
+
+	cert, host = store.lookup("")
+	at.Equal(commonName(t, cert), "default")
+	at.Nil(host)
+
+	_, err = newCertStore(TLSConfig{})
+	at.Equal(err, ErrNoCertificate)
+}
+
+func TestCertStoreReload(t *testing.T) {
+	at := assert.New(t)
+	dir := t.TempDir()
+
+	files := writeCert(t, dir, "default")
+	store, err := newCertStore(TLSConfig{Default: files})
+	at.Equal(err, nil)
+
+	changed, err := store.reload()
+	at.Equal(err, nil)
+	at.False(changed)
+
+	// replace the certificate on disk with a newer one
+	next := writeCert(t, t.TempDir(), "rotated")
+	for src, dst := range map[string]string{next.CertFile: files.CertFile, next.KeyFile: files.KeyFile} {
+		b, _ := os.ReadFile(src)
+		at.Equal(os.WriteFile(dst, b, 0600), nil)
+		future := time.Now().Add(time.Minute)
+		at.Equal(os.Chtimes(dst, future, future), nil)
+	}
+
+	changed, err = store.reload()
+	at.Equal(err, nil)
+	at.True(changed)
+	cert, _ := store.lookup("")
+	at.Equal(commonName(t, cert), "rotated")
+
+	// a broken file keeps serving the last good certificate
+	at.Equal(os.WriteFile(files.CertFile, []byte("broken"), 0600), nil)
+	future := time.Now().Add(time.Hour)
+	at.Equal(os.Chtimes(files.CertFile, future, future), nil)
+
+	_, err = store.reload()
+	at.NotEqual(err, nil)
+	cert, _ = store.lookup("")
+	at.Equal(commonName(t, cert), "rotated")
+}
+
+func TestCertStoreReloadClientCA(t *testing.T) {
+	at := assert.New(t)
+	dir := t.TempDir()
+
+	verify := func(store *certStore, b []byte) error {
+		block, _ := pem.Decode(b)
+		cert, err := x509.ParseCertificate(block.Bytes)
+		if err != nil {
+			t.Fatal(err)
+		}
+		_, err = cert.Verify(x509.VerifyOptions{Roots: store.clientCAs()})
+		return err
+	}
+
+	ca := writeCert(t, dir, "ca")
+	caPEM, _ := os.ReadFile(ca.CertFile)
+	store, err := newCertStore(TLSConfig{Default: writeCert(t, dir, "default"), ClientCAFile: ca.CertFile})
+	at.Equal(err, nil)
+	at.Equal(verify(store, caPEM), nil)
+
+	// the ca is rotated on disk
+	next := writeCert(t, t.TempDir(), "next")
+	nextPEM, _ := os.ReadFile(next.CertFile)
+	at.Equal(os.WriteFile(ca.CertFile, nextPEM, 0600), nil)
+	future := time.Now().Add(time.Minute)
+	at.Equal(os.Chtimes(ca.CertFile, future, future), nil)
+
+	changed, err := store.reload()
+	at.Equal(err, nil)
+	at.True(changed)
+	at.Equal(verify(store, nextPEM), nil)
+	at.Error(verify(store, caPEM))
+
+	// a broken file keeps the last good pool
+	at.Equal(os.WriteFile(ca.CertFile, []byte("broken"), 0600), nil)
+	future = time.Now().Add(time.Hour)
+	at.Equal(os.Chtimes(ca.CertFile, future, future), nil)
+
+	_, err = store.reload()
+	at.NotEqual(err, nil)
+	at.Equal(verify(store, nextPEM), nil)
+}
+
+func TestTLSInfo(t *testing.T) {
+	at := assert.New(t)
+	dir := t.TempDir()
+
+	store, err := newCertStore(TLSConfig{
+		Default:    writeCert(t, dir, "default", "live.example.com"),
+		MinVersion: tls.VersionTLS12,
+	})
+	at.Equal(err, nil)
+
+	c1, c2 := net.Pipe()
+	defer c1.Close()
+	defer c2.Close()
+
+	server := tls.Server(c1, store.tlsConfig())
+	go func() {
+		client := tls.Client(c2, &tls.Config{ServerName: "live.example.com", InsecureSkipVerify: true})
+		_ = client.Handshake()
+	}()
+
+	at.Equal(server.Handshake(), nil)
+
+	info := tlsInfo(server.ConnectionState())
+	at.Equal(info.ServerName, "live.example.com")
+	at.Equal(info.Version, "TLS 1.3")
+	at.False(info.PeerVerified)
+}
+
+func TestServerTLSInterface(t *testing.T) {
+	at := assert.New(t)
+
+	var s interface{} = New(Config{})
+	_, ok := s.(instance.RtmpTLSServer)
+	at.True(ok)
+	_, ok = s.(metrics.Collector)
+	at.True(ok)
+}
@@ -2,7 +2,9 @@ package rtmp
 
 import (
 	"fmt"
+	"io"
 	"sync"
+	"sync/atomic"
 
 	"github.com/sirupsen/logrus"
 	"github.com/viderstv/common/streaming/av"
@@ -25,8 +27,18 @@ type VirWriter struct {
 	closed chan struct{}
 	once   sync.Once
 
-	conn        VirConnWriter
-	packetQueue chan *av.Packet
+	conn  VirConnWriter
+	queue *packetQueue
+
+	// delivery toggles set by pause, receiveAudio and receiveVideo, accessed atomically.
+	paused       int32
+	noAudio      int32
+	noVideo      int32
+	waitKeyframe int32
+	// skipping is set while video is skipped to the next keyframe after falling behind.
+	skipping int32
+
+	drops DropStats
 
 	handleCmdMsg func(chunk *core.ChunkStream) error
 }
@@ -43,6 +55,16 @@ type VirConnWriter interface {
 	Close() error
 }
 
+// VirConnCommander is implemented by connections which answer stream commands, core.ConnServer does.
+type VirConnCommander interface {
+	HandleStreamCmd(chunk *core.ChunkStream) (core.Command, error)
+}
+
+// VirConnFlow is implemented by connections which track the acknowledgements of the peer, core.ConnServer does.
+type VirConnFlow interface {
+	FlowStats() core.FlowStats
+}
+
 func NewVirWriter(conn VirConnWriter, logger logrus.FieldLogger, info av.Info, handleCmdMsg func(chunk *core.ChunkStream) error) *VirWriter {
 	ret := &VirWriter{
 		info:         info,
@@ -50,7 +72,7 @@ func NewVirWriter(conn VirConnWriter, logger logrus.FieldLogger, info av.Info, h
 		conn:         conn,
 		logger:       logger,
 		RWBaser:      av.NewRWBaser(writeTimeout),
-		packetQueue:  make(chan *av.Packet, maxQueueNum),
+		queue:        newPacketQueue(),
 		handleCmdMsg: handleCmdMsg,
 	}
 
@@ -78,7 +100,22 @@ func (v *VirWriter) Check() {
 			_ = v.Close()
 			return
 		}
-		if v.handleCmdMsg != nil && (c.TypeID == 20 || c.TypeID == 17) {
+		if c.TypeID != 20 && c.TypeID != 17 {
+			continue
+		}
+		if commander, ok := v.conn.(VirConnCommander); ok {
+			cmd, err := commander.HandleStreamCmd(&c)
+			if err != nil {
+				_ = v.Close()
+				return
+			}
+			if cmd.EndsStream() {
+				_ = v.Close()
+				return
+			}
+			v.HandleCommand(cmd)
+		}
+		if v.handleCmdMsg != nil {
 			if err := v.handleCmdMsg(&c); err != nil {
 				_ = v.Close()
 				return
@@ -87,6 +124,108 @@ func (v *VirWriter) Check() {
 	}
 }
 
+// HandleCommand applies the delivery toggles of pause, receiveAudio and receiveVideo.
+func (v *VirWriter) HandleCommand(cmd core.Command) {
+	switch cmd.Name {
+	case core.CmdPause:
+		v.SetPaused(cmd.Flag(0))
+	case core.CmdReceiveAudio:
+		v.SetReceiveAudio(cmd.Flag(0))
+	case core.CmdReceiveVideo:
+		v.SetReceiveVideo(cmd.Flag(0))
+	}
+}
+
+func setFlag(flag *int32, b bool) {
+	if b {
+		atomic.StoreInt32(flag, 1)
+	} else {
+		atomic.StoreInt32(flag, 0)
+	}
+}
+
+// SetPaused stops delivering audio and video, playback resumes at the next keyframe.
+func (v *VirWriter) SetPaused(paused bool) {
+	setFlag(&v.paused, paused)
+	if !paused {
+		atomic.StoreInt32(&v.waitKeyframe, 1)
+	}
+}
+
+func (v *VirWriter) Paused() bool {
+	return atomic.LoadInt32(&v.paused) == 1
+}
+
+func (v *VirWriter) SetReceiveAudio(receive bool) {
+	setFlag(&v.noAudio, !receive)
+}
+
+// SetReceiveVideo toggles video delivery, enabled video resumes at the next keyframe.
+func (v *VirWriter) SetReceiveVideo(receive bool) {
+	setFlag(&v.noVideo, !receive)
+	if receive {
+		atomic.StoreInt32(&v.waitKeyframe, 1)
+	}
+}
+
+// FlowStats returns the flow control state of the viewer connection, throughput and rtt are measured
+// from the acknowledgements of the viewer.
+func (v *VirWriter) FlowStats() core.FlowStats {
+	if flow, ok := v.conn.(VirConnFlow); ok {
+		return flow.FlowStats()
+	}
+	return core.FlowStats{}
+}
+
+// Congested reports if the viewer falls behind, either the peer does not acknowledge in time or
+// the packet queue is filling up.
+func (v *VirWriter) Congested() bool {
+	return v.FlowStats().Congested() || v.queue.len() >= congestedQueueNum
+}
+
+// Drops returns the packets dropped because the viewer fell behind.
+func (v *VirWriter) Drops() DropStats {
+	return DropStats{
+		Disposable: atomic.LoadUint64(&v.drops.Disposable),
+		Video:      atomic.LoadUint64(&v.drops.Video),
+		Audio:      atomic.LoadUint64(&v.drops.Audio),
+		GOPSkips:   atomic.LoadUint64(&v.drops.GOPSkips),
+	}
+}
+
+// DroppedPackets returns the number of packets dropped because the viewer fell behind.
+func (v *VirWriter) DroppedPackets() uint64 {
+	return v.Drops().Total()
+}
+
+// QueueLen returns the number of packets queued for the viewer.
+func (v *VirWriter) QueueLen() int {
+	return v.queue.len()
+}
+
+// deliver reports if a packet should be sent with the current toggles, sequence headers and metadata always are.
+func (v *VirWriter) deliver(p *av.Packet) bool {
+	if essential(p) {
+		return true
+	}
+
+	if p.IsAudio {
+		return atomic.LoadInt32(&v.paused) == 0 && atomic.LoadInt32(&v.noAudio) == 0
+	}
+
+	vh, _ := p.Header.(av.VideoPacketHeader)
+	if atomic.LoadInt32(&v.paused) == 1 || atomic.LoadInt32(&v.noVideo) == 1 {
+		return false
+	}
+	if atomic.LoadInt32(&v.waitKeyframe) == 1 {
+		if vh == nil || !vh.IsKeyFrame() {
+			return false
+		}
+		atomic.StoreInt32(&v.waitKeyframe, 0)
+	}
+	return true
+}
+
 func (v *VirWriter) Write(p *av.Packet) (err error) {
 	err = nil
 
@@ -101,32 +240,82 @@ func (v *VirWriter) Write(p *av.Packet) (err error) {
 		}
 	}()
 
-	select {
-	case v.packetQueue <- p:
-	default:
-		<-v.packetQueue
-		v.packetQueue <- p
-		isKeyFrame := false
-		if p.IsVideo {
-			pkt, _ := p.Header.(av.VideoPacketHeader)
-			isKeyFrame = pkt.IsKeyFrame()
-		}
-		v.logger.WithFields(logrus.Fields{
-			"is_video":    p.IsVideo,
-			"is_audio":    p.IsAudio,
-			"is_metadata": p.IsMetadata,
-			"is_keyframe": isKeyFrame,
-			"info":        v.Info(),
-		}).Warn("dropping packet")
+	if !v.deliver(p) {
+		return
 	}
+	v.enqueue(p)
 
 	return
 }
 
+// enqueue queues a packet with the drop policy for viewers which fall behind. Sequence headers and
+// metadata are always queued, disposable frames are dropped first and far behind viewers skip to the
+// next keyframe while audio stays continuous.
+func (v *VirWriter) enqueue(p *av.Packet) {
+	if essential(p) {
+		v.queue.push(p)
+		return
+	}
+
+	if p.IsVideo && atomic.LoadInt32(&v.skipping) == 1 {
+		if !keyframe(p) {
+			atomic.AddUint64(&v.drops.Video, 1)
+			return
+		}
+		atomic.StoreInt32(&v.skipping, 0)
+	}
+
+	if v.queue.len() >= maxQueueNum {
+		if v.skipGOP(p) {
+			return
+		}
+		if v.queue.len() >= maxQueueNum {
+			// nothing but audio is left, the oldest audio makes room.
+			n := v.queue.filter(func(p *av.Packet) bool {
+				return p.IsAudio && !essential(p)
+			}, v.queue.len()-maxQueueNum+1)
+			atomic.AddUint64(&v.drops.Audio, uint64(n))
+		}
+	} else if disposable(p) && v.Congested() {
+		atomic.AddUint64(&v.drops.Disposable, 1)
+		return
+	}
+
+	v.queue.push(p)
+}
+
+// skipGOP drops the queued video frames and reports if p is dropped too, video resumes with the next keyframe.
+func (v *VirWriter) skipGOP(p *av.Packet) bool {
+	n := v.queue.filter(func(p *av.Packet) bool {
+		return p.IsVideo && !essential(p)
+	}, 0)
+	drop := p.IsVideo && !keyframe(p)
+	if drop {
+		atomic.StoreInt32(&v.skipping, 1)
+		n++
+	}
+	if n == 0 {
+		return false
+	}
+	atomic.AddUint64(&v.drops.Video, uint64(n))
+	atomic.AddUint64(&v.drops.GOPSkips, 1)
+
+	v.logger.WithFields(logrus.Fields{
+		"dropped": n,
+		"info":    v.Info(),
+	}).Debug("viewer fell behind, skipping to the next keyframe")
+	return drop
+}
+
 func (v *VirWriter) SendPacket() error {
 	cs := core.ChunkStream{}
 
-	for p := range v.packetQueue {
+	for {
+		p, ok := v.queue.pop()
+		if !ok {
+			break
+		}
+
 		cs.Data = p.Data
 		cs.Length = uint32(len(p.Data))
 		cs.StreamID = p.StreamID
@@ -164,7 +353,7 @@ func (v *VirWriter) Info() av.Info {
 func (v *VirWriter) Close() error {
 	v.once.Do(func() {
 		close(v.closed)
-		close(v.packetQueue)
+		v.queue.close()
 	})
 
 	return v.conn.Close()
@@ -185,7 +374,8 @@ type VirReader struct {
 
 	handleCmdMsg func(chunk *core.ChunkStream) error
 
-	stats Stats
+	stats       Stats
+	unpublished bool
 }
 
 func NewVirReader(conn VirConnReader, logger logrus.FieldLogger, info av.Info, handleCmdMsg func(chunk *core.ChunkStream) error) *VirReader {
@@ -201,14 +391,22 @@ func NewVirReader(conn VirConnReader, logger logrus.FieldLogger, info av.Info, h
 }
 
 func (v *VirReader) Stats() Stats {
-	return v.stats
+	return Stats{
+		VideoDataInBytes: atomic.LoadUint64(&v.stats.VideoDataInBytes),
+		AudioDataInBytes: atomic.LoadUint64(&v.stats.AudioDataInBytes),
+	}
+}
+
+// Unpublished reports if the stream ended with FCUnpublish, deleteStream or closeStream instead of a connection error.
+func (v *VirReader) Unpublished() bool {
+	return v.unpublished
 }
 
 func (v *VirReader) SaveStatics(length uint64, isVideoFlag bool) {
 	if isVideoFlag {
-		v.stats.VideoDataInBytes += length
+		atomic.AddUint64(&v.stats.VideoDataInBytes, length)
 	} else {
-		v.stats.AudioDataInBytes += length
+		atomic.AddUint64(&v.stats.AudioDataInBytes, length)
 	}
 }
 
@@ -227,10 +425,25 @@ func (v *VirReader) Read(p *av.Packet) (err error) {
 			return err
 		}
 
-		if v.handleCmdMsg != nil && (cs.TypeID == 20 || cs.TypeID == 17) {
-			if err := v.handleCmdMsg(&cs); err != nil {
-				_ = v.Close()
-				return err
+		if cs.TypeID == 20 || cs.TypeID == 17 {
+			if commander, ok := v.conn.(VirConnCommander); ok {
+				cmd, err := commander.HandleStreamCmd(&cs)
+				if err != nil {
+					_ = v.Close()
+					return err
+				}
+				if cmd.EndsStream() {
+					// the publisher ended the stream in order, readers see a clean end of stream.
+					v.unpublished = true
+					_ = v.Close()
+					return io.EOF
+				}
+			}
+			if v.handleCmdMsg != nil {
+				if err := v.handleCmdMsg(&cs); err != nil {
+					_ = v.Close()
+					return err
+				}
 			}
 		}
 		if cs.TypeID == av.TAG_AUDIO ||
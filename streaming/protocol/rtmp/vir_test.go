@@ -0,0 +1,147 @@
+package rtmp
+
+import (
+	"testing"
+
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/viderstv/common/streaming/av"
+	"github.com/viderstv/common/streaming/container/flv"
+	"github.com/viderstv/common/streaming/protocol/rtmp/core"
+)
+
+func videoPacket(t *testing.T, header ...byte) *av.Packet {
+	tag := &flv.Tag{}
+	if _, err := tag.ParseMediaTagHeader(header, true); err != nil {
+		t.Fatal(err)
+	}
+	return &av.Packet{IsVideo: true, Header: tag}
+}
+
+func audioPacket(t *testing.T, header ...byte) *av.Packet {
+	tag := &flv.Tag{}
+	if _, err := tag.ParseMediaTagHeader(header, false); err != nil {
+		t.Fatal(err)
+	}
+	return &av.Packet{IsAudio: true, Header: tag}
+}
+
+func TestVirWriterDelivery(t *testing.T) {
+	at := assert.New(t)
+
+	var (
+		seq      = videoPacket(t, 0x17, 0x00, 0x00, 0x00, 0x00)
+		keyframe = videoPacket(t, 0x17, 0x01, 0x00, 0x00, 0x00)
+		inter    = videoPacket(t, 0x27, 0x01, 0x00, 0x00, 0x00)
+		aacSeq   = audioPacket(t, 0xaf, 0x00)
+		aac      = audioPacket(t, 0xaf, 0x01)
+		metadata = &av.Packet{IsMetadata: true}
+	)
+
+	v := &VirWriter{}
+	for _, p := range []*av.Packet{seq, keyframe, inter, aacSeq, aac, metadata} {
+		at.True(v.deliver(p))
+	}
+
+	v.HandleCommand(core.Command{Name: core.CmdPause, Values: []interface{}{"pause", 0.0, nil, true}})
+	at.True(v.Paused())
+	at.False(v.deliver(keyframe))
+	at.False(v.deliver(aac))
+	at.True(v.deliver(seq))
+	at.True(v.deliver(aacSeq))
+	at.True(v.deliver(metadata))
+
+	// video resumes at the next keyframe
+	v.HandleCommand(core.Command{Name: core.CmdPause, Values: []interface{}{"pause", 0.0, nil, false}})
+	at.True(v.deliver(aac))
+	at.False(v.deliver(inter))
+	at.True(v.deliver(keyframe))
+	at.True(v.deliver(inter))
+
+	v.HandleCommand(core.Command{Name: core.CmdReceiveAudio, Values: []interface{}{"receiveAudio", 0.0, nil, false}})
+	at.False(v.deliver(aac))
+	at.True(v.deliver(inter))
+	v.SetReceiveAudio(true)
+	at.True(v.deliver(aac))
+
+	v.HandleCommand(core.Command{Name: core.CmdReceiveVideo, Values: []interface{}{"receiveVideo", 0.0, nil, false}})
+	at.False(v.deliver(keyframe))
+	at.True(v.deliver(aac))
+	v.SetReceiveVideo(true)
+	at.False(v.deliver(inter))
+	at.True(v.deliver(keyframe))
+}
+
+func TestDisposable(t *testing.T) {
+	at := assert.New(t)
+
+	nalu := func(header byte) []byte {
+		return []byte{0x27, 0x01, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x02, header, 0x9a}
+	}
+
+	at.True(disposable(&av.Packet{IsVideo: true, Data: []byte{0x37, 0x01, 0x00, 0x00, 0x00}}))
+	at.True(disposable(&av.Packet{IsVideo: true, Data: nalu(0x01)}))
+	at.False(disposable(&av.Packet{IsVideo: true, Data: nalu(0x41)}))
+	at.False(disposable(&av.Packet{IsVideo: true, Data: []byte{0x17, 0x01, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x02, 0x05, 0x88}}))
+	// truncated nal units are kept
+	at.False(disposable(&av.Packet{IsVideo: true, Data: nalu(0x01)[:9]}))
+}
+
+func TestVirWriterDropPolicy(t *testing.T) {
+	at := assert.New(t)
+
+	var (
+		seq        = videoPacket(t, 0x17, 0x00, 0x00, 0x00, 0x00)
+		key        = videoPacket(t, 0x17, 0x01, 0x00, 0x00, 0x00)
+		inter      = videoPacket(t, 0x27, 0x01, 0x00, 0x00, 0x00)
+		disposable = videoPacket(t, 0x37, 0x01, 0x00, 0x00, 0x00)
+		aac        = audioPacket(t, 0xaf, 0x01)
+	)
+	disposable.Data = []byte{0x37, 0x01, 0x00, 0x00, 0x00}
+
+	v := &VirWriter{queue: newPacketQueue(), logger: logrus.New()}
+	v.enqueue(seq)
+	for v.queue.len() < congestedQueueNum {
+		v.enqueue(aac)
+	}
+	v.enqueue(disposable)
+	v.enqueue(inter)
+	at.Equal(v.queue.len(), congestedQueueNum+1)
+	at.Equal(v.Drops(), DropStats{Disposable: 1})
+
+	// far behind, the queued video is dropped up to the next keyframe
+	for v.queue.len() < maxQueueNum {
+		v.enqueue(inter)
+	}
+	videos := maxQueueNum - congestedQueueNum
+	v.enqueue(inter)
+	v.enqueue(inter)
+	v.enqueue(aac)
+	at.Equal(v.queue.len(), congestedQueueNum+1)
+	v.enqueue(key)
+	v.enqueue(inter)
+	at.Equal(v.Drops(), DropStats{Disposable: 1, Video: uint64(videos + 2), GOPSkips: 1})
+	at.Equal(v.queue.len(), congestedQueueNum+3)
+	p, _ := v.queue.pop()
+	at.Equal(p, seq)
+
+	// a second skip drops the frames of the new gop
+	for v.queue.len() < maxQueueNum {
+		v.enqueue(aac)
+	}
+	v.enqueue(aac)
+	at.Equal(v.queue.len(), maxQueueNum-1)
+	drops := v.Drops()
+	at.Equal(drops.Video, uint64(videos+4))
+	at.Equal(drops.Audio, uint64(0))
+	at.Equal(drops.GOPSkips, uint64(2))
+
+	// the oldest audio makes room once nothing else is left
+	v.enqueue(seq)
+	v.enqueue(aac)
+	v.enqueue(aac)
+	at.Equal(v.queue.len(), maxQueueNum)
+	drops = v.Drops()
+	at.Equal(drops.Audio, uint64(2))
+	at.Equal(drops.GOPSkips, uint64(2))
+}
@@ -0,0 +1,18 @@
+package thumbnail
+
+import (
+	"context"
+	"image"
+)
+
+// Decoder turns an exported keyframe into an image, implementations can wrap a native
+// decoder or hand the snippet off to a remote service.
+type Decoder interface {
+	Decode(ctx context.Context, kf Keyframe) (image.Image, error)
+}
+
+type DecoderFunc func(ctx context.Context, kf Keyframe) (image.Image, error)
+
+func (f DecoderFunc) Decode(ctx context.Context, kf Keyframe) (image.Image, error) {
+	return f(ctx, kf)
+}
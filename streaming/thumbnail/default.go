@@ -0,0 +1,47 @@
+package thumbnail
+
+import (
+	"image"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+type Config struct {
+	// Interval is the minimum time between two exported keyframes.
+	Interval      time.Duration
+	DecodeTimeout time.Duration
+	Logger        logrus.FieldLogger
+	// Decoder is optional, when nil only OnKeyframe is called.
+	Decoder     Decoder
+	OnKeyframe  func(kf Keyframe)
+	OnThumbnail func(kf Keyframe, img image.Image)
+}
+
+func (c Config) fill() Config {
+	if c.Interval <= 0 {
+		c.Interval = DefaultConfig.Interval
+	}
+	if c.DecodeTimeout <= 0 {
+		c.DecodeTimeout = DefaultConfig.DecodeTimeout
+	}
+	if c.Logger == nil {
+		c.Logger = DefaultConfig.Logger
+	}
+	if c.OnKeyframe == nil {
+		c.OnKeyframe = DefaultConfig.OnKeyframe
+	}
+	if c.OnThumbnail == nil {
+		c.OnThumbnail = DefaultConfig.OnThumbnail
+	}
+
+	return c
+}
+
+var DefaultConfig = Config{
+	Interval:      time.Second * 10,
+	DecodeTimeout: time.Second * 5,
+	Logger:        logrus.StandardLogger(),
+	OnKeyframe:    func(kf Keyframe) {},
+	OnThumbnail:   func(kf Keyframe, img image.Image) {},
+}
@@ -0,0 +1,181 @@
+package thumbnail
+
+import (
+	"bytes"
+	"context"
+	"sync"
+	"time"
+
+	"github.com/viderstv/common/errors"
+	"github.com/viderstv/common/streaming/av"
+	"github.com/viderstv/common/streaming/container/flv"
+	"github.com/viderstv/common/streaming/container/ts"
+	"github.com/viderstv/common/streaming/parser/h264"
+)
+
+// Keyframe is a standalone IDR access unit which can be decoded without any other frames.
+type Keyframe struct {
+	Info      av.Info
+	Timestamp uint32
+	Width     int
+	Height    int
+	// AnnexB contains the AUD, SPS, PPS and the IDR slices with start codes.
+	AnnexB []byte
+	// TS contains the same access unit muxed into a single MPEG-TS segment.
+	TS []byte
+}
+
+// Tap is a writer which can be attached to a stream like any other viewer
+// and periodically exports the latest keyframe.
+type Tap struct {
+	av.RWBaser
+
+	info   av.Info
+	config Config
+
+	demuxer *flv.Demuxer
+	parser  *h264.Parser
+	last    time.Time
+
+	frames chan Keyframe
+
+	once   sync.Once
+	closed chan struct{}
+}
+
+func New(info av.Info, config Config) *Tap {
+	t := &Tap{
+		RWBaser: av.NewRWBaser(time.Second * 10),
+		info:    info,
+		config:  config.fill(),
+		demuxer: flv.NewDemuxer(),
+		parser:  h264.NewParser(),
+		frames:  make(chan Keyframe, 1),
+		closed:  make(chan struct{}),
+	}
+
+	go t.export()
+
+	return t
+}
+
+func (t *Tap) Write(p *av.Packet) error {
+	select {
+	case <-t.closed:
+		return errors.ErrSourceClosed
+	default:
+	}
+
+	t.SetPreTime()
+
+	if !p.IsVideo {
+		return nil
+	}
+
+	pkt := *p
+	if err := t.demuxer.Demux(&pkt); err != nil {
+		if err == flv.ErrAvcEndSEQ {
+			return nil
+		}
+		return err
+	}
+
+	vh, ok := pkt.Header.(av.VideoPacketHeader)
+	if !ok || vh.CodecID() != av.VIDEO_H264 || !vh.IsKeyFrame() {
+		return nil
+	}
+
+	if vh.IsSeq() {
+		if err := t.parser.Parse(pkt.Data, true, nil); err != nil {
+			t.config.Logger.Warn("thumbnail sequence header: ", err)
+		}
+		return nil
+	}
+
+	if !t.last.IsZero() && time.Since(t.last) < t.config.Interval {
+		return nil
+	}
+
+	sps, err := t.parser.SPS()
+	if err != nil {
+		// we have not seen a sequence header yet.
+		return nil
+	}
+
+	annexB := bytes.NewBuffer(nil)
+	if err := t.parser.Parse(pkt.Data, false, annexB); err != nil {
+		t.config.Logger.Warn("thumbnail keyframe: ", err)
+		return nil
+	}
+
+	muxer := ts.NewMuxer()
+	tsBuf := bytes.NewBuffer(nil)
+	tsBuf.Write(muxer.PAT())
+	tsBuf.Write(muxer.PMT(av.SOUND_AAC, true))
+	if err := muxer.Mux(&av.Packet{
+		IsVideo:   true,
+		TimeStamp: pkt.TimeStamp,
+		Header:    vh,
+		Data:      annexB.Bytes(),
+	}, tsBuf); err != nil {
+		t.config.Logger.Warn("thumbnail mux: ", err)
+		return nil
+	}
+
+	t.last = time.Now()
+
+	select {
+	case t.frames <- Keyframe{
+		Info:      t.info,
+		Timestamp: pkt.TimeStamp,
+		Width:     sps.Width,
+		Height:    sps.Height,
+		AnnexB:    annexB.Bytes(),
+		TS:        tsBuf.Bytes(),
+	}:
+	default:
+		// the previous keyframe is still being decoded.
+	}
+
+	return nil
+}
+
+func (t *Tap) export() {
+	for {
+		select {
+		case <-t.closed:
+			return
+		case kf := <-t.frames:
+			t.config.OnKeyframe(kf)
+			if t.config.Decoder == nil {
+				continue
+			}
+
+			ctx, cancel := context.WithTimeout(context.Background(), t.config.DecodeTimeout)
+			img, err := t.config.Decoder.Decode(ctx, kf)
+			cancel()
+			if err != nil {
+				t.config.Logger.Warn("thumbnail decode: ", err)
+				continue
+			}
+
+			t.config.OnThumbnail(kf, img)
+		}
+	}
+}
+
+func (t *Tap) Info() av.Info {
+	return t.info
+}
+
+func (t *Tap) Running() <-chan struct{} {
+	return t.closed
+}
+
+func (t *Tap) Close() error {
+	t.once.Do(func() {
+		close(t.closed)
+	})
+
+	return nil
+}
@@ -0,0 +1,144 @@
+package thumbnail
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"image"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/viderstv/common/errors"
+	"github.com/viderstv/common/streaming/av"
+)
+
+var (
+	// seqHeader is the avc decoder configuration of a 720x576 main profile stream.
+	seqHeader = []byte{
+		0x17, 0x00, 0x00, 0x00, 0x00,
+		0x01, 0x4d, 0x00, 0x1e, 0xff, 0xe1, 0x00, 0x17, 0x67, 0x4d, 0x00,
+		0x1e, 0xab, 0x40, 0x5a, 0x12, 0x6c, 0x09, 0x28, 0x28, 0x28, 0x2f,
+		0x80, 0x00, 0x01, 0xf4, 0x00, 0x00, 0x61, 0xa8, 0x4a, 0x01, 0x00,
+		0x04, 0x68, 0xde, 0x31, 0x12,
+	}
+	idr   = []byte{0x17, 0x01, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x04, 0x65, 0x88, 0x84, 0x00}
+	slice = []byte{0x27, 0x01, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x04, 0x41, 0x9a, 0x02, 0x00}
+)
+
+func video(ts uint32, data []byte) *av.Packet {
+	return &av.Packet{IsVideo: true, TimeStamp: ts, Data: append([]byte(nil), data...)}
+}
+
+func next(t *testing.T, keyframes chan Keyframe) Keyframe {
+	select {
+	case kf := <-keyframes:
+		return kf
+	case <-time.After(time.Second):
+		t.Fatal("no keyframe exported")
+	}
+	return Keyframe{}
+}
+
+func TestTap(t *testing.T) {
+	at := assert.New(t)
+
+	keyframes := make(chan Keyframe, 4)
+	tap := New(av.Info{Key: "key"}, Config{
+		Interval:   time.Hour,
+		OnKeyframe: func(kf Keyframe) { keyframes <- kf },
+	})
+	defer tap.Close()
+
+	// keyframes are only exported once the sequence header was seen
+	at.NoError(tap.Write(video(0, idr)))
+	at.NoError(tap.Write(&av.Packet{IsAudio: true, Data: []byte{0xaf, 0x01, 0x21}}))
+	at.NoError(tap.Write(video(0, seqHeader)))
+	at.NoError(tap.Write(video(40, slice)))
+	at.NoError(tap.Write(video(80, idr)))
+
+	kf := next(t, keyframes)
+	at.Equal(kf.Info.Key, "key")
+	at.Equal(kf.Timestamp, uint32(80))
+	at.Equal(kf.Width, 720)
+	at.Equal(kf.Height, 576)
+	// the access unit starts with an aud, the sps and pps come before the idr slice
+	at.True(bytes.HasPrefix(kf.AnnexB, []byte{0x00, 0x00, 0x00, 0x01, 0x09}))
+	at.True(bytes.Index(kf.AnnexB, []byte{0x67, 0x4d}) < bytes.Index(kf.AnnexB, []byte{0x65, 0x88}))
+	at.True(len(kf.TS) > 0 && len(kf.TS)%188 == 0)
+	at.Equal(kf.TS[0], byte(0x47))
+
+	// the next keyframe is within the interval
+	at.NoError(tap.Write(video(120, idr)))
+	time.Sleep(20 * time.Millisecond)
+	at.Len(keyframes, 0)
+
+	at.NoError(tap.Close())
+	at.Equal(tap.Write(video(160, idr)), errors.ErrSourceClosed)
+}
+
+func TestTapInterval(t *testing.T) {
+	at := assert.New(t)
+
+	keyframes := make(chan Keyframe, 4)
+	tap := New(av.Info{}, Config{
+		Interval:   20 * time.Millisecond,
+		OnKeyframe: func(kf Keyframe) { keyframes <- kf },
+	})
+	defer tap.Close()
+
+	at.NoError(tap.Write(video(0, seqHeader)))
+	at.NoError(tap.Write(video(0, idr)))
+	at.Equal(next(t, keyframes).Timestamp, uint32(0))
+
+	time.Sleep(30 * time.Millisecond)
+	at.NoError(tap.Write(video(40, idr)))
+	at.Equal(next(t, keyframes).Timestamp, uint32(40))
+}
+
+func TestTapDecoder(t *testing.T) {
+	at := assert.New(t)
+
+	decoded := make(chan error, 2)
+	thumbnails := make(chan image.Image, 2)
+	img := image.NewRGBA(image.Rect(0, 0, 720, 576))
+	tap := New(av.Info{}, Config{
+		Interval: time.Nanosecond,
+		Decoder: DecoderFunc(func(ctx context.Context, kf Keyframe) (image.Image, error) {
+			var err error
+			if kf.Timestamp == 0 {
+				err = fmt.Errorf("decode failed")
+			}
+			decoded <- err
+			return img, err
+		}),
+		OnThumbnail: func(kf Keyframe, img image.Image) { thumbnails <- img },
+	})
+	defer tap.Close()
+
+	wait := func() error {
+		select {
+		case err := <-decoded:
+			return err
+		case <-time.After(time.Second):
+			t.Fatal("keyframe not decoded")
+		}
+		return nil
+	}
+
+	at.NoError(tap.Write(video(0, seqHeader)))
+	at.NoError(tap.Write(video(0, idr)))
+	// a failed decode has no thumbnail
+	at.Error(wait())
+
+	time.Sleep(time.Millisecond)
+	at.NoError(tap.Write(video(40, idr)))
+	at.NoError(wait())
+	select {
+	case thumbnail := <-thumbnails:
+		at.Equal(thumbnail, img)
+	case <-time.After(time.Second):
+		t.Fatal("no thumbnail")
+	}
+	at.Len(thumbnails, 0)
+}
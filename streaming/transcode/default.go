@@ -0,0 +1,61 @@
+package transcode
+
+import (
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+type Config struct {
+	// Queue receives the jobs, the retry queue is Queue+".retry" and the dead letter queue Queue+".dlq".
+	Queue string
+	// StatusQueue receives the status updates of the jobs, each update is consumed once, see Queue.Statuses.
+	StatusQueue string
+	// JwtSecret signs and verifies the JwtTranscodePayload of the jobs, it is required.
+	JwtSecret string
+	// TokenTTL is the expiry of the tokens without one, it has to cover the retries.
+	TokenTTL time.Duration
+	// Prefetch is the number of jobs a consumer works on at once.
+	Prefetch int
+	// MaxRetries is how often a failed job is retried before it is dead lettered.
+	MaxRetries int
+	// RetryDelay is the time a failed job waits in the retry queue.
+	RetryDelay time.Duration
+	Logger     logrus.FieldLogger
+}
+
+func (c Config) fill() Config {
+	if c.Queue == "" {
+		c.Queue = DefaultConfig.Queue
+	}
+	if c.StatusQueue == "" {
+		c.StatusQueue = DefaultConfig.StatusQueue
+	}
+	if c.TokenTTL <= 0 {
+		c.TokenTTL = DefaultConfig.TokenTTL
+	}
+	if c.Prefetch <= 0 {
+		c.Prefetch = DefaultConfig.Prefetch
+	}
+	if c.MaxRetries < 0 {
+		c.MaxRetries = DefaultConfig.MaxRetries
+	}
+	if c.RetryDelay <= 0 {
+		c.RetryDelay = DefaultConfig.RetryDelay
+	}
+	if c.Logger == nil {
+		c.Logger = DefaultConfig.Logger
+	}
+
+	return c
+}
+
+var DefaultConfig = Config{
+	Queue:       "transcode-jobs",
+	StatusQueue: "transcode-status",
+	TokenTTL:    time.Hour,
+	Prefetch:    1,
+	MaxRetries:  3,
+	RetryDelay:  time.Second * 5,
+	Logger:      logrus.StandardLogger(),
+}
@@ -0,0 +1,330 @@
+package transcode
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/streadway/amqp"
+	"github.com/viderstv/common/instance"
+	"github.com/viderstv/common/structures"
+	"github.com/viderstv/common/utils/uid"
+)
+
+var ErrNoSecret = fmt.Errorf("transcode: no jwt secret configured")
+
+// Job is a delivered job with its verified payload.
+type Job struct {
+	structures.TranscodeJob
+	Payload structures.JwtTranscodePayload
+}
+
+// Handler works on a job, a returned error retries it until MaxRetries. Handlers run concurrently up to Prefetch.
+type Handler func(ctx context.Context, job Job) error
+
+// channel is the part of amqp.Channel used by the queue.
+type channel interface {
+	QueueDeclare(name string, durable, autoDelete, exclusive, noWait bool, args amqp.Table) (amqp.Queue, error)
+	Qos(prefetchCount, prefetchSize int, global bool) error
+	Publish(exchange, key string, mandatory, immediate bool, msg amqp.Publishing) error
+	Consume(queue, consumer string, autoAck, exclusive, noLocal, noWait bool, args amqp.Table) (<-chan amqp.Delivery, error)
+	Cancel(consumer string, noWait bool) error
+	Close() error
+}
+
+// Queue publishes transcode jobs and consumes them with manual acks. Failed jobs wait in the retry queue for
+// RetryDelay and go back to the job queue, jobs which failed MaxRetries times or cannot be decoded are dead lettered.
+type Queue struct {
+	ch channel
+	// open opens the channel of a consumer, its prefetch must not change the other consumers of ch.
+	open   func() (channel, error)
+	config Config
+}
+
+// New declares the queues on the channel of rmq, ingest and transcoder services have to use the same config.
+// Jobs and status updates are published on that channel, every consumer opens its own. It returns
+// ErrNoSecret without a JwtSecret.
+func New(rmq instance.RabbitMQ, config Config) (*Queue, error) {
+	return newQueue(rmq.RawChannel(), func() (channel, error) {
+		return rmq.RawClient().Channel()
+	}, config)
+}
+
+func newQueue(ch channel, open func() (channel, error), config Config) (*Queue, error) {
+	if config.JwtSecret == "" {
+		return nil, ErrNoSecret
+	}
+	q := &Queue{
+		ch:     ch,
+		open:   open,
+		config: config.fill(),
+	}
+	if err := q.declare(); err != nil {
+		return nil, err
+	}
+	return q, nil
+}
+
+func (q *Queue) retryQueue() string {
+	return q.config.Queue + ".retry"
+}
+
+func (q *Queue) deadLetterQueue() string {
+	return q.config.Queue + ".dlq"
+}
+
+func (q *Queue) declare() error {
+	queues := []struct {
+		name string
+		args amqp.Table
+	}{
+		{q.deadLetterQueue(), nil},
+		// rejected jobs are routed to the dead letter queue by the default exchange.
+		{q.config.Queue, amqp.Table{
+			"x-dead-letter-exchange":    "",
+			"x-dead-letter-routing-key": q.deadLetterQueue(),
+		}},
+		// retried jobs expire back into the job queue.
+		{q.retryQueue(), amqp.Table{
+			"x-dead-letter-exchange":    "",
+			"x-dead-letter-routing-key": q.config.Queue,
+			"x-message-ttl":             q.config.RetryDelay.Milliseconds(),
+		}},
+		{q.config.StatusQueue, nil},
+	}
+	for _, v := range queues {
+		if _, err := q.ch.QueueDeclare(v.name, true, false, false, false, v.args); err != nil {
+			return fmt.Errorf("declare queue %s: %w", v.name, err)
+		}
+	}
+	return nil
+}
+
+// Publish signs the payload with its variants and queues a job for it.
+func (q *Queue) Publish(ctx context.Context, payload structures.JwtTranscodePayload) (structures.TranscodeJob, error) {
+	now := time.Now()
+	if payload.ExpiresAt == 0 {
+		payload.ExpiresAt = now.Add(q.config.TokenTTL).Unix()
+	}
+	if payload.IssuedAt == 0 {
+		payload.IssuedAt = now.Unix()
+	}
+
+	token, err := structures.EncodeJwt(payload, q.config.JwtSecret)
+	if err != nil {
+		return structures.TranscodeJob{}, err
+	}
+
+	job := structures.TranscodeJob{
+		ID:        uid.NewId(),
+		Token:     token,
+		CreatedAt: now,
+	}
+	if err := q.publish(ctx, q.config.Queue, job); err != nil {
+		return structures.TranscodeJob{}, err
+	}
+
+	q.status(ctx, job, payload, structures.TranscodeJobStateQueued, nil)
+	return job, nil
+}
+
+func (q *Queue) publish(ctx context.Context, queue string, job structures.TranscodeJob) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	data, err := json.Marshal(job)
+	if err != nil {
+		return err
+	}
+
+	return q.ch.Publish("", queue, false, false, amqp.Publishing{
+		ContentType:  "application/json",
+		DeliveryMode: amqp.Persistent,
+		MessageId:    job.ID,
+		Timestamp:    time.Now(),
+		Body:         data,
+	})
+}
+
+func (q *Queue) status(ctx context.Context, job structures.TranscodeJob, payload structures.JwtTranscodePayload, state structures.TranscodeJobState, err error) {
+	status := structures.TranscodeJobStatus{
+		JobID:     job.ID,
+		StreamID:  payload.StreamID,
+		State:     state,
+		Attempt:   job.Attempt,
+		Timestamp: time.Now(),
+	}
+	if err != nil {
+		status.Error = err.Error()
+	}
+
+	data, err := json.Marshal(status)
+	if err == nil {
+		err = q.ch.Publish("", q.config.StatusQueue, false, false, amqp.Publishing{
+			ContentType:  "application/json",
+			DeliveryMode: amqp.Persistent,
+			MessageId:    job.ID,
+			Type:         state.String(),
+			Timestamp:    status.Timestamp,
+			Body:         data,
+		})
+	}
+	if err != nil {
+		q.config.Logger.Error("failed to publish transcode job status: ", err)
+	}
+}
+
+// Consume delivers the jobs to the handler on a channel of its own until ctx is done or the channel closes,
+// it waits for the running handlers before returning.
+func (q *Queue) Consume(ctx context.Context, handler Handler) error {
+	ch, err := q.open()
+	if err != nil {
+		return err
+	}
+	defer ch.Close()
+
+	if err := ch.Qos(q.config.Prefetch, 0, false); err != nil {
+		return err
+	}
+
+	tag := "transcode-" + uid.NewId()
+	deliveries, err := ch.Consume(q.config.Queue, tag, false, false, false, false, nil)
+	if err != nil {
+		return err
+	}
+
+	wg := sync.WaitGroup{}
+	defer wg.Wait()
+	// a cancel keeps the prefetched jobs unacked, they are requeued for the other consumers.
+	defer func() {
+		if err := ch.Cancel(tag, false); err != nil {
+			return
+		}
+		for d := range deliveries {
+			_ = d.Nack(false, true)
+		}
+	}()
+
+	sem := make(chan struct{}, q.config.Prefetch)
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case d, ok := <-deliveries:
+			if !ok {
+				return amqp.ErrClosed
+			}
+
+			select {
+			case sem <- struct{}{}:
+			case <-ctx.Done():
+				_ = d.Nack(false, true)
+				return ctx.Err()
+			}
+			wg.Add(1)
+			go func() {
+				defer func() {
+					<-sem
+					wg.Done()
+				}()
+				q.handle(ctx, d, handler)
+			}()
+		}
+	}
+}
+
+func (q *Queue) handle(ctx context.Context, d amqp.Delivery, handler Handler) {
+	var job Job
+	if err := json.Unmarshal(d.Body, &job.TranscodeJob); err != nil {
+		q.config.Logger.Error("dead lettering malformed transcode job: ", err)
+		_ = d.Reject(false)
+		return
+	}
+
+	if err := structures.DecodeJwt(&job.Payload, q.config.JwtSecret, job.Token); err != nil {
+		q.config.Logger.Errorf("dead lettering transcode job %s: %s", job.ID, err)
+		q.status(ctx, job.TranscodeJob, job.Payload, structures.TranscodeJobStateFailed, err)
+		_ = d.Reject(false)
+		return
+	}
+
+	q.status(ctx, job.TranscodeJob, job.Payload, structures.TranscodeJobStateStarted, nil)
+
+	err := q.run(ctx, job, handler)
+	if err == nil {
+		q.status(ctx, job.TranscodeJob, job.Payload, structures.TranscodeJobStateCompleted, nil)
+		_ = d.Ack(false)
+		return
+	}
+
+	if ctx.Err() != nil {
+		// stopped consuming, the job is handed to another consumer without counting an attempt.
+		_ = d.Nack(false, true)
+		return
+	}
+
+	if job.Attempt < q.config.MaxRetries {
+		retry := job.TranscodeJob
+		retry.Attempt++
+		// the job is acked only once its retry is queued, otherwise it is delivered again.
+		if perr := q.publish(context.Background(), q.retryQueue(), retry); perr != nil {
+			q.config.Logger.Error("failed to queue transcode job retry: ", perr)
+			_ = d.Nack(false, true)
+			return
+		}
+		q.status(ctx, job.TranscodeJob, job.Payload, structures.TranscodeJobStateRetrying, err)
+		_ = d.Ack(false)
+		return
+	}
+
+	q.config.Logger.Errorf("dead lettering transcode job %s after %d attempts: %s", job.ID, job.Attempt+1, err)
+	q.status(ctx, job.TranscodeJob, job.Payload, structures.TranscodeJobStateFailed, err)
+	_ = d.Reject(false)
+}
+
+func (q *Queue) run(ctx context.Context, job Job, handler Handler) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("panic: %v", r)
+		}
+	}()
+	return handler(ctx, job)
+}
+
+// Statuses delivers the status updates to fn until ctx is done or the channel closes. The consumers of the
+// durable StatusQueue compete, every update goes to one of them, so it suits a single service recording the
+// states, replicas of it share the updates. Services which all need every update have to use queues of
+// their own.
+func (q *Queue) Statuses(ctx context.Context, fn func(status structures.TranscodeJobStatus)) error {
+	ch, err := q.open()
+	if err != nil {
+		return err
+	}
+	defer ch.Close()
+
+	deliveries, err := ch.Consume(q.config.StatusQueue, "", true, false, false, false, nil)
+	if err != nil {
+		return err
+	}
+
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case d, ok := <-deliveries:
+			if !ok {
+				return amqp.ErrClosed
+			}
+
+			var status structures.TranscodeJobStatus
+			if err := json.Unmarshal(d.Body, &status); err != nil {
+				q.config.Logger.Error("failed to decode transcode job status: ", err)
+				continue
+			}
+			fn(status)
+		}
+	}
+}
@@ -0,0 +1,322 @@
+package transcode
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/streadway/amqp"
+	"github.com/stretchr/testify/assert"
+	"github.com/viderstv/common/structures"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// testChannel routes published messages to consumers by queue name and dead letters rejected ones like the broker.
+type testChannel struct {
+	mtx       sync.Mutex
+	args      map[string]amqp.Table
+	messages  map[string][]amqp.Publishing
+	consumers map[string]chan amqp.Delivery
+	tags      map[string]string
+	acks      []string
+	prefetch  int
+	tag       uint64
+	opened    int
+}
+
+func newTestChannel() *testChannel {
+	return &testChannel{
+		args:      map[string]amqp.Table{},
+		messages:  map[string][]amqp.Publishing{},
+		consumers: map[string]chan amqp.Delivery{},
+		tags:      map[string]string{},
+	}
+}
+
+func (c *testChannel) QueueDeclare(name string, durable, autoDelete, exclusive, noWait bool, args amqp.Table) (amqp.Queue, error) {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+	c.args[name] = args
+	return amqp.Queue{Name: name}, nil
+}
+
+func (c *testChannel) Qos(prefetchCount, prefetchSize int, global bool) error {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+	c.prefetch = prefetchCount
+	return nil
+}
+
+func (c *testChannel) Publish(exchange, key string, mandatory, immediate bool, msg amqp.Publishing) error {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+	c.messages[key] = append(c.messages[key], msg)
+	if ch, ok := c.consumers[key]; ok {
+		c.tag++
+		ch <- amqp.Delivery{Acknowledger: &testAcker{c: c, queue: key, msg: msg}, DeliveryTag: c.tag, Body: msg.Body}
+	}
+	return nil
+}
+
+func (c *testChannel) Consume(queue, consumer string, autoAck, exclusive, noLocal, noWait bool, args amqp.Table) (<-chan amqp.Delivery, error) {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+	ch := make(chan amqp.Delivery, 16)
+	c.consumers[queue] = ch
+	c.tags[consumer] = queue
+	for _, msg := range c.messages[queue] {
+		c.tag++
+		ch <- amqp.Delivery{Acknowledger: &testAcker{c: c, queue: queue, msg: msg}, DeliveryTag: c.tag, Body: msg.Body}
+	}
+	return ch, nil
+}
+
+func (c *testChannel) Cancel(consumer string, noWait bool) error {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+	queue := c.tags[consumer]
+	if ch, ok := c.consumers[queue]; ok {
+		close(ch)
+		delete(c.consumers, queue)
+	}
+	return nil
+}
+
+func (c *testChannel) Close() error {
+	return nil
+}
+
+func (c *testChannel) published(queue string) []amqp.Publishing {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+	return append([]amqp.Publishing(nil), c.messages[queue]...)
+}
+
+func (c *testChannel) acked() []string {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+	return append([]string(nil), c.acks...)
+}
+
+type testAcker struct {
+	c     *testChannel
+	queue string
+	msg   amqp.Publishing
+}
+
+func (a *testAcker) Ack(tag uint64, multiple bool) error {
+	a.c.mtx.Lock()
+	a.c.acks = append(a.c.acks, "ack")
+	a.c.mtx.Unlock()
+	return nil
+}
+
+func (a *testAcker) Nack(tag uint64, multiple bool, requeue bool) error {
+	a.c.mtx.Lock()
+	if requeue {
+		a.c.acks = append(a.c.acks, "requeue")
+	} else {
+		a.c.acks = append(a.c.acks, "nack")
+	}
+	a.c.mtx.Unlock()
+	if !requeue {
+		_ = a.c.Publish("", a.c.args[a.queue]["x-dead-letter-routing-key"].(string), false, false, a.msg)
+	}
+	return nil
+}
+
+func (a *testAcker) Reject(tag uint64, requeue bool) error {
+	return a.Nack(tag, false, requeue)
+}
+
+func newTestQueue(t *testing.T, config Config) (*Queue, *testChannel) {
+	ch := newTestChannel()
+	config.JwtSecret = "secret"
+	q, err := newQueue(ch, func() (channel, error) {
+		ch.mtx.Lock()
+		ch.opened++
+		ch.mtx.Unlock()
+		return ch, nil
+	}, config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return q, ch
+}
+
+// consume runs the queue until the job of the test reached a final state.
+func consume(t *testing.T, q *Queue, handler Handler) []structures.TranscodeJobState {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+
+	done := make(chan struct{})
+	var states []structures.TranscodeJobState
+	go func() {
+		_ = q.Statuses(ctx, func(status structures.TranscodeJobStatus) {
+			states = append(states, status.State)
+			if status.State == structures.TranscodeJobStateCompleted || status.State == structures.TranscodeJobStateFailed {
+				close(done)
+			}
+		})
+	}()
+	go func() {
+		_ = q.Consume(ctx, handler)
+	}()
+
+	select {
+	case <-done:
+	case <-ctx.Done():
+		t.Fatal("job not finished")
+	}
+	return states
+}
+
+func TestQueueDeclare(t *testing.T) {
+	at := assert.New(t)
+
+	_, ch := newTestQueue(t, Config{RetryDelay: time.Second})
+	at.Equal(ch.args["transcode-jobs"]["x-dead-letter-routing-key"], "transcode-jobs.dlq")
+	at.Equal(ch.args["transcode-jobs.retry"]["x-dead-letter-routing-key"], "transcode-jobs")
+	at.Equal(ch.args["transcode-jobs.retry"]["x-message-ttl"], int64(1000))
+	_, ok := ch.args["transcode-status"]
+	at.True(ok)
+}
+
+func TestQueueNoSecret(t *testing.T) {
+	at := assert.New(t)
+
+	ch := newTestChannel()
+	_, err := newQueue(ch, func() (channel, error) { return ch, nil }, Config{})
+	at.Equal(err, ErrNoSecret)
+	// nothing is declared without a secret
+	at.Empty(ch.args)
+}
+
+func TestQueueCompleted(t *testing.T) {
+	at := assert.New(t)
+
+	q, ch := newTestQueue(t, Config{Prefetch: 2})
+	streamID := primitive.NewObjectID()
+	job, err := q.Publish(context.Background(), structures.JwtTranscodePayload{
+		StreamID:    streamID,
+		IngestPodIP: "10.0.0.1",
+		Variants:    []structures.JwtMuxerPayloadVariant{{Name: "720p"}},
+	})
+	at.NoError(err)
+
+	var got Job
+	states := consume(t, q, func(ctx context.Context, job Job) error {
+		got = job
+		return nil
+	})
+
+	at.Equal(states, []structures.TranscodeJobState{
+		structures.TranscodeJobStateQueued,
+		structures.TranscodeJobStateStarted,
+		structures.TranscodeJobStateCompleted,
+	})
+	at.Equal(got.ID, job.ID)
+	at.Equal(got.Payload.StreamID, streamID)
+	at.Equal(got.Payload.IngestPodIP, "10.0.0.1")
+	at.Equal(got.Payload.Variants[0].Name, "720p")
+	at.Equal(ch.prefetch, 2)
+	// the consumers use channels of their own
+	at.Equal(ch.opened, 2)
+	at.Equal(ch.acked(), []string{"ack"})
+	at.Equal(ch.published("transcode-jobs")[0].DeliveryMode, amqp.Persistent)
+}
+
+func TestQueueRetries(t *testing.T) {
+	at := assert.New(t)
+
+	q, ch := newTestQueue(t, Config{MaxRetries: 1})
+	_, err := q.Publish(context.Background(), structures.JwtTranscodePayload{StreamID: primitive.NewObjectID()})
+	at.NoError(err)
+
+	// the test channel has no ttl, the retried job is handed back once the first attempt is acked.
+	go func() {
+		for len(ch.acked()) == 0 {
+			time.Sleep(time.Millisecond)
+		}
+		at.NoError(q.ch.Publish("", "transcode-jobs", false, false, ch.published("transcode-jobs.retry")[0]))
+	}()
+
+	var attempts []int
+	states := consume(t, q, func(ctx context.Context, job Job) error {
+		attempts = append(attempts, job.Attempt)
+		if job.Attempt == 0 {
+			return errors.New("failed")
+		}
+		panic("failed again")
+	})
+
+	at.Equal(attempts, []int{0, 1})
+	at.Equal(states, []structures.TranscodeJobState{
+		structures.TranscodeJobStateQueued,
+		structures.TranscodeJobStateStarted,
+		structures.TranscodeJobStateRetrying,
+		structures.TranscodeJobStateStarted,
+		structures.TranscodeJobStateFailed,
+	})
+	at.Equal(ch.acked(), []string{"ack", "nack"})
+	at.Len(ch.published("transcode-jobs.dlq"), 1)
+}
+
+func TestQueueInvalidToken(t *testing.T) {
+	at := assert.New(t)
+
+	q, ch := newTestQueue(t, Config{})
+	job, err := q.Publish(context.Background(), structures.JwtTranscodePayload{StreamID: primitive.NewObjectID()})
+	at.NoError(err)
+
+	// a job signed with another secret is never handled
+	q.config.JwtSecret = "other"
+	handled := false
+	states := consume(t, q, func(ctx context.Context, job Job) error {
+		handled = true
+		return nil
+	})
+
+	at.False(handled)
+	at.Equal(states, []structures.TranscodeJobState{structures.TranscodeJobStateQueued, structures.TranscodeJobStateFailed})
+	at.Equal(ch.acked(), []string{"nack"})
+	if dlq := ch.published("transcode-jobs.dlq"); at.Len(dlq, 1) {
+		at.Equal(dlq[0].MessageId, job.ID)
+	}
+}
+
+func TestQueueStop(t *testing.T) {
+	at := assert.New(t)
+
+	q, ch := newTestQueue(t, Config{})
+	for i := 0; i < 2; i++ {
+		_, err := q.Publish(context.Background(), structures.JwtTranscodePayload{StreamID: primitive.NewObjectID()})
+		at.NoError(err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	started := make(chan struct{})
+	done := make(chan error)
+	go func() {
+		done <- q.Consume(ctx, func(ctx context.Context, job Job) error {
+			close(started)
+			<-ctx.Done()
+			return ctx.Err()
+		})
+	}()
+
+	<-started
+	cancel()
+	select {
+	case err := <-done:
+		at.Equal(err, context.Canceled)
+	case <-time.After(time.Second):
+		t.Fatal("consume not stopped")
+	}
+
+	// the running and the prefetched job are requeued without counting an attempt
+	at.Equal(ch.acked(), []string{"requeue", "requeue"})
+	at.Empty(ch.published("transcode-jobs.retry"))
+}
@@ -13,6 +13,8 @@ type JwtTranscodePayload struct {
 	Revision        int32              `json:"revision"`
 	TranscodeStream bool               `json:"transcode_stream"`
 	IngestPodIP     string             `json:"ingest_pod_ip"`
+	// Variants is the ladder to transcode into, it is signed with the rest of the payload.
+	Variants []JwtMuxerPayloadVariant `json:"variants,omitempty"`
 	jwt.StandardClaims
 }
 
@@ -36,6 +38,8 @@ type JwtMuxerPayloadVariant struct {
 
 type JwtInternalRead struct {
 	StreamID primitive.ObjectID `json:"stream_id"`
+	// UserID is the owner of the stream, ingest keys the streams of publishers by it.
+	UserID primitive.ObjectID `json:"user_id"`
 	jwt.StandardClaims
 }
 
@@ -43,6 +47,7 @@ type JwtWatchStream struct {
 	ChannelID primitive.ObjectID `json:"channel_id"`
 	StreamID  primitive.ObjectID `json:"stream_id"`
 	UserID    primitive.ObjectID `json:"user_id"`
+	ViewerIP  string             `json:"viewer_ip,omitempty"`
 	jwt.StandardClaims
 }
 
@@ -3,10 +3,17 @@ package structures
 type RedisRtmpEvent struct {
 	Type RedisRtmpEventType `json:"type"`
 	Key  string             `json:"key"`
+	// Mute is used by RedisRtmpEventTypeMuteAudio, false unmutes.
+	Mute bool `json:"mute,omitempty"`
+	// Title is used by RedisRtmpEventTypeUpdateTitle.
+	Title string `json:"title,omitempty"`
 }
 
 type RedisRtmpEventType int32
 
 const (
 	RedisRtmpEventTypeKill RedisRtmpEventType = iota
+	RedisRtmpEventTypeMuteAudio
+	RedisRtmpEventTypeRequestKeyframe
+	RedisRtmpEventTypeUpdateTitle
 )
@@ -0,0 +1,62 @@
+package structures
+
+import "time"
+
+// StreamEvent is published when a stream changes, downstream services react to it instead of polling Mongo.
+type StreamEvent struct {
+	Type StreamEventType `json:"type"`
+	// Key is the key of the stream in the handler, Name is the user id of the stream after authentication.
+	Key  string `json:"key"`
+	App  string `json:"app"`
+	Name string `json:"name"`
+	// ConnID is the id of the publisher or viewer stream the event is about.
+	ConnID    string    `json:"conn_id,omitempty"`
+	Timestamp time.Time `json:"timestamp"`
+
+	Health  *StreamEventHealth  `json:"health,omitempty"`
+	Segment *StreamEventSegment `json:"segment,omitempty"`
+}
+
+type StreamEventType int32
+
+const (
+	StreamEventTypePublishStarted StreamEventType = iota
+	StreamEventTypePublishEnded
+	StreamEventTypeViewerJoined
+	StreamEventTypeViewerLeft
+	StreamEventTypeHealthWarning
+	StreamEventTypeSegmentProduced
+)
+
+func (t StreamEventType) String() string {
+	switch t {
+	case StreamEventTypePublishStarted:
+		return "publish_started"
+	case StreamEventTypePublishEnded:
+		return "publish_ended"
+	case StreamEventTypeViewerJoined:
+		return "viewer_joined"
+	case StreamEventTypeViewerLeft:
+		return "viewer_left"
+	case StreamEventTypeHealthWarning:
+		return "health_warning"
+	case StreamEventTypeSegmentProduced:
+		return "segment_produced"
+	}
+	return "unknown"
+}
+
+type StreamEventHealth struct {
+	Type    string  `json:"type"`
+	Message string  `json:"message"`
+	Value   float64 `json:"value"`
+	Limit   float64 `json:"limit"`
+}
+
+type StreamEventSegment struct {
+	SeqNum        int           `json:"seq_num"`
+	Name          string        `json:"name"`
+	Duration      time.Duration `json:"duration"`
+	Size          int           `json:"size"`
+	Discontinuity bool          `json:"discontinuity"`
+}
@@ -0,0 +1,53 @@
+package structures
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// TranscodeJob asks a transcoder to transcode a stream into the variants.
+type TranscodeJob struct {
+	ID string `json:"id"`
+	// Token is a signed JwtTranscodePayload with the variant ladder, the transcoder only trusts the job from it.
+	Token string `json:"token"`
+	// Attempt counts the retries of the job, it is 0 on the first delivery.
+	Attempt   int       `json:"attempt"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// TranscodeJobStatus is published whenever a job changes its state.
+type TranscodeJobStatus struct {
+	JobID     string             `json:"job_id"`
+	StreamID  primitive.ObjectID `json:"stream_id"`
+	State     TranscodeJobState  `json:"state"`
+	Attempt   int                `json:"attempt"`
+	Error     string             `json:"error,omitempty"`
+	Timestamp time.Time          `json:"timestamp"`
+}
+
+type TranscodeJobState int32
+
+const (
+	TranscodeJobStateQueued TranscodeJobState = iota
+	TranscodeJobStateStarted
+	TranscodeJobStateCompleted
+	TranscodeJobStateRetrying
+	TranscodeJobStateFailed
+)
+
+func (s TranscodeJobState) String() string {
+	switch s {
+	case TranscodeJobStateQueued:
+		return "queued"
+	case TranscodeJobStateStarted:
+		return "started"
+	case TranscodeJobStateCompleted:
+		return "completed"
+	case TranscodeJobStateRetrying:
+		return "retrying"
+	case TranscodeJobStateFailed:
+		return "failed"
+	}
+	return "unknown"
+}
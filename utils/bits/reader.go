@@ -0,0 +1,92 @@
+package bits
+
+import "fmt"
+
+var (
+	ErrOutOfData = fmt.Errorf("bit reader out of data")
+)
+
+// Reader reads big endian bit fields and exp-Golomb codes from a byte slice.
+type Reader struct {
+	buf []byte
+	pos int
+}
+
+func NewReader(buf []byte) *Reader {
+	return &Reader{buf: buf}
+}
+
+// Left returns the number of bits which have not been read yet.
+func (r *Reader) Left() int {
+	return len(r.buf)*8 - r.pos
+}
+
+func (r *Reader) ReadBit() (uint32, error) {
+	if r.Left() < 1 {
+		return 0, ErrOutOfData
+	}
+	b := uint32(r.buf[r.pos>>3]>>(7-uint(r.pos&7))) & 1
+	r.pos++
+	return b, nil
+}
+
+func (r *Reader) ReadFlag() (bool, error) {
+	b, err := r.ReadBit()
+	return b == 1, err
+}
+
+// ReadBits reads up to 32 bits.
+func (r *Reader) ReadBits(n int) (uint32, error) {
+	if r.Left() < n {
+		return 0, ErrOutOfData
+	}
+	ret := uint32(0)
+	for i := 0; i < n; i++ {
+		b, _ := r.ReadBit()
+		ret = ret<<1 | b
+	}
+	return ret, nil
+}
+
+func (r *Reader) Skip(n int) error {
+	if r.Left() < n {
+		return ErrOutOfData
+	}
+	r.pos += n
+	return nil
+}
+
+// ReadUE reads an unsigned exp-Golomb code.
+func (r *Reader) ReadUE() (uint32, error) {
+	zeros := 0
+	for {
+		b, err := r.ReadBit()
+		if err != nil {
+			return 0, err
+		}
+		if b == 1 {
+			break
+		}
+		zeros++
+		if zeros > 31 {
+			return 0, ErrOutOfData
+		}
+	}
+	v, err := r.ReadBits(zeros)
+	if err != nil {
+		return 0, err
+	}
+	return (1<<uint(zeros) - 1) + v, nil
+}
+
+// ReadSE reads a signed exp-Golomb code.
+func (r *Reader) ReadSE() (int32, error) {
+	v, err := r.ReadUE()
+	if err != nil {
+		return 0, err
+	}
+	if v&1 == 1 {
+		return int32((v + 1) / 2), nil
+	}
+	return -int32(v / 2), nil
+}
@@ -36,6 +36,19 @@ func Run(ctx context.Context, path string) (FFProbeData, error) {
 
 func (d FFProbeData) Codecs() string {
 	video := d.GetVideo()
+	audio := d.GetAudio()
+	if video.Codecs != "" || audio.Codecs != "" {
+		// the native prober knows the exact codec strings.
+		codecs := []string{}
+		if video.Codecs != "" {
+			codecs = append(codecs, video.Codecs)
+		}
+		if audio.Codecs != "" {
+			codecs = append(codecs, audio.Codecs)
+		}
+		return strings.Join(codecs, ",")
+	}
+
 	videoProfile := ""
 	switch video.Profile {
 	case "100", "High":
@@ -47,7 +60,6 @@ func (d FFProbeData) Codecs() string {
 	}
 	videoCodec := fmt.Sprintf("%s.%s%d", video.CodecName, videoProfile, int(video.Level))
 	audioCodec := ""
-	audio := d.GetAudio()
 	switch audio.CodecName {
 	case "aac":
 		// FF_PROFILE_AAC_MAIN    0
@@ -130,6 +142,7 @@ type FFProbeDataStream struct {
 	ChromaLocation     string                       `json:"chroma_location"`
 	Refs               float64                      `json:"refs"`
 	BitsPerRawSample   string                       `json:"bits_per_raw_sample"`
+	Codecs             string                       `json:"codecs,omitempty"`
 	Disposition        FFProbeDataStreamDisposition `json:"disposition"`
 }
 
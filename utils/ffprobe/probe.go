@@ -0,0 +1,362 @@
+package ffprobe
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/viderstv/common/streaming/av"
+	"github.com/viderstv/common/streaming/container/flv"
+	"github.com/viderstv/common/streaming/container/ts"
+	"github.com/viderstv/common/streaming/parser"
+	"github.com/viderstv/common/streaming/parser/aac"
+	"github.com/viderstv/common/streaming/parser/h264"
+	"github.com/viderstv/common/streaming/parser/mp3"
+)
+
+const (
+	DefaultProbeDuration = time.Second * 5
+)
+
+var (
+	ErrNoStreams     = fmt.Errorf("no streams found")
+	ErrUnknownFormat = fmt.Errorf("unknown container format")
+	// ErrUnsupportedURL is returned by RunNative for stream urls, use rtmp.Probe for them.
+	ErrUnsupportedURL = fmt.Errorf("unsupported url, probe rtmp streams with rtmp.Probe")
+)
+
+type trackStats struct {
+	seen   bool
+	bytes  uint64
+	frames int
+	first  int64
+	last   int64
+}
+
+// add records a frame with its timestamp in milliseconds.
+func (t *trackStats) add(ts int64, size int) {
+	if !t.seen {
+		t.seen = true
+		t.first = ts
+	}
+	if ts > t.last {
+		t.last = ts
+	}
+	t.bytes += uint64(size)
+	t.frames++
+}
+
+func (t trackStats) duration() time.Duration {
+	return time.Duration(t.last-t.first) * time.Millisecond
+}
+
+func (t trackStats) bitrate() int {
+	ms := t.last - t.first
+	if ms <= 0 {
+		return 0
+	}
+	return int(t.bytes * 8 * 1000 / uint64(ms))
+}
+
+// frameRate returns the measured frame rate as a rational, frames between the first and last frame over the elapsed time.
+func (t trackStats) frameRate() (int64, int64) {
+	ms := t.last - t.first
+	if ms <= 0 || t.frames < 2 {
+		return 0, 1
+	}
+	return int64(t.frames-1) * 1000, ms
+}
+
+func gcd(a, b int64) int64 {
+	for b != 0 {
+		a, b = b, a%b
+	}
+	return a
+}
+
+func rational(num, den int64) string {
+	if num == 0 || den == 0 {
+		return "0/0"
+	}
+	g := gcd(num, den)
+	return fmt.Sprintf("%d/%d", num/g, den/g)
+}
+
+// RunNative is a drop in for Run which does not need the ffprobe binary, it supports flv and mpegts files.
+// Rtmp urls are probed with rtmp.Probe.
+func RunNative(ctx context.Context, path string, duration time.Duration) (FFProbeData, error) {
+	if strings.HasPrefix(path, "rtmp://") || strings.HasPrefix(path, "rtmps://") {
+		return FFProbeData{}, ErrUnsupportedURL
+	}
+
+	return ProbeFile(ctx, path, duration)
+}
+
+// ProbeFile probes an flv or mpegts file, the container is detected from the first bytes.
+func ProbeFile(ctx context.Context, path string, duration time.Duration) (FFProbeData, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return FFProbeData{}, err
+	}
+	defer f.Close()
+
+	r := bufio.NewReader(f)
+	magic, err := r.Peek(3)
+	if err != nil {
+		return FFProbeData{}, err
+	}
+
+	var data FFProbeData
+	switch {
+	case magic[0] == 'F' && magic[1] == 'L' && magic[2] == 'V':
+		reader, err := flv.NewReader(r, av.Info{URL: path})
+		if err != nil {
+			return FFProbeData{}, err
+		}
+		data, err = Probe(ctx, reader, duration)
+		if err != nil {
+			return data, err
+		}
+	case magic[0] == 0x47:
+		data, err = ProbeTS(ctx, r, duration)
+		if err != nil {
+			return data, err
+		}
+	default:
+		return FFProbeData{}, ErrUnknownFormat
+	}
+
+	data.Format.Filename = path
+	return data, nil
+}
+
+// Probe reads packets from r until duration of stream time has passed or the reader ends
+// and describes the streams the same way ffprobe does.
+func Probe(ctx context.Context, r av.ReadCloser, duration time.Duration) (FFProbeData, error) {
+	if duration <= 0 {
+		duration = DefaultProbeDuration
+	}
+
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		select {
+		case <-ctx.Done():
+			// unblocks the pending read
+			_ = r.Close()
+		case <-done:
+		}
+	}()
+
+	var (
+		p            av.Packet
+		video, audio trackStats
+	)
+	codecParser := parser.NewCodecParser()
+	demuxer := flv.NewDemuxer()
+
+	for video.duration() < duration && audio.duration() < duration {
+		if err := r.Read(&p); err != nil {
+			if ctx.Err() != nil {
+				return FFProbeData{}, ctx.Err()
+			}
+			if err == io.EOF || err == io.ErrUnexpectedEOF {
+				break
+			}
+			return FFProbeData{}, err
+		}
+
+		if p.IsMetadata {
+			continue
+		}
+
+		pkt := p
+		if err := demuxer.Demux(&pkt); err != nil {
+			continue
+		}
+
+		if pkt.IsVideo {
+			vh, ok := pkt.Header.(av.VideoPacketHeader)
+			if !ok {
+				continue
+			}
+			if vh.IsSeq() {
+				_ = codecParser.Parse(&pkt, io.Discard)
+				continue
+			}
+			video.add(int64(pkt.TimeStamp), len(pkt.Data))
+		} else {
+			ah, ok := pkt.Header.(av.AudioPacketHeader)
+			if !ok {
+				continue
+			}
+			if ah.SoundFormat() == av.SOUND_AAC && ah.AACPacketType() == av.AAC_SEQHDR {
+				_ = codecParser.Parse(&pkt, io.Discard)
+				continue
+			}
+			if ah.SoundFormat() == av.SOUND_MP3 && !audio.seen {
+				_ = codecParser.Parse(&pkt, io.Discard)
+			}
+			audio.add(int64(pkt.TimeStamp), len(pkt.Data))
+		}
+	}
+
+	return build(codecParser.StreamInfo(), video, audio, "flv")
+}
+
+// ProbeTS reads an mpegts stream until duration of stream time has passed.
+func ProbeTS(ctx context.Context, r io.Reader, duration time.Duration) (FFProbeData, error) {
+	if duration <= 0 {
+		duration = DefaultProbeDuration
+	}
+
+	var (
+		info         parser.StreamInfo
+		video, audio trackStats
+	)
+	demuxer := ts.NewDemuxer(r)
+	mp3Parser := mp3.NewParser()
+
+	for video.duration() < duration && audio.duration() < duration {
+		if err := ctx.Err(); err != nil {
+			return FFProbeData{}, err
+		}
+
+		f, err := demuxer.ReadFrame()
+		if err != nil {
+			if err == io.EOF {
+				break
+			}
+			return FFProbeData{}, err
+		}
+
+		ms := f.DTS / 90
+		switch f.StreamType {
+		case ts.StreamTypeH264:
+			if !info.HasVideo {
+				for _, nalu := range h264.SplitAnnexB(f.Data) {
+					if len(nalu) == 0 || nalu[0]&0x1f != 7 {
+						continue
+					}
+					if sps, err := h264.ParseSPS(nalu); err == nil {
+						info.ApplySPS(sps)
+					}
+					break
+				}
+			}
+			video.add(ms, len(f.Data))
+		case ts.StreamTypeAAC:
+			// a pes packet usually carries several adts frames
+			data := f.Data
+			for len(data) > 0 {
+				h, err := aac.ParseADTSHeader(data)
+				if err != nil || h.FrameLength <= 0 || h.FrameLength > len(data) {
+					break
+				}
+				if !info.HasAudio {
+					info.ApplyADTS(h)
+				}
+				audio.add(ms, h.FrameLength)
+				ms += int64(1024 * 1000 / h.SampleRate)
+				data = data[h.FrameLength:]
+			}
+		case ts.StreamTypeMP3, ts.StreamTypeMP3b:
+			if !info.HasAudio && mp3Parser.Parse(f.Data) == nil {
+				info.HasAudio = true
+				info.AudioCodec = "mp3"
+				info.AudioCodecs = "mp4a.40.34"
+				info.SampleRate = mp3Parser.SampleRate()
+				info.Channels = mp3Parser.Channels()
+			}
+			audio.add(ms, len(f.Data))
+		}
+	}
+
+	return build(info, video, audio, "mpegts")
+}
+
+func build(info parser.StreamInfo, video, audio trackStats, format string) (FFProbeData, error) {
+	data := FFProbeData{
+		Format: FFProbeDataFormat{
+			FormatName: format,
+			ProbeScore: 100,
+		},
+	}
+
+	var (
+		start, end int64
+		started    bool
+	)
+	track := func(t trackStats) {
+		if !t.seen {
+			return
+		}
+		if !started || t.first < start {
+			start = t.first
+			started = true
+		}
+		if t.last > end {
+			end = t.last
+		}
+	}
+
+	if info.HasVideo {
+		num, den := video.frameRate()
+		avgFrameRate := rational(num, den)
+		rFrameRate := avgFrameRate
+		if info.FPS > 0 {
+			rFrameRate = rational(int64(info.FPS*1000), 1000)
+		}
+
+		data.Streams = append(data.Streams, FFProbeDataStream{
+			Index:             float64(len(data.Streams)),
+			CodecName:         info.VideoCodec,
+			CodecType:         "video",
+			Codecs:            info.VideoCodecs,
+			Profile:           info.VideoProfile,
+			Level:             float64(info.Level),
+			Width:             float64(info.Width),
+			Height:            float64(info.Height),
+			CodedWidth:        float64(info.Width),
+			CodedHeight:       float64(info.Height),
+			SampleAspectRatio: fmt.Sprintf("%d:%d", info.SarWidth, info.SarHeight),
+			RFrameRate:        rFrameRate,
+			AvgFrameRate:      avgFrameRate,
+			BitRate:           strconv.Itoa(video.bitrate()),
+			IsAvc:             "true",
+			TimeBase:          "1/1000",
+		})
+		track(video)
+	}
+
+	if info.HasAudio {
+		data.Streams = append(data.Streams, FFProbeDataStream{
+			Index:         float64(len(data.Streams)),
+			CodecName:     info.AudioCodec,
+			CodecType:     "audio",
+			Codecs:        info.AudioCodecs,
+			Profile:       info.AudioProfile,
+			SampleRate:    strconv.Itoa(info.SampleRate),
+			Channels:      float64(info.Channels),
+			ChannelLayout: info.ChannelLayout,
+			BitRate:       strconv.Itoa(audio.bitrate()),
+			TimeBase:      "1/1000",
+		})
+		track(audio)
+	}
+
+	if len(data.Streams) == 0 {
+		return data, ErrNoStreams
+	}
+
+	data.Format.NbStreams = float64(len(data.Streams))
+	data.Format.StartTime = fmt.Sprintf("%.6f", float64(start)/1000)
+	data.Format.Duration = fmt.Sprintf("%.6f", float64(end-start)/1000)
+
+	return data, nil
+}
@@ -0,0 +1,118 @@
+package ffprobe
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/viderstv/common/streaming/av"
+	"github.com/viderstv/common/streaming/container/flv"
+	"github.com/viderstv/common/streaming/container/ts"
+)
+
+var (
+	avcSeq = []byte{
+		0x17, 0x00, 0x00, 0x00, 0x00,
+		0x01, 0x4d, 0x00, 0x1e, 0xff, 0xe1, 0x00, 0x17, 0x67, 0x4d, 0x00,
+		0x1e, 0xab, 0x40, 0x5a, 0x12, 0x6c, 0x09, 0x28, 0x28, 0x28, 0x2f,
+		0x80, 0x00, 0x01, 0xf4, 0x00, 0x00, 0x61, 0xa8, 0x4a, 0x01, 0x00,
+		0x04, 0x68, 0xde, 0x31, 0x12,
+	}
+	spsNalu = avcSeq[13:36]
+	// aac lc, 44.1khz, stereo
+	aacSeq = []byte{0xaf, 0x00, 0x12, 0x10}
+)
+
+func TestProbeFLV(t *testing.T) {
+	at := assert.New(t)
+
+	path := filepath.Join(t.TempDir(), "test.flv")
+	f, err := os.Create(path)
+	at.Equal(err, nil)
+
+	w := flv.NewFLVWriter("app", "test", "", f)
+	at.Equal(w.Write(&av.Packet{IsVideo: true, Data: avcSeq}), nil)
+	at.Equal(w.Write(&av.Packet{IsAudio: true, Data: aacSeq}), nil)
+	for i := 0; i < 100; i++ {
+		frame := []byte{0x27, 0x01, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x02, 0x41, 0x9a}
+		if i%25 == 0 {
+			frame[0] = 0x17
+			frame[9] = 0x65
+		}
+		at.Equal(w.Write(&av.Packet{IsVideo: true, TimeStamp: uint32(i * 40), Data: frame}), nil)
+		at.Equal(w.Write(&av.Packet{IsAudio: true, TimeStamp: uint32(i * 40), Data: []byte{0xaf, 0x01, 0x21, 0x19}}), nil)
+	}
+	at.Equal(w.Close(), nil)
+
+	data, err := ProbeFile(context.Background(), path, time.Second*2)
+	at.Equal(err, nil)
+	at.Equal(data.Format.FormatName, "flv")
+	at.Equal(len(data.Streams), 2)
+
+	video := data.GetVideo()
+	at.Equal(video.CodecName, "h264")
+	at.Equal(video.Profile, "Main")
+	at.Equal(video.Level, float64(30))
+	at.Equal(video.Width, float64(720))
+	at.Equal(video.Height, float64(576))
+	at.Equal(video.CalculateFPS(), 25)
+
+	audio := data.GetAudio()
+	at.Equal(audio.CodecName, "aac")
+	at.Equal(audio.Profile, "LC")
+	at.Equal(audio.SampleRate, "44100")
+	at.Equal(audio.Channels, float64(2))
+
+	at.Equal(data.Codecs(), "avc1.4D001E,mp4a.40.2")
+}
+
+func TestProbeTS(t *testing.T) {
+	at := assert.New(t)
+
+	buf := bytes.NewBuffer(nil)
+	m := ts.NewMuxer()
+	buf.Write(m.PAT())
+	buf.Write(m.PMT(av.SOUND_AAC, true))
+
+	keyframe := &flv.Tag{}
+	_, err := keyframe.ParseMediaTagHeader([]byte{0x17, 0x01, 0x00, 0x00, 0x00}, true)
+	at.Equal(err, nil)
+
+	for i := 0; i < 50; i++ {
+		frame := []byte{0x00, 0x00, 0x00, 0x01, 0x09, 0xf0}
+		if i == 0 {
+			frame = append(frame, 0x00, 0x00, 0x00, 0x01)
+			frame = append(frame, spsNalu...)
+		}
+		frame = append(frame, 0x00, 0x00, 0x00, 0x01, 0x65, 0x88)
+		frame = append(frame, make([]byte, 256)...)
+		at.Equal(m.Mux(&av.Packet{IsVideo: true, Header: keyframe, TimeStamp: uint32(i * 40), Data: frame}, buf), nil)
+
+		// adts header for aac lc, 48khz, stereo with 2 bytes of payload
+		adts := []byte{0xff, 0xf1, 0x4c, 0x80, 0x01, 0x3f, 0xfc, 0x21, 0x19}
+		at.Equal(m.Mux(&av.Packet{IsAudio: true, TimeStamp: uint32(i * 40), Data: adts}, buf), nil)
+	}
+
+	data, err := ProbeTS(context.Background(), buf, time.Second*5)
+	at.Equal(err, nil)
+	at.Equal(data.Format.FormatName, "mpegts")
+
+	video := data.GetVideo()
+	at.Equal(video.Width, float64(720))
+	at.Equal(video.Height, float64(576))
+	at.Equal(video.CalculateFPS(), 25)
+
+	audio := data.GetAudio()
+	at.Equal(audio.SampleRate, "48000")
+	at.Equal(audio.Channels, float64(2))
+	at.Equal(audio.Profile, "LC")
+}
+
+func TestRunNativeURL(t *testing.T) {
+	_, err := RunNative(context.Background(), "rtmp://127.0.0.1/live/one", time.Second)
+	assert.Equal(t, err, ErrUnsupportedURL)
+}